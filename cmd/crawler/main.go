@@ -16,89 +16,125 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/joho/godotenv/autoload"
 
+	"books/internal/config"
 	"books/internal/crawler"
 	"books/internal/logger"
+	"books/internal/metrics"
+	"books/internal/storage"
 	"books/internal/storage/authors"
 	"books/internal/storage/books"
 	"books/internal/storage/fails"
 	"books/internal/storage/genres"
 	"books/internal/storage/series"
+	"books/internal/tracing"
 )
 
-func getEnvOrDefault(key, default_ string) string {
-	if val := strings.TrimSpace(os.Getenv(key)); val != "" {
-		return val
+func main() {
+	_, thisFile, _, _ := runtime.Caller(0)
+
+	conf, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		slog.Error("Invalid configuration:\n" + err.Error())
+		os.Exit(1)
 	}
 
-	return default_
-}
+	levels, _ := logger.ParseLevels(conf.Log.Level)
+	logger.SetupSLog(levels, conf.Log.Format, conf.Log.Sampling, path.Dir(path.Dir(path.Dir(thisFile))), struct{}{})
 
-var (
-	feedAuthors = getEnvOrDefault("FEED_AUTHORS", "https://flibusta.is/opds/authorsindex")
-	feedSeries  = getEnvOrDefault("FEED_SERIES", "https://flibusta.is/opds/sequencesindex")
-	logLevel    = strings.ToLower(getEnvOrDefault("LOG_LEVEL", "debug"))
-	dbConnStr   = os.Getenv("DATABASE_URL")
-)
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := conf.Print(os.Stdout); err != nil {
+			slog.Error("failed to print config: " + err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 
-func main() {
-	_, thisFile, _, _ := runtime.Caller(0)
+	// Validated by config.Load
+	urlAuthors, _ := url.Parse(conf.Crawler.FeedAuthors)
+	urlSeries, _ := url.Parse(conf.Crawler.FeedSeries)
 
-	var lvl slog.Level
-	err := lvl.UnmarshalText([]byte(logLevel))
+	cfg, err := conf.Database.PoolConfig()
 	if err != nil {
-		lvl = slog.LevelDebug
+		slog.Error("Failed to parse database URL: " + err.Error())
+		os.Exit(1)
 	}
-	logger.SetupSLog(lvl, path.Dir(path.Dir(path.Dir(thisFile))), struct{}{})
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "books-crawler", conf.Tracing.Exporter, conf.Tracing.File)
 	if err != nil {
-		slog.Error("Invalid log level specified in LOG_LEVEL, one of debug, info, warn or error expected")
+		slog.Error("failed to set up tracing: " + err.Error())
 		os.Exit(1)
 	}
 
-	if feedAuthors == "" {
-		slog.Error("You need to specify FEED_AUTHORS env var")
-		os.Exit(1)
+	// Spans are exported in batches, so flush the rest before exit
+	exit := func(code int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces: " + err.Error())
+		}
+		os.Exit(code)
 	}
 
-	urlAuthors, err := url.Parse(feedAuthors)
+	cfg.ConnConfig.Tracer = tracing.NewPGXTracer(
+		logger.NewPGXTracer(conf.Database.SlowQueryThreshold, conf.Database.SlowQueryExplain))
+
+	pg, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
-		slog.Error("Invalid URL in FEED_AUTHORS: " + err.Error())
-		os.Exit(1)
+		slog.Error("failed to create postgres pool: " + err.Error())
+		exit(1)
 	}
 
-	if feedSeries == "" {
-		slog.Error("You need to specify FEED_SERIES env var")
-		os.Exit(1)
+	migrations := storage.MigrationsFS(conf.Database.MigrationsDir)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		command := ""
+		if len(os.Args) > 2 {
+			command = os.Args[2]
+		}
+
+		if err := storage.Migrate(context.Background(), pg, migrations, command, os.Stdout); err != nil {
+			slog.Error("Migration failed: " + err.Error())
+			exit(1)
+		}
+		exit(0)
 	}
 
-	urlSeries, err := url.Parse(feedSeries)
-	if err != nil {
-		slog.Error("Invalid URL in FEED_SERIES: " + err.Error())
-		os.Exit(1)
+	if conf.Database.AutoMigrate {
+		if err := storage.Migrate(context.Background(), pg, migrations, "up", os.Stdout); err != nil {
+			slog.Error("Migration failed: " + err.Error())
+			exit(1)
+		}
 	}
 
-	cfg, err := pgxpool.ParseConfig(dbConnStr)
+	checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err = storage.CheckSchema(checkCtx, pg, migrations)
+	cancel()
 	if err != nil {
-		slog.Error("Failed to parse DATABASE_URL: " + err.Error())
-		os.Exit(1)
+		slog.Error("Refusing to start: " + err.Error())
+		exit(1)
 	}
 
-	cfg.ConnConfig.Tracer = logger.NewPGXTracer()
+	if metricsAddr := conf.Crawler.MetricsAddr; metricsAddr != "" {
+		metrics.RegisterPool(pg)
 
-	pg, err := pgxpool.NewWithConfig(context.Background(), cfg)
-	if err != nil {
-		slog.Error("failed to create postgres pool: " + err.Error())
-		os.Exit(1)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+
+		go func() {
+			slog.Error("metrics server failed: " + http.ListenAndServe(metricsAddr, mux).Error())
+		}()
 	}
 
-	cr := crawler.Flibusta{Client: http.DefaultClient, Logger: slog.Default()}
+	cr := crawler.Flibusta{Client: conf.HTTPClient.NewClient(), Logger: slog.Default()}
 
 	c := crawler.StoringConsumer{
 		Logger:  slog.Default(),
-		Books:   books.NewPGXRepository(pg, slog.Default()),
-		Authors: authors.NewPGXRepository(pg, slog.Default()),
-		Genres:  genres.NewPGXRepository(pg, slog.Default()),
-		Series:  series.NewPGXRepository(pg, slog.Default()),
+		Books:   books.NewTracedRepository(books.NewPGXRepository(pg, slog.Default())),
+		Authors: authors.NewTracedRepository(authors.NewPGXRepository(pg, slog.Default())),
+		Genres:  genres.NewTracedRepository(genres.NewPGXRepository(pg, slog.Default())),
+		Series:  series.NewTracedRepository(series.NewPGXRepository(pg, slog.Default())),
+		Changes: storage.NewPGXNotifier(pg),
 	}
 
 	fr := fails.NewPGXRepository(pg, slog.Default())
@@ -115,24 +151,26 @@ func main() {
 			t, err = time.Parse(time.DateTime, os.Args[2])
 			if err != nil {
 				slog.Error("Invalid start time provided: " + err.Error())
-				os.Exit(1)
+				exit(1)
 			}
 		}
 
 		err = resume(&t, &cr, fr, &c, &h)
 		if err != nil {
 			slog.Error("Resume failed: " + err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 
-		os.Exit(0)
+		exit(0)
 	}
 
 	err = cr.Crawl(urlAuthors, urlSeries, &c, &h)
 	if err != nil {
 		slog.Error("Crawl failed: " + err.Error())
-		os.Exit(1)
+		exit(1)
 	}
+
+	exit(0)
 }
 
 func resume(startTime *time.Time, cr crawler.Crawler, fr fails.Repository, c crawler.Consumer, h crawler.ErrorHandler) error {
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"time"
+
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/joho/godotenv/autoload"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"books/internal/config"
+	"books/internal/grpcserver"
+	"books/internal/logger"
+	"books/internal/storage"
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/genres"
+	"books/internal/storage/series"
+)
+
+func main() {
+	_, thisFile, _, _ := runtime.Caller(0)
+
+	conf, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		slog.Error("Invalid configuration:\n" + err.Error())
+		os.Exit(1)
+	}
+
+	levels, _ := logger.ParseLevels(conf.Log.Level)
+	logger.SetupSLog(levels, conf.Log.Format, conf.Log.Sampling, path.Dir(path.Dir(path.Dir(thisFile))), struct{}{})
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := conf.Print(os.Stdout); err != nil {
+			slog.Error("failed to print config: " + err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := conf.Database.PoolConfig()
+	if err != nil {
+		slog.Error("Failed to parse database URL: " + err.Error())
+		os.Exit(1)
+	}
+
+	cfg.ConnConfig.Tracer = logger.NewPGXTracer(conf.Database.SlowQueryThreshold, conf.Database.SlowQueryExplain)
+
+	pg, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		slog.Error("failed to create postgres pool: " + err.Error())
+		os.Exit(1)
+	}
+
+	migrations := storage.MigrationsFS(conf.Database.MigrationsDir)
+
+	checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err = storage.CheckSchema(checkCtx, pg, migrations)
+	cancel()
+	if err != nil {
+		slog.Error("Refusing to start: " + err.Error())
+		os.Exit(1)
+	}
+
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcserver.LoggingInterceptor),
+		grpc.StreamInterceptor(grpcserver.StreamLoggingInterceptor),
+	)
+
+	grpcserver.Register(s,
+		authors.NewPGXRepository(pg, slog.Default()),
+		books.NewPGXRepository(pg, slog.Default()),
+		genres.NewPGXRepository(pg, slog.Default()),
+		series.NewPGXRepository(pg, slog.Default()),
+		conf.GRPC.MaxLimit,
+		conf.GRPC.DebugMode,
+	)
+	reflection.Register(s)
+
+	lis, err := net.Listen("tcp", conf.GRPC.BindAddr)
+	if err != nil {
+		slog.Error("failed to listen: " + err.Error())
+		os.Exit(1)
+	}
+
+	slog.Error("aborting: " + s.Serve(lis).Error())
+	os.Exit(1)
+}
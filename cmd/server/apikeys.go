@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"books/internal/config"
+	"books/internal/storage/apikeys"
+)
+
+const apiKeyUsage = `usage:
+  apikey create [-rate N] [-quota N] NAME  creates the key, it is only shown once
+  apikey list                              lists the keys
+  apikey revoke ID                         revokes the key, it keeps working for up to a minute`
+
+// apiKeyCommand runs apikey subcommand with the args following it
+func apiKeyCommand(ctx context.Context, keys apikeys.Repository, conf config.APIKeys, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		rate := fs.Int("rate", conf.KeyRate, "requests per minute")
+		quota := fs.Int("quota", conf.KeyDailyQuota, "requests per day")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return fmt.Errorf("%w\n%s", err, apiKeyUsage)
+		}
+
+		name := strings.TrimSpace(strings.Join(fs.Args(), " "))
+		if name == "" || *rate <= 0 || *quota <= 0 {
+			return errors.New(apiKeyUsage)
+		}
+
+		key, k, err := keys.Create(ctx, name, *rate, *quota)
+		if err != nil {
+			return fmt.Errorf("creating key: %w", err)
+		}
+
+		fmt.Fprintf(w, "Created key #%d %q, %d requests per minute and %d per day:\n%s\n",
+			k.Id, k.Name, k.RatePerMinute, k.DailyQuota, key)
+	case "list":
+		ks, err := keys.List(ctx)
+		if err != nil {
+			return fmt.Errorf("listing keys: %w", err)
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tRATE\tQUOTA\tCREATED\tLAST USED\tREVOKED")
+		for _, k := range ks {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", k.Id, k.Name, k.Prefix, k.RatePerMinute, k.DailyQuota,
+				k.CreatedAt.Format(time.DateTime), formatTime(k.LastUsedAt), formatTime(k.RevokedAt))
+		}
+
+		return tw.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(apiKeyUsage)
+		}
+
+		id, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[1])
+		}
+
+		ok, err := keys.Revoke(ctx, uint32(id))
+		if err != nil {
+			return fmt.Errorf("revoking key: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("no active key #%d", id)
+		}
+
+		fmt.Fprintf(w, "Revoked key #%d\n", id)
+	default:
+		return errors.New(apiKeyUsage)
+	}
+
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time.DateTime)
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
-	"strings"
+	"syscall"
+	"time"
 
 	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
 	"github.com/go-chi/chi/v5"
@@ -15,83 +19,221 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/joho/godotenv/autoload"
 
+	"books/internal/config"
 	"books/internal/logger"
+	"books/internal/metrics"
 	"books/internal/response"
 	"books/internal/server"
+	"books/internal/storage"
+	"books/internal/storage/apikeys"
 	"books/internal/storage/authors"
 	"books/internal/storage/books"
 	"books/internal/storage/genres"
 	"books/internal/storage/series"
+	"books/internal/tracing"
 )
 
-func getEnvOrDefault(key, default_ string) string {
-	if val := strings.TrimSpace(os.Getenv(key)); val != "" {
-		return val
+func main() {
+	_, thisFile, _, _ := runtime.Caller(0)
+
+	conf, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		slog.Error("Invalid configuration:\n" + err.Error())
+		os.Exit(1)
 	}
 
-	return default_
-}
+	levels, _ := logger.ParseLevels(conf.Log.Level)
+	logger.SetupSLog(levels, conf.Log.Format, conf.Log.Sampling, path.Dir(path.Dir(path.Dir(thisFile))),
+		middleware.RequestIDKey)
 
-func getBoolEnv(key string) bool {
-	if val := strings.ToLower(os.Getenv(key)); val == "yes" || val == "on" || val == "true" {
-		return true
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := conf.Print(os.Stdout); err != nil {
+			slog.Error("failed to print config: " + err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
-	return false
-}
-
-var (
-	logLevel  = strings.ToLower(getEnvOrDefault("LOG_LEVEL", "debug"))
-	dbConnStr = os.Getenv("DATABASE_URL")
-	bindAddr  = getEnvOrDefault("BIND_ADDR", ":8080")
-	debugMode = getBoolEnv("DEBUG_MODE")
+	cfg, err := conf.Database.PoolConfig()
+	if err != nil {
+		slog.Error("Failed to parse database URL: " + err.Error())
+		os.Exit(1)
+	}
 
-	webDir      = getEnvOrDefault("WEB_DIR", "/web")
-	openApiYaml = getEnvOrDefault("OPENAPI_YAML", webDir+"/openapi.yaml")
-)
+	shutdownTracing, err := tracing.Setup(context.Background(), "books-server", conf.Tracing.Exporter, conf.Tracing.File)
+	if err != nil {
+		slog.Error("failed to set up tracing: " + err.Error())
+		os.Exit(1)
+	}
 
-func main() {
-	_, thisFile, _, _ := runtime.Caller(0)
+	cfg.ConnConfig.Tracer = tracing.NewPGXTracer(
+		logger.NewPGXTracer(conf.Database.SlowQueryThreshold, conf.Database.SlowQueryExplain))
 
-	var lvl slog.Level
-	err := lvl.UnmarshalText([]byte(logLevel))
+	pg, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
-		lvl = slog.LevelDebug
+		slog.Error("failed to create postgres pool: " + err.Error())
+		os.Exit(1)
+	}
+
+	migrations := storage.MigrationsFS(conf.Database.MigrationsDir)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		command := ""
+		if len(os.Args) > 2 {
+			command = os.Args[2]
+		}
+
+		if err := storage.Migrate(context.Background(), pg, migrations, command, os.Stdout); err != nil {
+			slog.Error("Migration failed: " + err.Error())
+			os.Exit(1)
+		}
+		return
 	}
-	logger.SetupSLog(lvl, path.Dir(path.Dir(path.Dir(thisFile))), middleware.RequestIDKey)
 
+	if conf.Database.AutoMigrate {
+		if err := storage.Migrate(context.Background(), pg, migrations, "up", os.Stdout); err != nil {
+			slog.Error("Migration failed: " + err.Error())
+			os.Exit(1)
+		}
+	}
+
+	checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err = storage.CheckSchema(checkCtx, pg, migrations)
+	cancel()
 	if err != nil {
-		slog.Error("Invalid log level specified in LOG_LEVEL, one of debug, info, warn or error expected")
+		slog.Error("Refusing to start: " + err.Error())
 		os.Exit(1)
 	}
 
-	cfg, err := pgxpool.ParseConfig(dbConnStr)
+	kr := apikeys.NewPGXRepository(pg, slog.Default())
+
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := apiKeyCommand(context.Background(), kr, conf.Server.APIKeys, os.Args[2:], os.Stdout); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	assets := server.Assets(conf.Server.WebDir)
+
+	spec, err := server.ReadSpec(assets, conf.Server.OpenApiYaml)
 	if err != nil {
-		slog.Error("Failed to parse DATABASE_URL: " + err.Error())
+		slog.Error("failed to read OpenAPI spec: " + err.Error())
 		os.Exit(1)
 	}
 
-	cfg.ConnConfig.Tracer = logger.NewPGXTracer()
-
-	pg, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	v, err := server.NewValidator(spec, conf.Server.MaxLimit)
 	if err != nil {
-		slog.Error("failed to create postgres pool: " + err.Error())
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	metrics.RegisterPool(pg)
+
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
+	proxies := conf.Server.RateLimit.Proxies()
+	r.Use(server.ClientIP(proxies))
+	r.Use(tracing.Middleware)
+	r.Use(metrics.Middleware)
+	r.Use(server.CORS(conf.Server.CORS.AllowedOrigins, conf.Server.CORS.AllowedMethods,
+		conf.Server.CORS.AllowedHeaders, conf.Server.CORS.MaxAge))
+
+	ar := authors.NewPGXRepository(pg, slog.Default())
+	br := books.NewPGXRepository(pg, slog.Default())
+	gr := genres.NewPGXRepository(pg, slog.Default())
+	sr := series.NewPGXRepository(pg, slog.Default())
+
+	if size, ttl := conf.Server.QueryCacheSize, conf.Server.QueryCacheTTL; size > 0 {
+		car := authors.NewCachedRepository(ar, size, ttl)
+		cbr := books.NewCachedRepository(br, size, ttl)
+		cgr := genres.NewCachedRepository(gr, size, ttl)
+		csr := series.NewCachedRepository(sr, size, ttl)
+		ar, br, gr, sr = car, cbr, cgr, csr
+
+		// Crawler announces the changes it stores
+		go storage.Listen(ctx, pg, slog.Default(), car, cbr, cgr, csr)
+	}
 
-	r.Mount("/api", server.Handler(
-		authors.NewPGXRepository(pg, slog.Default()),
-		books.NewPGXRepository(pg, slog.Default()),
-		genres.NewPGXRepository(pg, slog.Default()),
-		series.NewPGXRepository(pg, slog.Default()),
-		&response.Responder{DebugMode: debugMode},
-	))
+	ar = authors.NewTracedRepository(ar)
+	br = books.NewTracedRepository(br)
+	gr = genres.NewTracedRepository(gr)
+	sr = series.NewTracedRepository(sr)
+	rr := &response.Responder{DebugMode: conf.Server.DebugMode, MaxAge: conf.Server.CacheMaxAge}
+	// API responses are limited per client, shared caches must not serve them to the others
+	api := &response.Responder{DebugMode: conf.Server.DebugMode, MaxAge: conf.Server.CacheMaxAge, Private: true}
+
+	keys := server.NewAPIKeys(kr, api, conf.Server.APIKeys.AnonymousRate)
+	go keys.Run(ctx, conf.Server.APIKeys.UsageFlushPeriod, slog.Default())
+
+	limit := server.NewRateLimit(api, conf.Server.RateLimit.Cheap, conf.Server.RateLimit.Expensive)
+
+	r.Mount("/api", server.Handler(ar, br, gr, sr, api, v, limit.Middleware, keys.Middleware))
+	server.MountOPDS(r, ar, br, gr, sr, rr)
+	server.MountOPDS2(r, ar, br, gr, sr, rr)
+
+	server.Static(r, rr, assets, spec, proxies)
+
+	r.Handle("/metrics", metrics.Handler())
+
+	server.Health(r, rr,
+		server.ReadinessCheck{Name: "database", Check: pg.Ping},
+		server.ReadinessCheck{Name: "migrations", Check: func(ctx context.Context) error {
+			pending, err := storage.PendingMigrations(ctx, pg, migrations)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("%d pending, first is %d", len(pending), pending[0])
+			}
+			return nil
+		}})
+
+	srv := &http.Server{
+		Addr:         conf.Server.BindAddr,
+		Handler:      r,
+		ReadTimeout:  conf.Server.ReadTimeout,
+		WriteTimeout: conf.Server.WriteTimeout,
+		IdleTimeout:  conf.Server.IdleTimeout,
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+
+		<-ctx.Done()
+		slog.Info("shutting down, draining connections")
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(drainCtx); err != nil {
+			slog.Error("draining connections: " + err.Error())
+		}
+	}()
+
+	err = srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("aborting: " + err.Error())
+		os.Exit(1)
+	}
+
+	// ListenAndServe returns as soon as Shutdown starts
+	<-drained
 
-	server.Static(r, openApiYaml, webDir)
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys.Flush(flushCtx, slog.Default())
+	pg.Close()
+
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces: " + err.Error())
+	}
 
-	slog.Error("aborting: " + http.ListenAndServe(bindAddr, r).Error())
-	os.Exit(1)
+	slog.Info("stopped")
 }
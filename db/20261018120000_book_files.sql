@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+
+create table book_file
+(
+    book_id varchar(255)  not null references book,
+    format  varchar(255)  not null,
+    type    varchar(255)  not null default '',
+    url     varchar(1023) not null,
+    primary key (book_id, format)
+);
+
+create index book_by_format on book_file (format);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+drop table book_file;
+
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+alter table book
+    add column added_at timestamp not null default now();
+
+create index book_by_added_at on book (added_at);
+
+create index book_by_year on book (year);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+drop index book_by_year;
+
+drop index book_by_added_at;
+
+alter table book
+    drop column added_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,114 @@
+-- +goose Up
+-- +goose StatementBegin
+
+alter table book
+    add column updated_at timestamp not null default now();
+
+alter table author
+    add column updated_at timestamp not null default now();
+
+alter table series
+    add column updated_at timestamp not null default now();
+
+create function touch_updated_at() returns trigger
+    language plpgsql as
+$$
+begin
+    new.updated_at = now();
+    return new;
+end
+$$;
+
+create trigger book_updated_at
+    before update
+    on book
+    for each row
+execute function touch_updated_at();
+
+create trigger author_updated_at
+    before update
+    on author
+    for each row
+execute function touch_updated_at();
+
+create trigger series_updated_at
+    before update
+    on series
+    for each row
+execute function touch_updated_at();
+
+-- Changed links are changes of the book, and of the author or series on the other side
+create function touch_linked() returns trigger
+    language plpgsql as
+$$
+declare
+    link record;
+begin
+    if tg_op = 'DELETE' then
+        link = old;
+    else
+        link = new;
+    end if;
+
+    update book set updated_at = now() where id = link.book_id;
+
+    if tg_table_name = 'book_author' then
+        update author set updated_at = now() where id = link.author_id;
+    elsif tg_table_name = 'book_series' then
+        update series set updated_at = now() where id = link.series_id;
+    end if;
+
+    return null;
+end
+$$;
+
+create trigger book_author_updated_at
+    after insert or update or delete
+    on book_author
+    for each row
+execute function touch_linked();
+
+create trigger book_genre_updated_at
+    after insert or update or delete
+    on book_genre
+    for each row
+execute function touch_linked();
+
+create trigger book_series_updated_at
+    after insert or update or delete
+    on book_series
+    for each row
+execute function touch_linked();
+
+create trigger book_file_updated_at
+    after insert or update or delete
+    on book_file
+    for each row
+execute function touch_linked();
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+drop trigger book_file_updated_at on book_file;
+drop trigger book_series_updated_at on book_series;
+drop trigger book_genre_updated_at on book_genre;
+drop trigger book_author_updated_at on book_author;
+drop function touch_linked();
+
+drop trigger series_updated_at on series;
+drop trigger author_updated_at on author;
+drop trigger book_updated_at on book;
+drop function touch_updated_at();
+
+alter table series
+    drop column updated_at;
+
+alter table author
+    drop column updated_at;
+
+alter table book
+    drop column updated_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+
+create table api_key
+(
+    id              serial primary key,
+    name            text      not null,
+    -- Hex sha256 of the key, the key itself is only shown on creation
+    hash            text      not null unique,
+    -- Start of the key to tell them apart
+    prefix          text      not null,
+    rate_per_minute int       not null,
+    daily_quota     int       not null,
+    created_at      timestamp not null default now(),
+    revoked_at      timestamp,
+    last_used_at    timestamp
+);
+
+create table api_key_usage
+(
+    key_id   int    not null references api_key (id) on delete cascade,
+    day      date   not null,
+    requests bigint not null,
+    primary key (key_id, day)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+drop table api_key_usage;
+drop table api_key;
+
+-- +goose StatementEnd
@@ -0,0 +1,7 @@
+// Package db holds the goose migrations, embedded into the binaries
+package db
+
+import "embed"
+
+//go:embed *.sql
+var Migrations embed.FS
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache keeps at most size recently used entries, each for ttl. Safe for concurrent use.
+// Zero size disables caching
+type Cache[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	// Incremented by Delete and Purge
+	gen uint64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	val     V
+	expires time.Time
+}
+
+func New[K comparable, V any](size int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return zero, false
+	}
+
+	c.ll.MoveToFront(el)
+
+	return e.val, true
+}
+
+func (c *Cache[K, V]) Set(key K, val V) {
+	c.SetSince(c.Generation(), key, val)
+}
+
+// Generation changes with every Delete and Purge
+func (c *Cache[K, V]) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// SetSince only sets the value if nothing was invalidated since the generation was taken,
+// so values loaded before the invalidation are not cached
+func (c *Cache[K, V]) SetSince(gen uint64, key K, val V) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+
+	expires := time.Now().Add(c.ttl)
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.val = val
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, val: val, expires: expires})
+
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+func (c *Cache[K, V]) Delete(keys ...K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.ll.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
+
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.ll.Init()
+	clear(c.items)
+}
+
+// Key builds cache key from the method name and its arguments marshalled to JSON.
+// Empty key is returned if they can not be marshalled
+func Key(method string, args ...any) string {
+	bs, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+
+	return method + string(bs)
+}
+
+// Load returns the cached result of the key, or loads and caches it. Errors and empty keys are not cached
+func Load[T any](c *Cache[string, any], key string, load func() (T, error)) (T, error) {
+	if key == "" {
+		return load()
+	}
+
+	if val, ok := c.Get(key); ok {
+		if ret, ok := val.(T); ok {
+			return ret, nil
+		}
+	}
+
+	gen := c.Generation()
+
+	ret, err := load()
+	if err != nil {
+		return ret, err
+	}
+
+	c.SetSince(gen, key, ret)
+
+	return ret, nil
+}
+
+// LoadMany returns the cached values of the keys, loading the missing ones at once.
+// Keys missing from the loaded map are cached as zero values and are not returned
+func LoadMany[K comparable, V comparable](c *Cache[K, V], keys []K,
+	load func(keys ...K) (map[K]V, error)) (map[K]V, error) {
+
+	var zero V
+
+	ret := make(map[K]V, len(keys))
+	var missing []K
+
+	for _, key := range keys {
+		if val, ok := c.Get(key); ok {
+			if val != zero {
+				ret[key] = val
+			}
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		return ret, nil
+	}
+
+	gen := c.Generation()
+
+	loaded, err := load(missing...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range missing {
+		val := loaded[key]
+		c.SetSince(gen, key, val)
+		if val != zero {
+			ret[key] = val
+		}
+	}
+
+	return ret, nil
+}
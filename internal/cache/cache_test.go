@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := New[string, int](2, time.Hour)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	// "a" becomes the most recently used, so "b" is evicted
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a is missing")
+	}
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is not evicted")
+	}
+
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := c.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %v, %v, want %v, true", key, got, ok, want)
+		}
+	}
+
+	// Updating the value does not grow the cache
+	c.Set("c", 4)
+	if got, _ := c.Get("c"); got != 4 {
+		t.Errorf("Get(c) = %v, want 4", got)
+	}
+	if c.ll.Len() != 2 || len(c.items) != 2 {
+		t.Errorf("cache has %d entries in list, %d in map, want 2", c.ll.Len(), len(c.items))
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := New[string, int](10, 10*time.Millisecond)
+
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a is missing right after Set")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("a is not expired")
+	}
+	if len(c.items) != 0 {
+		t.Errorf("expired entry is kept, %d entries", len(c.items))
+	}
+}
+
+func TestZeroSize(t *testing.T) {
+	c := New[string, int](0, time.Hour)
+
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Error("zero size cache keeps values")
+	}
+}
+
+func TestSetSince(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *Cache[string, int])
+		want       bool
+	}{
+		{name: "nothing", invalidate: func(c *Cache[string, int]) {}, want: true},
+		{name: "delete of other key", invalidate: func(c *Cache[string, int]) { c.Delete("b") }},
+		{name: "purge", invalidate: func(c *Cache[string, int]) { c.Purge() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](10, time.Hour)
+
+			gen := c.Generation()
+			tt.invalidate(c)
+			c.SetSince(gen, "a", 1)
+
+			if _, ok := c.Get("a"); ok != tt.want {
+				t.Errorf("Get(a) found = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c := New[string, int](10, time.Hour)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	gen := c.Generation()
+	c.Delete("a", "missing")
+
+	if c.Generation() == gen {
+		t.Error("Delete does not change the generation")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("a is not deleted")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b is deleted")
+	}
+
+	c.Purge()
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is not purged")
+	}
+}
+
+func TestKey(t *testing.T) {
+	if got, want := Key("Search", "war", 10, []string{"a"}), `Search["war",10,["a"]]`; got != want {
+		t.Errorf("Key() = %s, want %s", got, want)
+	}
+
+	if got := Key("Search", make(chan int)); got != "" {
+		t.Errorf("Key() of unmarshalable = %q, want empty", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := New[string, any](10, time.Hour)
+
+	calls := 0
+	load := func() ([]string, error) {
+		calls++
+		return []string{"v" + strconv.Itoa(calls)}, nil
+	}
+
+	for range 2 {
+		got, err := Load(c, "key", load)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, []string{"v1"}) {
+			t.Errorf("Load() = %v, want [v1]", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loaded %d times, want once", calls)
+	}
+
+	// Empty key is not cached
+	for range 2 {
+		if _, err := Load(c, "", load); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("loaded %d times, want 3", calls)
+	}
+
+	// Errors are not cached
+	failed := errors.New("failed")
+	if _, err := Load(c, "failing", func() (int, error) { return 0, failed }); !errors.Is(err, failed) {
+		t.Errorf("Load() error = %v, want %v", err, failed)
+	}
+	if _, ok := c.Get("failing"); ok {
+		t.Error("error is cached")
+	}
+}
+
+func TestLoadPurgedWhileLoading(t *testing.T) {
+	c := New[string, any](10, time.Hour)
+
+	_, err := Load(c, "key", func() (int, error) {
+		// Invalidation comes while the stale value is being loaded
+		c.Purge()
+		return 1, nil
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if _, ok := c.Get("key"); ok {
+		t.Error("value loaded before the purge is cached")
+	}
+}
+
+func TestLoadMany(t *testing.T) {
+	c := New[string, *int](10, time.Hour)
+
+	var requested [][]string
+	load := func(keys ...string) (map[string]*int, error) {
+		requested = append(requested, keys)
+
+		ret := make(map[string]*int)
+		for _, key := range keys {
+			if n, err := strconv.Atoi(key); err == nil {
+				ret[key] = &n
+			}
+		}
+		return ret, nil
+	}
+
+	got, err := LoadMany(c, []string{"1", "x"}, load)
+	if err != nil {
+		t.Fatalf("LoadMany() error = %v", err)
+	}
+	if len(got) != 1 || *got["1"] != 1 {
+		t.Errorf("LoadMany() = %v, want only 1", got)
+	}
+
+	// Both the found and the missing keys are cached
+	got, err = LoadMany(c, []string{"1", "x", "2"}, load)
+	if err != nil {
+		t.Fatalf("LoadMany() error = %v", err)
+	}
+	if len(got) != 2 || *got["1"] != 1 || *got["2"] != 2 {
+		t.Errorf("LoadMany() = %v, want 1 and 2", got)
+	}
+
+	want := [][]string{{"1", "x"}, {"2"}}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %v, want %v", requested, want)
+	}
+
+	// Nothing is loaded when all are cached
+	if _, err := LoadMany(c, []string{"x", "2"}, load); err != nil {
+		t.Fatalf("LoadMany() error = %v", err)
+	}
+	if len(requested) != 2 {
+		t.Errorf("requested %v, want no more", requested[2:])
+	}
+}
+
+func TestLoadManyDeletedWhileLoading(t *testing.T) {
+	c := New[string, string](10, time.Hour)
+
+	_, err := LoadMany(c, []string{"a"}, func(keys ...string) (map[string]string, error) {
+		c.Delete("a")
+		return map[string]string{"a": "stale"}, nil
+	})
+	if err != nil {
+		t.Fatalf("LoadMany() error = %v", err)
+	}
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("value loaded before the delete is cached")
+	}
+}
+
+func TestLoadManyError(t *testing.T) {
+	c := New[string, string](10, time.Hour)
+	failed := errors.New("failed")
+
+	_, err := LoadMany(c, []string{"a"}, func(keys ...string) (map[string]string, error) {
+		return nil, failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("LoadMany() error = %v, want %v", err, failed)
+	}
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("key is cached after the error")
+	}
+}
+
+// Loads racing with purges must not cache the values loaded before the last purge. Run with -race
+func TestLoadRacingPurge(t *testing.T) {
+	c := New[string, any](100, time.Hour)
+
+	var mu sync.Mutex
+	version := 0
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range 200 {
+				if (g+i)%10 == 0 {
+					// The data changes, then the cache is invalidated
+					mu.Lock()
+					version++
+					mu.Unlock()
+					c.Purge()
+					continue
+				}
+
+				_, err := Load(c, "key"+strconv.Itoa(i%5), func() (int, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					return version, nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Everything cached must be loaded after the last change
+	for i := range 5 {
+		if val, ok := c.Get("key" + strconv.Itoa(i)); ok && val != version {
+			t.Errorf("key%d = %v cached, latest version is %d", i, val, version)
+		}
+	}
+}
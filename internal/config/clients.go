@@ -0,0 +1,93 @@
+package config
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolConfig parses the URL and applies the pool settings given
+func (d Database) PoolConfig() (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(d.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.MaxConns > 0 {
+		cfg.MaxConns = d.MaxConns
+	}
+	if d.MinConns > 0 {
+		cfg.MinConns = d.MinConns
+	}
+	if d.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = d.MaxConnLifetime
+	}
+	if d.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = d.MaxConnIdleTime
+	}
+	if d.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = d.HealthCheckPeriod
+	}
+
+	// Timestamps are stored without time zone and read as UTC, so now() must be UTC too
+	cfg.ConnConfig.RuntimeParams["timezone"] = "UTC"
+
+	return cfg, nil
+}
+
+func (h HTTPClient) NewClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = h.MaxIdleConnsPerHost
+	}
+
+	var rt http.RoundTripper = transport
+	if h.UserAgent != "" {
+		rt = &userAgentTransport{next: transport, userAgent: h.UserAgent}
+	}
+
+	return &http.Client{Transport: rt, Timeout: h.Timeout}
+}
+
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (u *userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	r.Header.Set("User-Agent", u.userAgent)
+
+	return u.next.RoundTrip(r)
+}
+
+// Proxies parses the trusted proxies, single addresses are the prefixes of their full length
+func (r RateLimit) Proxies() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(r.TrustedProxies))
+	for _, proxy := range r.TrustedProxies {
+		// Validated by Load
+		p, _ := parsePrefix(proxy)
+		prefixes = append(prefixes, p)
+	}
+
+	return prefixes
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"time"
+)
+
+// Config of all the binaries. Every field can be overridden by the env var in its env tag
+type Config struct {
+	Database   Database   `yaml:"database" toml:"database"`
+	HTTPClient HTTPClient `yaml:"http_client" toml:"http_client"`
+	Crawler    Crawler    `yaml:"crawler" toml:"crawler"`
+	Server     Server     `yaml:"server" toml:"server"`
+	GRPC       GRPC       `yaml:"grpc" toml:"grpc"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Tracing    Tracing    `yaml:"tracing" toml:"tracing"`
+}
+
+type Database struct {
+	URL string `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"true"`
+	// Zero keeps the pgxpool default, or the one in the URL
+	MaxConns          int32         `yaml:"max_conns" toml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns          int32         `yaml:"min_conns" toml:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime" toml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" toml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" toml:"health_check_period" env:"DB_HEALTH_CHECK_PERIOD"`
+	// Goose migrations, the ones built in if empty. Binaries refuse to start while some of them are not applied
+	MigrationsDir string `yaml:"migrations_dir" toml:"migrations_dir" env:"MIGRATIONS_DIR"`
+	// Apply pending migrations on start instead of refusing to run
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate" env:"AUTO_MIGRATE"`
+	// Queries running longer are logged with warn level, zero disables
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" toml:"slow_query_threshold" env:"SLOW_QUERY_THRESHOLD"`
+	// Also log EXPLAIN (ANALYZE, BUFFERS) of slow selects, these are run once more for that
+	SlowQueryExplain bool `yaml:"slow_query_explain" toml:"slow_query_explain" env:"SLOW_QUERY_EXPLAIN"`
+}
+
+// HTTPClient fetches the crawled feeds
+type HTTPClient struct {
+	Timeout             time.Duration `yaml:"timeout" toml:"timeout" env:"HTTP_TIMEOUT"`
+	UserAgent           string        `yaml:"user_agent" toml:"user_agent" env:"HTTP_USER_AGENT"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" toml:"max_idle_conns_per_host" env:"HTTP_MAX_IDLE_CONNS_PER_HOST"`
+}
+
+type Crawler struct {
+	FeedAuthors string `yaml:"feed_authors" toml:"feed_authors" env:"FEED_AUTHORS"`
+	FeedSeries  string `yaml:"feed_series" toml:"feed_series" env:"FEED_SERIES"`
+	// Serves /metrics when set, like :9100
+	MetricsAddr string `yaml:"metrics_addr" toml:"metrics_addr" env:"METRICS_ADDR"`
+}
+
+type Server struct {
+	BindAddr  string `yaml:"bind_addr" toml:"bind_addr" env:"BIND_ADDR"`
+	DebugMode bool   `yaml:"debug_mode" toml:"debug_mode" env:"DEBUG_MODE"`
+	// Overrides maximum of the limit params in openapi.yaml
+	MaxLimit int `yaml:"max_limit" toml:"max_limit" env:"MAX_LIMIT"`
+	// max-age of Cache-Control
+	CacheMaxAge time.Duration `yaml:"cache_max_age" toml:"cache_max_age" env:"CACHE_MAX_AGE"`
+	// Entries of each repository cache, 0 disables caching
+	QueryCacheSize int `yaml:"query_cache_size" toml:"query_cache_size" env:"QUERY_CACHE_SIZE"`
+	// Entries expire even if changes are not notified
+	QueryCacheTTL time.Duration `yaml:"query_cache_ttl" toml:"query_cache_ttl" env:"QUERY_CACHE_TTL"`
+
+	// How long to wait for in-flight requests on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"IDLE_TIMEOUT"`
+
+	// Docs pages and openapi.yaml found there override the built in ones
+	WebDir string `yaml:"web_dir" toml:"web_dir" env:"WEB_DIR"`
+	// Overrides openapi.yaml of web_dir or the built in one
+	OpenApiYaml string `yaml:"openapi_yaml" toml:"openapi_yaml" env:"OPENAPI_YAML"`
+
+	CORS      CORS      `yaml:"cors" toml:"cors"`
+	APIKeys   APIKeys   `yaml:"api_keys" toml:"api_keys"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// CORS is disabled without allowed origins
+type CORS struct {
+	// * allows any origin
+	AllowedOrigins []string      `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods []string      `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders []string      `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	MaxAge         time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// APIKeys limit the requests to /api, managed by apikey subcommand of the server
+type APIKeys struct {
+	// Requests per minute from a client IP without the key, 0 requires the key
+	AnonymousRate int `yaml:"anonymous_rate" toml:"anonymous_rate" env:"API_ANONYMOUS_RATE"`
+	// Limits of the new keys unless given to apikey create
+	KeyRate       int `yaml:"key_rate" toml:"key_rate" env:"API_KEY_RATE"`
+	KeyDailyQuota int `yaml:"key_daily_quota" toml:"key_daily_quota" env:"API_KEY_DAILY_QUOTA"`
+	// How often the usage is stored, instances see each other's usage with that delay
+	UsageFlushPeriod time.Duration `yaml:"usage_flush_period" toml:"usage_flush_period" env:"API_KEY_USAGE_FLUSH_PERIOD"`
+}
+
+// RateLimit limits the requests to /api per client IP, whether they have API keys or not
+type RateLimit struct {
+	// Requests per minute, 0 disables the limit
+	Cheap int `yaml:"cheap" toml:"cheap" env:"RATE_LIMIT_CHEAP"`
+	// Requests per minute to /search, /graphql and /books with groupings, 0 disables the limit
+	Expensive int `yaml:"expensive" toml:"expensive" env:"RATE_LIMIT_EXPENSIVE"`
+	// Addresses or CIDRs of the proxies, X-Forwarded-* headers are only taken into account from them.
+	// They also tell the URL of this server for openapi.yaml
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+type GRPC struct {
+	BindAddr string `yaml:"bind_addr" toml:"bind_addr" env:"GRPC_BIND_ADDR"`
+	// Max value of limit params, and max number of ids requested at once
+	MaxLimit  int  `yaml:"max_limit" toml:"max_limit" env:"GRPC_MAX_LIMIT"`
+	DebugMode bool `yaml:"debug_mode" toml:"debug_mode" env:"DEBUG_MODE"`
+}
+
+type Log struct {
+	// Default level and overrides by component, like info,crawler=debug,pgx=warn
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+	// At most that many identical messages per period, like 100/1s. Empty disables sampling
+	Sampling string `yaml:"sampling" toml:"sampling" env:"LOG_SAMPLING"`
+}
+
+type Tracing struct {
+	// none, otlp (configured by the standard OTEL_EXPORTER_OTLP_* vars) or file
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACES_EXPORTER"`
+	// Spans are appended as JSON lines when exporter is file
+	File string `yaml:"file" toml:"file" env:"TRACES_FILE"`
+}
+
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			SlowQueryThreshold: time.Second,
+		},
+		HTTPClient: HTTPClient{
+			Timeout:             10 * time.Second,
+			MaxIdleConnsPerHost: 4,
+		},
+		Crawler: Crawler{
+			FeedAuthors: "https://flibusta.is/opds/authorsindex",
+			FeedSeries:  "https://flibusta.is/opds/sequencesindex",
+		},
+		Server: Server{
+			BindAddr:        ":8080",
+			MaxLimit:        100,
+			CacheMaxAge:     time.Minute,
+			QueryCacheSize:  10000,
+			QueryCacheTTL:   5 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			CORS: CORS{
+				AllowedMethods: []string{"GET", "HEAD", "POST", "OPTIONS"},
+				AllowedHeaders: []string{"Accept", "Content-Type", "If-None-Match", "If-Modified-Since"},
+				MaxAge:         10 * time.Minute,
+			},
+			APIKeys: APIKeys{
+				AnonymousRate:    60,
+				KeyRate:          600,
+				KeyDailyQuota:    100000,
+				UsageFlushPeriod: 10 * time.Second,
+			},
+			RateLimit: RateLimit{
+				Cheap:     600,
+				Expensive: 60,
+			},
+		},
+		GRPC: GRPC{
+			BindAddr: ":9090",
+			MaxLimit: 1000,
+		},
+		Log: Log{
+			Level:  "debug",
+			Format: "text",
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+			File:     "traces.jsonl",
+		},
+	}
+}
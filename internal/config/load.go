@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"books/internal/logger"
+)
+
+// Load reads the defaults overridden by the YAML or TOML file (by extension, skipped if path is empty)
+// and then by the env vars, and validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(bs))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(bs), c)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parsing %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config %s must be .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// applyEnv overrides the fields having env tag by non-empty env vars. Prefix is the key of v for errors
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("yaml")
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(v.Field(i), key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		val := strings.TrimSpace(os.Getenv(name))
+		if val == "" {
+			continue
+		}
+
+		if err := setValue(v.Field(i), val); err != nil {
+			return fmt.Errorf("%s (env %s): %w", key, name, err)
+		}
+	}
+
+	return nil
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("must be a duration, like 30s or 5m")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "yes", "on", "true", "1":
+			v.SetBool(true)
+		case "no", "off", "false", "0":
+			v.SetBool(false)
+		default:
+			return errors.New("must be a boolean, like yes or no")
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, key, msg string) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, msg))
+		}
+	}
+	isURL := func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	}
+
+	check(c.Database.MaxConns >= 0, "database.max_conns", "must not be negative")
+	check(c.Database.MinConns >= 0, "database.min_conns", "must not be negative")
+	check(c.Database.MaxConns == 0 || c.Database.MinConns <= c.Database.MaxConns,
+		"database.min_conns", "must not exceed max_conns")
+	check(c.Database.MaxConnLifetime >= 0, "database.max_conn_lifetime", "must not be negative")
+	check(c.Database.MaxConnIdleTime >= 0, "database.max_conn_idle_time", "must not be negative")
+	check(c.Database.HealthCheckPeriod >= 0, "database.health_check_period", "must not be negative")
+	check(c.Database.SlowQueryThreshold >= 0, "database.slow_query_threshold", "must not be negative")
+
+	check(c.HTTPClient.Timeout > 0, "http_client.timeout", "must be positive")
+	check(c.HTTPClient.MaxIdleConnsPerHost >= 0, "http_client.max_idle_conns_per_host", "must not be negative")
+
+	check(isURL(c.Crawler.FeedAuthors), "crawler.feed_authors", "must be an absolute URL")
+	check(isURL(c.Crawler.FeedSeries), "crawler.feed_series", "must be an absolute URL")
+
+	check(c.Server.BindAddr != "", "server.bind_addr", "is required")
+	check(c.Server.MaxLimit >= 1, "server.max_limit", "must be positive")
+	check(c.Server.CacheMaxAge >= 0, "server.cache_max_age", "must not be negative")
+	check(c.Server.QueryCacheSize >= 0, "server.query_cache_size", "must not be negative")
+	check(c.Server.QueryCacheTTL > 0, "server.query_cache_ttl", "must be positive")
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdown_timeout", "must not be negative")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout", "must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout", "must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "must not be negative")
+	check(c.Server.CORS.MaxAge >= 0, "server.cors.max_age", "must not be negative")
+	check(c.Server.APIKeys.AnonymousRate >= 0, "server.api_keys.anonymous_rate", "must not be negative")
+	check(c.Server.APIKeys.KeyRate > 0, "server.api_keys.key_rate", "must be positive")
+	check(c.Server.APIKeys.KeyDailyQuota > 0, "server.api_keys.key_daily_quota", "must be positive")
+	check(c.Server.APIKeys.UsageFlushPeriod > 0, "server.api_keys.usage_flush_period", "must be positive")
+	check(c.Server.RateLimit.Cheap >= 0, "server.rate_limit.cheap", "must not be negative")
+	check(c.Server.RateLimit.Expensive >= 0, "server.rate_limit.expensive", "must not be negative")
+	for _, proxy := range c.Server.RateLimit.TrustedProxies {
+		_, err := parsePrefix(proxy)
+		check(err == nil, "server.rate_limit.trusted_proxies", fmt.Sprintf("%q is not an address or CIDR", proxy))
+	}
+
+	check(c.GRPC.BindAddr != "", "grpc.bind_addr", "is required")
+	check(c.GRPC.MaxLimit >= 1, "grpc.max_limit", "must be positive")
+
+	if _, err := logger.ParseLevels(c.Log.Level); err != nil {
+		check(false, "log.level", err.Error())
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format", "must be json or text")
+	if err := logger.ValidateSampling(c.Log.Sampling); err != nil {
+		check(false, "log.sampling", err.Error())
+	}
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "file",
+		"tracing.exporter", "must be none, otlp or file")
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "tracing.file", "is required for file exporter")
+
+	return errors.Join(errs...)
+}
+
+// Print writes the effective config as YAML, with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	redactSecrets(reflect.ValueOf(&redacted).Elem())
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&redacted); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// redactSecrets replaces fields tagged as secret. Only the password is hidden in URLs, to see where they point
+func redactSecrets(v reflect.Value) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			redactSecrets(v.Field(i))
+			continue
+		}
+
+		if field.Tag.Get("secret") != "true" || field.Type.Kind() != reflect.String || v.Field(i).String() == "" {
+			continue
+		}
+
+		redacted := "REDACTED"
+		if u, err := url.Parse(v.Field(i).String()); err == nil && u.Scheme != "" {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+			for key := range u.Query() {
+				if strings.Contains(key, "password") {
+					q := u.Query()
+					q.Set(key, redacted)
+					u.RawQuery = q.Encode()
+				}
+			}
+			redacted = u.String()
+		}
+
+		v.Field(i).SetString(redacted)
+	}
+}
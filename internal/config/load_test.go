@@ -0,0 +1,349 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets the env vars of the config for the test, so that the environment running it does not interfere
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	var walk func(typ reflect.Type)
+	walk = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+			} else if name := field.Tag.Get("env"); name != "" {
+				t.Setenv(name, "")
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}))
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		body string
+		env  map[string]string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			body: `
+server:
+  max_limit: 500
+  cache_max_age: 2m
+  cors:
+    allowed_origins: ["https://a.example", "https://b.example"]
+grpc:
+  max_limit: 2000
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			body: `
+[server]
+max_limit = 500
+cache_max_age = "2m"
+
+[server.cors]
+allowed_origins = ["https://a.example", "https://b.example"]
+
+[grpc]
+max_limit = 2000
+`,
+		},
+		{
+			name: "env only",
+			env: map[string]string{
+				"MAX_LIMIT":            "500",
+				"CACHE_MAX_AGE":        "2m",
+				"CORS_ALLOWED_ORIGINS": " https://a.example, ,https://b.example ",
+				"GRPC_MAX_LIMIT":       "2000",
+			},
+		},
+		{
+			name: "env overrides file",
+			file: "config.yaml",
+			body: `
+server:
+  max_limit: 10
+  cache_max_age: 1h
+grpc:
+  max_limit: 2000
+`,
+			env: map[string]string{
+				"MAX_LIMIT":            "500",
+				"CACHE_MAX_AGE":        "2m",
+				"CORS_ALLOWED_ORIGINS": "https://a.example,https://b.example",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, val := range tt.env {
+				t.Setenv(name, val)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file, tt.body)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			want := Default()
+			want.Server.MaxLimit = 500
+			want.Server.CacheMaxAge = 2 * time.Minute
+			want.Server.CORS.AllowedOrigins = []string{"https://a.example", "https://b.example"}
+			want.GRPC.MaxLimit = 2000
+
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("Load() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		body string
+		env  map[string]string
+		// Substrings of the error
+		want []string
+	}{
+		{
+			name: "unknown yaml key",
+			file: "config.yaml",
+			body: "server:\n  max_limt: 500\n",
+			want: []string{"config.yaml", "max_limt"},
+		},
+		{
+			name: "unknown toml key",
+			file: "config.toml",
+			body: "[server]\nmax_limt = 500\n",
+			want: []string{"config.toml", "server.max_limt"},
+		},
+		{
+			name: "yaml type",
+			file: "config.yml",
+			body: "server:\n  max_limit: many\n",
+			want: []string{"config.yml", "many"},
+		},
+		{
+			name: "extension",
+			file: "config.json",
+			body: "{}",
+			want: []string{"config.json", ".yaml, .yml or .toml"},
+		},
+		{
+			name: "env integer",
+			env:  map[string]string{"MAX_LIMIT": "many"},
+			want: []string{"server.max_limit (env MAX_LIMIT): must be an integer"},
+		},
+		{
+			name: "env integer size",
+			env:  map[string]string{"DB_MAX_CONNS": "3000000000"},
+			want: []string{"database.max_conns (env DB_MAX_CONNS): must be an integer"},
+		},
+		{
+			name: "env duration",
+			env:  map[string]string{"CORS_MAX_AGE": "10"},
+			want: []string{"server.cors.max_age (env CORS_MAX_AGE): must be a duration"},
+		},
+		{
+			name: "env boolean",
+			env:  map[string]string{"DEBUG_MODE": "maybe"},
+			want: []string{"server.debug_mode (env DEBUG_MODE): must be a boolean"},
+		},
+		{
+			name: "all invalid values",
+			file: "config.yaml",
+			body: `
+server:
+  max_limit: 0
+  rate_limit:
+    trusted_proxies: [10.0.0.0/8, proxy]
+log:
+  format: xml
+`,
+			want: []string{
+				"server.max_limit: must be positive",
+				`server.rate_limit.trusted_proxies: "proxy" is not an address or CIDR`,
+				"log.format: must be json or text",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, val := range tt.env {
+				t.Setenv(name, val)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file, tt.body)
+			}
+
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	var v struct {
+		S  string
+		B  bool
+		I  int
+		I3 int32
+		D  time.Duration
+		L  []string
+		F  float64
+	}
+
+	tests := []struct {
+		field   string
+		s       string
+		want    any
+		wantErr bool
+	}{
+		{field: "S", s: "text", want: "text"},
+		{field: "B", s: "Yes", want: true},
+		{field: "B", s: "off", want: false},
+		{field: "B", s: "1", want: true},
+		{field: "B", s: "y", wantErr: true},
+		{field: "I", s: "-5", want: -5},
+		{field: "I", s: "5.0", wantErr: true},
+		{field: "I3", s: "2147483648", wantErr: true},
+		{field: "D", s: "1m30s", want: 90 * time.Second},
+		{field: "D", s: "90", wantErr: true},
+		{field: "L", s: "a, b,,c", want: []string{"a", "b", "c"}},
+		{field: "F", s: "1.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field+"="+tt.s, func(t *testing.T) {
+			field := reflect.ValueOf(&v).Elem().FieldByName(tt.field)
+
+			err := setValue(field, tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("setValue(%q) error = nil, set %v", tt.s, field.Interface())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("setValue(%q) error = %v", tt.s, err)
+			}
+
+			if got := field.Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setValue(%q) set %#v, want %#v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "empty", url: "", want: ""},
+		{
+			name: "password in URL",
+			url:  "postgres://books:secret@db:5432/books?sslmode=disable",
+			want: "postgres://books:REDACTED@db:5432/books?sslmode=disable",
+		},
+		{
+			name: "user without password",
+			url:  "postgres://books@db/books",
+			want: "postgres://books@db/books",
+		},
+		{
+			name: "password in query",
+			url:  "postgres://db/books?password=secret&user=books",
+			want: "postgres://db/books?password=REDACTED&user=books",
+		},
+		{
+			name: "keyword DSN",
+			url:  "host=db user=books password=secret",
+			want: "REDACTED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Database.URL = tt.url
+
+			redactSecrets(reflect.ValueOf(cfg).Elem())
+
+			if cfg.Database.URL != tt.want {
+				t.Errorf("redacted URL = %q, want %q", cfg.Database.URL, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://books:secret@db/books"
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("Print() shows the password:\n%s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), "url: postgres://books:REDACTED@db/books") {
+		t.Errorf("Print() does not show the redacted URL:\n%s", buf.String())
+	}
+
+	if cfg.Database.URL != "postgres://books:secret@db/books" {
+		t.Errorf("Print() changed the config URL to %q", cfg.Database.URL)
+	}
+}
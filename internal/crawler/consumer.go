@@ -7,10 +7,15 @@ import (
 	"slices"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"books/internal/metrics"
+	"books/internal/storage"
 	"books/internal/storage/authors"
 	"books/internal/storage/books"
 	"books/internal/storage/genres"
 	"books/internal/storage/series"
+	"books/internal/tracing"
 	"books/internal/types"
 )
 
@@ -112,27 +117,53 @@ type StoringConsumer struct {
 	Authors authors.Repository
 	Genres  genres.Repository
 	Series  series.Repository
+	// Optional, announces saved entities to caches of the servers
+	Changes storage.Notifier
 }
 
-func (s *StoringConsumer) ConsumeAuthor(author *types.Author) error {
-	a, err := s.Authors.GetById(context.Background(), author.Id)
+// More books of the series are announced as change of all books
+const maxNotifiedSeriesBooks = 1000
+
+func (s *StoringConsumer) ConsumeAuthor(author *types.Author) (err error) {
+	ctx, span := tracing.Start(context.Background(), "crawler.ConsumeAuthor", attribute.String("author_id", author.Id))
+	defer func() { tracing.End(span, err) }()
+
+	a, err := s.Authors.GetById(ctx, author.Id)
 	if err != nil {
 		return fmt.Errorf("checking existing author: %w", err)
 	}
 
+	result := "stored"
 	if a == nil {
 		s.Logger.Info("Storing new author " + author.Id + " (" + author.Name + ")")
-	} else if *a != *author {
+	} else if authorNeedsUpdate(a, author) {
 		s.Logger.Info("Updating existing author " + author.Id + " (" + author.Name + ")")
+		result = "updated"
 	} else {
 		s.Logger.Debug("Skip unchanged author " + author.Id + " (" + author.Name + ")")
+		metrics.Crawled("author", "skipped", 1)
 		return nil
 	}
 
-	return s.Authors.Save(context.Background(), author)
+	err = s.Authors.Save(ctx, author)
+	if err != nil {
+		return err
+	}
+
+	metrics.Crawled("author", result, 1)
+	s.notify(ctx, storage.Change{Entity: storage.EntityAuthor, Ids: []string{author.Id}})
+
+	return nil
+}
+
+func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id string) (*types.Author, error)) (err error) {
+	ctx, span := tracing.Start(context.Background(), "crawler.ConsumeBooks", attribute.Int("books", len(books)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.consumeBooks(ctx, books, fetchAuthor)
 }
 
-func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id string) (*types.Author, error)) error {
+func (s *StoringConsumer) consumeBooks(ctx context.Context, books []*types.Book, fetchAuthor FetchAuthor) error {
 	uniqAuthorIds := make(map[string]struct{})
 	uniqGenreTitles := make(map[string]struct{})
 
@@ -150,11 +181,12 @@ func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id
 		authorIds = append(authorIds, authorId)
 	}
 
-	as, err := s.Authors.GetByIds(context.Background(), authorIds...)
+	as, err := s.Authors.GetByIds(ctx, authorIds...)
 	if err != nil {
 		return fmt.Errorf("checking existing authors: %w", err)
 	}
 
+	var newAuthorIds []string
 	for _, authorId := range authorIds {
 		if _, ok := as[authorId]; ok {
 			continue
@@ -165,9 +197,16 @@ func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id
 			return fmt.Errorf("fetching new author: %w", err)
 		}
 
-		if err := s.Authors.Save(context.Background(), a); err != nil {
+		if err := s.Authors.Save(ctx, a); err != nil {
 			return fmt.Errorf("saving new author: %w", err)
 		}
+
+		newAuthorIds = append(newAuthorIds, authorId)
+	}
+
+	if len(newAuthorIds) > 0 {
+		metrics.Crawled("author", "stored", len(newAuthorIds))
+		s.notify(ctx, storage.Change{Entity: storage.EntityAuthor, Ids: newAuthorIds})
 	}
 
 	var genreTitles []string
@@ -175,7 +214,7 @@ func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id
 		genreTitles = append(genreTitles, genreTitle)
 	}
 
-	gs, err := s.Genres.GetIdByTitles(context.Background(), genreTitles...)
+	gs, err := s.Genres.GetIdByTitles(ctx, genreTitles...)
 	if err != nil {
 		return fmt.Errorf("finding existing genres: %w", err)
 	}
@@ -189,7 +228,7 @@ func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id
 	}
 	genreTitles = genreTitles[:numNewGenres]
 
-	newGenres, err := s.Genres.Insert(context.Background(), genreTitles...)
+	newGenres, err := s.Genres.Insert(ctx, genreTitles...)
 	if err != nil {
 		return fmt.Errorf("inserting new genres: %w", err)
 	}
@@ -198,38 +237,54 @@ func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id
 		gs[genreTitle] = genreId
 	}
 
+	if len(newGenres) > 0 {
+		s.notify(ctx, storage.Change{Entity: storage.EntityGenre})
+	}
+
 	bookIds := make([]string, 0, len(books))
 	for _, book := range books {
 		bookIds = append(bookIds, book.Id)
 	}
 
-	existBooks, err := s.Books.GetByIds(context.Background(), bookIds...)
+	existBooks, err := s.Books.GetByIds(ctx, bookIds...)
 	if err != nil {
 		return fmt.Errorf("checking existing books: %w", err)
 	}
 
 	saveBooks := make([]*types.Book, 0, len(books))
+	// Linking touches the authors, both former and current ones
+	changedAuthorIds := make(map[string]struct{})
+	var numStored, numUpdated, numSkipped int
 	for _, book := range books {
 		exBook, ok := existBooks[book.Id]
 		if !ok {
 			s.Logger.Info("Storing new book " + book.Id + " (" + book.Title + ")")
+			numStored++
 		} else if bookNeedsUpdate(exBook, book) {
 			s.Logger.Info("Updating existing book " + book.Id + " (" + book.Title + ")")
+			numUpdated++
+			for _, authorId := range exBook.Authors {
+				changedAuthorIds[authorId] = struct{}{}
+			}
 		} else {
 			s.Logger.Debug("Skip unchanged book " + book.Id + " (" + book.Title + ")")
+			numSkipped++
 			continue
 		}
 
 		saveBooks = append(saveBooks, book)
+		for _, authorId := range book.Authors {
+			changedAuthorIds[authorId] = struct{}{}
+		}
 	}
 
-	err = s.Books.Save(context.Background(), saveBooks...)
+	err = s.Books.Save(ctx, saveBooks...)
 	if err != nil {
 		return fmt.Errorf("saving books: %w", err)
 	}
 
 	for _, book := range saveBooks {
-		err := s.Books.LinkBookAndAuthors(context.Background(), book.Id, book.Authors...)
+		err := s.Books.LinkBookAndAuthors(ctx, book.Id, book.Authors...)
 		if err != nil {
 			return fmt.Errorf("linking book and authors: %w", err)
 		}
@@ -244,33 +299,70 @@ func (s *StoringConsumer) ConsumeBooks(books []*types.Book, fetchAuthor func(id
 			bookGenres = append(bookGenres, genreId)
 		}
 
-		err = s.Books.LinkBookAndGenres(context.Background(), book.Id, bookGenres...)
+		err = s.Books.LinkBookAndGenres(ctx, book.Id, bookGenres...)
 		if err != nil {
 			return fmt.Errorf("linking book and genres: %w", err)
 		}
+
+		err = s.Books.LinkBookAndFiles(ctx, book.Id, book.Files...)
+		if err != nil {
+			return fmt.Errorf("linking book and files: %w", err)
+		}
+	}
+
+	metrics.Crawled("book", "stored", numStored)
+	metrics.Crawled("book", "updated", numUpdated)
+	metrics.Crawled("book", "skipped", numSkipped)
+
+	if len(saveBooks) > 0 {
+		savedIds := make([]string, 0, len(saveBooks))
+		for _, book := range saveBooks {
+			savedIds = append(savedIds, book.Id)
+		}
+
+		changes := []storage.Change{{Entity: storage.EntityBook, Ids: savedIds}}
+
+		if len(changedAuthorIds) > 0 {
+			changedAuthors := make([]string, 0, len(changedAuthorIds))
+			for authorId := range changedAuthorIds {
+				changedAuthors = append(changedAuthors, authorId)
+			}
+
+			changes = append(changes, storage.Change{Entity: storage.EntityAuthor, Ids: changedAuthors})
+		}
+
+		s.notify(ctx, changes...)
 	}
 
 	return nil
 }
 
-func (s *StoringConsumer) ConsumeSeries(series *types.Series, bks []*types.Book, fetchAuthor FetchAuthor) error {
-	ex, err := s.Series.GetById(context.Background(), series.Id)
+func (s *StoringConsumer) ConsumeSeries(series *types.Series, bks []*types.Book, fetchAuthor FetchAuthor) (err error) {
+	ctx, span := tracing.Start(context.Background(), "crawler.ConsumeSeries", attribute.String("series_id", series.Id))
+	defer func() { tracing.End(span, err) }()
+
+	ex, err := s.Series.GetById(ctx, series.Id)
 	if err != nil {
 		return fmt.Errorf("checking existing series: %w", err)
 	}
 
+	result := "skipped"
 	if ex == nil {
 		s.Logger.Info("Storing new series " + series.Id + " (" + series.Title + ")")
-		err = s.Series.Save(context.Background(), series)
-	} else if *ex != *series {
+		result = "stored"
+		err = s.Series.Save(ctx, series)
+	} else if seriesNeedsUpdate(ex, series) {
 		s.Logger.Info("Updating existing series " + series.Id + " (" + series.Title + ")")
-		err = s.Series.Save(context.Background(), series)
+		result = "updated"
+		err = s.Series.Save(ctx, series)
 	}
 	if err != nil {
 		return fmt.Errorf("saving series: %w", err)
 	}
 
-	err = s.ConsumeBooks(bks, fetchAuthor)
+	metrics.Crawled("series", result, 1)
+
+	err = s.consumeBooks(ctx, bks, fetchAuthor)
 	if err != nil {
 		return err
 	}
@@ -280,16 +372,72 @@ func (s *StoringConsumer) ConsumeSeries(series *types.Series, bks []*types.Book,
 		bookIds = append(bookIds, b.Id)
 	}
 
+	// Books unlinked from the series change too
+	var changedBooks *storage.Change
+	if s.Changes != nil {
+		changedBooks, err = s.seriesBooksChange(ctx, series.Id, bookIds)
+		if err != nil {
+			return err
+		}
+	}
+
 	s.Logger.Debug("Link books with series " + series.Id + " (" + series.Title + ")")
 
-	err = s.Books.LinkSeriesWithBooks(context.Background(), series.Id, bookIds...)
+	err = s.Books.LinkSeriesWithBooks(ctx, series.Id, bookIds...)
 	if err != nil {
 		return fmt.Errorf("linking series with books: %w", err)
 	}
 
+	if changedBooks != nil {
+		s.notify(ctx, storage.Change{Entity: storage.EntitySeries, Ids: []string{series.Id}}, *changedBooks)
+	}
+
 	return nil
 }
 
+// seriesBooksChange lists the books linked with the series, currently and after linking with bookIds
+func (s *StoringConsumer) seriesBooksChange(ctx context.Context, seriesId string, bookIds []string) (*storage.Change, error) {
+	rows, next, err := s.Books.Search(ctx, books.Filter{SeriesIds: []string{seriesId}},
+		books.SortSeriesOrder, books.Page{Limit: maxNotifiedSeriesBooks})
+	if err != nil {
+		return nil, fmt.Errorf("checking linked books: %w", err)
+	}
+
+	if next != "" || len(rows)+len(bookIds) > maxNotifiedSeriesBooks {
+		return &storage.Change{Entity: storage.EntityBook}, nil
+	}
+
+	ids := slices.Clone(bookIds)
+	for _, row := range rows {
+		if !slices.Contains(bookIds, row.Book.Id) {
+			ids = append(ids, row.Book.Id)
+		}
+	}
+
+	return &storage.Change{Entity: storage.EntityBook, Ids: ids}, nil
+}
+
+// notify only logs failures, the entities are stored anyway and caches expire by themselves
+func (s *StoringConsumer) notify(ctx context.Context, changes ...storage.Change) {
+	if s.Changes == nil {
+		return
+	}
+
+	if err := s.Changes.Notify(ctx, changes...); err != nil {
+		s.Logger.Error("notifying changes: " + err.Error())
+	}
+}
+
+func authorNeedsUpdate(author *types.Author, new *types.Author) bool {
+	return author.Name != new.Name ||
+		author.Bio != new.Bio ||
+		author.Avatar != new.Avatar
+}
+
+func seriesNeedsUpdate(series *types.Series, new *types.Series) bool {
+	return series.Title != new.Title
+}
+
 func bookNeedsUpdate(book *types.Book, new *types.Book) bool {
 	return book.Title != new.Title ||
 		!slices.Equal(book.Authors, new.Authors) ||
@@ -297,5 +445,6 @@ func bookNeedsUpdate(book *types.Book, new *types.Book) bool {
 		book.Language != new.Language ||
 		book.Year != new.Year ||
 		book.About != new.About ||
-		book.Cover != new.Cover
+		book.Cover != new.Cover ||
+		!slices.Equal(book.Files, new.Files)
 }
@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
 	"sort"
 	"strconv"
@@ -17,13 +18,17 @@ import (
 	"unicode/utf8"
 
 	"github.com/opds-community/libopds2-go/opds1"
+	"go.opentelemetry.io/otel/attribute"
 
+	"books/internal/metrics"
+	"books/internal/tracing"
 	"books/internal/types"
 )
 
 const (
 	linkTypeCatalog = "application/atom+xml;profile=opds-catalog"
 	linkRelImage    = "http://opds-spec.org/image"
+	linkRelAcquire  = "http://opds-spec.org/acquisition"
 	linkRelNext     = "next"
 
 	authorIdTemplate   = "tag:author:%v"
@@ -46,6 +51,20 @@ var (
 	regHrefSequence  = regexp.MustCompile("^/opds/sequencebooks/\\d+$")
 
 	regTitleAuthorBooks = regexp.MustCompile("^Книги автора\\s+(.+)$")
+
+	// Known acquisition link types, anything else is named after the last segment of the link path
+	fileFormats = map[string]string{
+		"application/fb2+zip":            "fb2",
+		"application/fb2":                "fb2",
+		"application/x-fictionbook+xml":  "fb2",
+		"application/epub+zip":           "epub",
+		"application/x-mobipocket-ebook": "mobi",
+		"application/pdf":                "pdf",
+		"image/vnd.djvu":                 "djvu",
+		"application/rtf":                "rtf",
+		"text/plain":                     "txt",
+		"text/html":                      "html",
+	}
 )
 
 type Crawler interface {
@@ -79,6 +98,7 @@ func consumeError(err error, feed types.ResumableFeed, handler ErrorHandler, l *
 			l.Error(fmt.Sprintf("Failed to handle error while parsing %s %s: %v", strTyp, feed.Url, err))
 			return &handlerError{hErr}
 		} else {
+			metrics.Failed(strTyp)
 			l.Error(fmt.Sprintf("Ignore error while parsing %s %s: %v", strTyp, feed.Url, err))
 		}
 	}
@@ -918,6 +938,8 @@ func parseBook(entry *opds1.Entry, feedUrl *url.URL, l *slog.Logger) *types.Book
 		cs = cover.String()
 	}
 
+	files := parseFiles(entry, feedUrl, l)
+
 	return &types.Book{
 		Id:       entry.ID,
 		Title:    strings.TrimSpace(entry.Title),
@@ -927,7 +949,59 @@ func parseBook(entry *opds1.Entry, feedUrl *url.URL, l *slog.Logger) *types.Book
 		Year:     year,
 		About:    entry.Content.Content,
 		Cover:    cs,
+		Files:    files,
+	}
+}
+
+func parseFiles(entry *opds1.Entry, feedUrl *url.URL, l *slog.Logger) []types.BookFile {
+	files := make([]types.BookFile, 0, len(entry.Links))
+	seenFormats := make(map[string]struct{}, len(entry.Links))
+
+	for _, link := range entry.Links {
+		rel := strings.TrimSpace(link.Rel)
+		if rel != linkRelAcquire && !strings.HasPrefix(rel, linkRelAcquire+"/") {
+			continue
+		}
+
+		typ := strings.TrimSpace(link.TypeLink)
+		if ix := strings.IndexByte(typ, ';'); ix >= 0 {
+			typ = strings.TrimSpace(typ[:ix])
+		}
+
+		fileUrl, err := url.Parse(strings.TrimSpace(link.Href))
+		if err != nil {
+			l.Error("Failed to parse file link " + entry.ID + ": " + err.Error())
+			continue
+		}
+
+		format, ok := fileFormats[strings.ToLower(typ)]
+		if !ok {
+			format = strings.ToLower(path.Base(fileUrl.Path))
+			if format == "" || format == "/" || format == "." {
+				l.Warn("Failed to guess format of file link " + entry.ID + ": " + link.Href)
+				continue
+			}
+		}
+
+		if _, ok := seenFormats[format]; ok {
+			l.Debug("Skip duplicate file format " + format + " of book " + entry.ID)
+			continue
+		}
+
+		seenFormats[format] = struct{}{}
+
+		files = append(files, types.BookFile{
+			Format: format,
+			Type:   typ,
+			Url:    feedUrl.ResolveReference(fileUrl).String(),
+		})
 	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Format < files[j].Format
+	})
+
+	return files
 }
 
 // Inspect each rune for being a disallowed character.
@@ -970,9 +1044,13 @@ func isInCharacterRange(r rune) (inrange bool) {
 		r >= 0x10000 && r <= 0x10FFFF
 }
 
-func fetchAndUnmarshal(url *url.URL, v any, resourceType string, h *http.Client, l *slog.Logger) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func fetchAndUnmarshal(url *url.URL, v any, resourceType string, h *http.Client, l *slog.Logger) (err error) {
+	ctx, span := tracing.Start(context.Background(), "crawler.fetch",
+		attribute.String("feed", resourceType), attribute.String("url", url.String()))
+	defer func() { tracing.End(span, err) }()
+
+	// Timeout is set on the client
+	start := time.Now()
 
 	res, err := h.Do((&http.Request{
 		Method: http.MethodGet,
@@ -980,6 +1058,7 @@ func fetchAndUnmarshal(url *url.URL, v any, resourceType string, h *http.Client,
 	}).WithContext(ctx))
 
 	if err != nil {
+		metrics.Fetched(resourceType, 0, 0, err)
 		l.Error("Failed to fetch " + resourceType + " " + url.Path + ": " + err.Error())
 		return fmt.Errorf("fetching "+resourceType+": %w", err)
 	}
@@ -990,6 +1069,8 @@ func fetchAndUnmarshal(url *url.URL, v any, resourceType string, h *http.Client,
 		bs, err = io.ReadAll(res.Body)
 	}()
 
+	metrics.Fetched(resourceType, time.Since(start), len(bs), err)
+
 	if err != nil {
 		l.Error("Failed to read body of " + resourceType + " " + url.Path + ": " + err.Error())
 		return fmt.Errorf("fetching "+resourceType+" (reading response): %w", err)
@@ -0,0 +1,640 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"books/internal/pb"
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/genres"
+	"books/internal/storage/series"
+	"books/internal/types"
+)
+
+const (
+	defaultLimit = 20
+	// Page size used to read the repositories while streaming exports
+	exportBatch = 500
+)
+
+var bookSorts = map[pb.BookSort]books.SortType{
+	pb.BookSort_BOOK_SORT_UNSPECIFIED:   "",
+	pb.BookSort_BOOK_SORT_TITLE:         books.SortTitle,
+	pb.BookSort_BOOK_SORT_YEAR:          books.SortYear,
+	pb.BookSort_BOOK_SORT_YEAR_DESC:     books.SortYearDesc,
+	pb.BookSort_BOOK_SORT_AUTHOR:        books.SortAuthor,
+	pb.BookSort_BOOK_SORT_SERIES_ORDER:  books.SortSeriesOrder,
+	pb.BookSort_BOOK_SORT_ADDED_AT:      books.SortAddedAt,
+	pb.BookSort_BOOK_SORT_ADDED_AT_DESC: books.SortAddedAtDesc,
+	pb.BookSort_BOOK_SORT_RELEVANCE:     books.SortRelevance,
+}
+
+// Register adds the catalog services to the server. Limits of the requests and numbers of the requested ids
+// are capped by maxLimit
+func Register(s grpc.ServiceRegistrar, ar authors.Repository, br books.Repository, gr genres.Repository,
+	sr series.Repository, maxLimit int, debugMode bool) {
+
+	f := failer{debugMode: debugMode}
+	l := limits{maxLimit: maxLimit}
+
+	pb.RegisterBooksServer(s, &booksServer{failer: f, limits: l, br: br})
+	pb.RegisterAuthorsServer(s, &authorsServer{failer: f, limits: l, ar: ar})
+	pb.RegisterSeriesServiceServer(s, &seriesServer{failer: f, limits: l, sr: sr})
+	pb.RegisterGenresServer(s, &genresServer{failer: f, gr: gr})
+}
+
+// LoggingInterceptor logs the method, its duration and status code of every call
+func LoggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (any, error) {
+
+	start := time.Now()
+	res, err := handler(ctx, req)
+	slog.DebugContext(ctx, "Handled "+info.FullMethod,
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)))
+
+	return res, err
+}
+
+// StreamLoggingInterceptor is LoggingInterceptor for streams
+func StreamLoggingInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+
+	start := time.Now()
+	err := handler(srv, ss)
+	slog.DebugContext(ss.Context(), "Handled "+info.FullMethod,
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)))
+
+	return err
+}
+
+type failer struct {
+	debugMode bool
+}
+
+// fail turns errors caused by the request into InvalidArgument, and logs and hides the rest,
+// the same as response.Responder does
+func (f failer) fail(ctx context.Context, err error) error {
+	if errors.Is(err, books.ErrInvalidCursor) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	errId := uuid.NewString()
+	slog.ErrorContext(ctx, err.Error(), slog.String("err_id", errId))
+
+	if f.debugMode {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return status.Error(codes.Internal, "unknown error occurred while processing your request. Error ID: "+errId)
+}
+
+type limits struct {
+	maxLimit int
+}
+
+func (l limits) getLimit(limit int32) (int, error) {
+	if limit == 0 {
+		return min(defaultLimit, l.maxLimit), nil
+	}
+
+	if limit < 0 || int(limit) > l.maxLimit {
+		return 0, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", l.maxLimit)
+	}
+
+	return int(limit), nil
+}
+
+func (l limits) checkIds(ids []string) error {
+	if len(ids) > l.maxLimit {
+		return status.Errorf(codes.InvalidArgument, "at most %d ids are allowed", l.maxLimit)
+	}
+
+	return nil
+}
+
+func getOffset(offset int32) (int, error) {
+	if offset < 0 {
+		return 0, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+
+	return int(offset), nil
+}
+
+func toGenreId(id uint32) (uint16, error) {
+	if id > 0xffff {
+		return 0, status.Errorf(codes.InvalidArgument, "unknown genre id %d", id)
+	}
+
+	return uint16(id), nil
+}
+
+func toGenreIds(ids []uint32) ([]uint16, error) {
+	ret := make([]uint16, 0, len(ids))
+	for _, id := range ids {
+		genreId, err := toGenreId(id)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, genreId)
+	}
+
+	return ret, nil
+}
+
+func toYear(year uint32) (uint16, error) {
+	if year > 0xffff {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid year %d", year)
+	}
+
+	return uint16(year), nil
+}
+
+func toFilter(f *pb.BookFilter) (books.Filter, error) {
+	if f == nil {
+		return books.Filter{}, nil
+	}
+
+	genreIds, err := toGenreIds(f.GenreIds)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	excludeGenreIds, err := toGenreIds(f.ExcludeGenreIds)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	yearMin, err := toYear(f.YearMin)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	yearMax, err := toYear(f.YearMax)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	return books.Filter{
+		Titles:           f.Titles,
+		ExcludeTitles:    f.ExcludeTitles,
+		AuthorIds:        f.AuthorIds,
+		AllAuthors:       f.AllAuthors,
+		ExcludeAuthorIds: f.ExcludeAuthorIds,
+		GenreIds:         genreIds,
+		ExcludeGenreIds:  excludeGenreIds,
+		SeriesIds:        f.SeriesIds,
+		ExcludeSeriesIds: f.ExcludeSeriesIds,
+		Languages:        f.Languages,
+		ExcludeLanguages: f.ExcludeLanguages,
+		YearMin:          yearMin,
+		YearMax:          yearMax,
+		HasCover:         f.HasCover,
+		HasSeries:        f.HasSeries,
+	}, nil
+}
+
+func toSort(sort pb.BookSort) (books.SortType, error) {
+	ret, ok := bookSorts[sort]
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "unknown sort %v", sort)
+	}
+
+	return ret, nil
+}
+
+func fromBook(b *types.Book) *pb.Book {
+	ret := &pb.Book{
+		Id:        b.Id,
+		Title:     b.Title,
+		AuthorIds: b.Authors,
+		Genres:    b.Genres,
+		Language:  b.Language,
+		Year:      uint32(b.Year),
+		About:     b.About,
+		CoverUrl:  b.Cover,
+		AddedAt:   timestamppb.New(b.AddedAt),
+	}
+
+	for _, s := range b.Series {
+		ret.Series = append(ret.Series, &pb.InSeries{SeriesId: s.Id, Order: uint32(s.Order)})
+	}
+
+	for _, f := range b.Files {
+		ret.Files = append(ret.Files, &pb.BookFile{Format: f.Format, Type: f.Type, Url: f.Url})
+	}
+
+	return ret
+}
+
+func fromAuthor(a *types.Author) *pb.Author {
+	return &pb.Author{Id: a.Id, Name: a.Name, Bio: a.Bio, AvatarUrl: a.Avatar}
+}
+
+func fromSeries(s *types.Series) *pb.Series {
+	return &pb.Series{Id: s.Id, Title: s.Title}
+}
+
+type booksServer struct {
+	pb.UnimplementedBooksServer
+	failer
+	limits
+	br books.Repository
+}
+
+func (s *booksServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.Book, error) {
+	b, err := s.br.GetById(ctx, req.Id)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	if b == nil {
+		return nil, status.Error(codes.NotFound, "book not found")
+	}
+
+	return fromBook(b), nil
+}
+
+func (s *booksServer) BatchGet(ctx context.Context, req *pb.BatchGetRequest) (*pb.BatchGetBooksResponse, error) {
+	if err := s.checkIds(req.Ids); err != nil {
+		return nil, err
+	}
+
+	bs, err := s.br.GetByIds(ctx, req.Ids...)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.BatchGetBooksResponse{Books: make([]*pb.Book, 0, len(req.Ids))}
+	for _, id := range req.Ids {
+		if b, ok := bs[id]; ok {
+			ret.Books = append(ret.Books, fromBook(b))
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *booksServer) Search(ctx context.Context, req *pb.SearchBooksRequest) (*pb.SearchBooksResponse, error) {
+	filter, err := toFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort, err := toSort(req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := s.getLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, next, err := s.br.Search(ctx, filter, sort, books.Page{Limit: limit, Cursor: req.Cursor})
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.SearchBooksResponse{Books: make([]*pb.Book, 0, len(rows)), NextCursor: next}
+	for _, row := range rows {
+		ret.Books = append(ret.Books, fromBook(row.Book))
+	}
+
+	return ret, nil
+}
+
+func (s *booksServer) Export(req *pb.ExportBooksRequest, stream grpc.ServerStreamingServer[pb.Book]) error {
+	ctx := stream.Context()
+
+	filter, err := toFilter(req.Filter)
+	if err != nil {
+		return err
+	}
+
+	sort, err := toSort(req.Sort)
+	if err != nil {
+		return err
+	}
+
+	page := books.Page{Limit: exportBatch}
+
+	for {
+		rows, next, err := s.br.Search(ctx, filter, sort, page)
+		if err != nil {
+			return s.fail(ctx, err)
+		}
+
+		for _, row := range rows {
+			if err := stream.Send(fromBook(row.Book)); err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+
+		page.Cursor = next
+	}
+}
+
+type authorsServer struct {
+	pb.UnimplementedAuthorsServer
+	failer
+	limits
+	ar authors.Repository
+}
+
+func (s *authorsServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.Author, error) {
+	a, err := s.ar.GetById(ctx, req.Id)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	if a == nil {
+		return nil, status.Error(codes.NotFound, "author not found")
+	}
+
+	return fromAuthor(a), nil
+}
+
+func (s *authorsServer) BatchGet(ctx context.Context, req *pb.BatchGetRequest) (*pb.AuthorsResponse, error) {
+	if err := s.checkIds(req.Ids); err != nil {
+		return nil, err
+	}
+
+	as, err := s.ar.GetByIds(ctx, req.Ids...)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.AuthorsResponse{Authors: make([]*pb.Author, 0, len(req.Ids))}
+	for _, id := range req.Ids {
+		if a, ok := as[id]; ok {
+			ret.Authors = append(ret.Authors, fromAuthor(a))
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *authorsServer) Search(ctx context.Context, req *pb.SearchRequest) (*pb.AuthorsResponse, error) {
+	filter, err := toFilter(req.BookFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := s.getLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := getOffset(req.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	as, err := s.ar.Search(ctx, req.Query, filter, limit, offset)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.AuthorsResponse{Authors: make([]*pb.Author, 0, len(as))}
+	for _, a := range as {
+		ret.Authors = append(ret.Authors, fromAuthor(a))
+	}
+
+	return ret, nil
+}
+
+func (s *authorsServer) Export(req *pb.ExportRequest, stream grpc.ServerStreamingServer[pb.Author]) error {
+	ctx := stream.Context()
+
+	filter, err := toFilter(req.BookFilter)
+	if err != nil {
+		return err
+	}
+
+	// Pages are keyed by id rather than offset, so they neither slow down nor skip rows on changes
+	afterId := ""
+	for {
+		as, err := s.ar.SearchAfter(ctx, req.Query, filter, afterId, exportBatch)
+		if err != nil {
+			return s.fail(ctx, err)
+		}
+
+		for _, a := range as {
+			if err := stream.Send(fromAuthor(a)); err != nil {
+				return err
+			}
+		}
+
+		if len(as) < exportBatch {
+			return nil
+		}
+
+		afterId = as[len(as)-1].Id
+	}
+}
+
+type seriesServer struct {
+	pb.UnimplementedSeriesServiceServer
+	failer
+	limits
+	sr series.Repository
+}
+
+func (s *seriesServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.Series, error) {
+	ser, err := s.sr.GetById(ctx, req.Id)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	if ser == nil {
+		return nil, status.Error(codes.NotFound, "series not found")
+	}
+
+	return fromSeries(ser), nil
+}
+
+func (s *seriesServer) BatchGet(ctx context.Context, req *pb.BatchGetRequest) (*pb.SeriesResponse, error) {
+	if err := s.checkIds(req.Ids); err != nil {
+		return nil, err
+	}
+
+	ss, err := s.sr.GetByIds(ctx, req.Ids...)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.SeriesResponse{Series: make([]*pb.Series, 0, len(req.Ids))}
+	for _, id := range req.Ids {
+		if ser, ok := ss[id]; ok {
+			ret.Series = append(ret.Series, fromSeries(ser))
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *seriesServer) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SeriesResponse, error) {
+	filter, err := toFilter(req.BookFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := s.getLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := getOffset(req.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	ss, err := s.sr.Search(ctx, req.Query, filter, limit, offset)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.SeriesResponse{Series: make([]*pb.Series, 0, len(ss))}
+	for _, ser := range ss {
+		ret.Series = append(ret.Series, fromSeries(ser))
+	}
+
+	return ret, nil
+}
+
+func (s *seriesServer) Export(req *pb.ExportRequest, stream grpc.ServerStreamingServer[pb.Series]) error {
+	ctx := stream.Context()
+
+	filter, err := toFilter(req.BookFilter)
+	if err != nil {
+		return err
+	}
+
+	// Pages are keyed by id rather than offset, so they neither slow down nor skip rows on changes
+	afterId := ""
+	for {
+		ss, err := s.sr.SearchAfter(ctx, req.Query, filter, afterId, exportBatch)
+		if err != nil {
+			return s.fail(ctx, err)
+		}
+
+		for _, ser := range ss {
+			if err := stream.Send(fromSeries(ser)); err != nil {
+				return err
+			}
+		}
+
+		if len(ss) < exportBatch {
+			return nil
+		}
+
+		afterId = ss[len(ss)-1].Id
+	}
+}
+
+type genresServer struct {
+	pb.UnimplementedGenresServer
+	failer
+	gr genres.Repository
+}
+
+func (s *genresServer) Get(ctx context.Context, req *pb.GetGenreRequest) (*pb.Genre, error) {
+	id, err := toGenreId(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "genre not found")
+	}
+
+	title, err := s.gr.GetById(ctx, id)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	if title == "" {
+		return nil, status.Error(codes.NotFound, "genre not found")
+	}
+
+	return &pb.Genre{Id: req.Id, Title: title}, nil
+}
+
+func (s *genresServer) BatchGet(ctx context.Context, req *pb.BatchGetGenresRequest) (*pb.GenresResponse, error) {
+	ids := make([]uint16, 0, len(req.Ids))
+	for _, id := range req.Ids {
+		// Such ids can not exist, so are skipped like any other unknown id
+		if genreId, err := toGenreId(id); err == nil {
+			ids = append(ids, genreId)
+		}
+	}
+
+	gs, err := s.gr.GetByIds(ctx, ids...)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	ret := &pb.GenresResponse{Genres: make([]*pb.Genre, 0, len(ids))}
+	for _, id := range ids {
+		if title, ok := gs[id]; ok {
+			ret.Genres = append(ret.Genres, &pb.Genre{Id: uint32(id), Title: title})
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *genresServer) Search(ctx context.Context, req *pb.SearchGenresRequest) (*pb.GenresResponse, error) {
+	titles := req.Titles
+	if len(titles) == 0 {
+		var err error
+		titles, err = s.gr.GetAll(ctx)
+		if err != nil {
+			return nil, s.fail(ctx, err)
+		}
+	}
+
+	gs, err := s.gr.GetIdByTitles(ctx, titles...)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	type genre struct {
+		id    uint16
+		title string
+	}
+
+	lower := make(map[string]genre, len(gs))
+	for title, id := range gs {
+		lower[strings.ToLower(title)] = genre{id: id, title: title}
+	}
+
+	ret := &pb.GenresResponse{Genres: make([]*pb.Genre, 0, len(titles))}
+	for _, title := range titles {
+		if g, ok := lower[strings.ToLower(title)]; ok {
+			ret.Genres = append(ret.Genres, &pb.Genre{Id: uint32(g.id), Title: g.title})
+		}
+	}
+
+	return ret, nil
+}
+
+// Verify the servers implement all the methods
+var (
+	_ pb.BooksServer         = (*booksServer)(nil)
+	_ pb.AuthorsServer       = (*authorsServer)(nil)
+	_ pb.SeriesServiceServer = (*seriesServer)(nil)
+	_ pb.GenresServer        = (*genresServer)(nil)
+)
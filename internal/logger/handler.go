@@ -7,29 +7,19 @@ import (
 	"os"
 	"runtime"
 	"strings"
-)
-
-func getEnvOrDefault(key, default_ string) string {
-	if val := os.Getenv(key); val != "" {
-		return val
-	}
 
-	return default_
-}
-
-var (
-	logFormat = getEnvOrDefault("LOG_FORMAT", "text")
+	"go.opentelemetry.io/otel/trace"
 )
 
-// SetupSLog configures logging handler with format depending on environment var LOG_FORMAT
-// and which strips common prefix from file paths (rootPath param)
-func SetupSLog(lvl slog.Level, rootPath string, requestIdKey any) {
+// SetupSLog configures logging handler with the format (json or text), levels by component
+// and sampling (see ValidateSampling), and which strips common prefix from file paths (rootPath param)
+func SetupSLog(levels Levels, format, sampling string, rootPath string, requestIdKey any) {
 	ho := slog.HandlerOptions{
-		Level: lvl,
+		Level: levels.min(),
 	}
 
 	var h slog.Handler
-	switch logFormat {
+	switch format {
 	case "json":
 		h = slog.NewJSONHandler(os.Stderr, &ho)
 		break
@@ -41,6 +31,15 @@ func SetupSLog(lvl slog.Level, rootPath string, requestIdKey any) {
 		os.Exit(1)
 	}
 
+	smp, err := parseSampling(sampling)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if smp != nil {
+		go smp.run(h)
+	}
+
 	gopath := os.Getenv("GOPATH")
 	if gopath == "" {
 		gopath = build.Default.GOPATH
@@ -51,6 +50,8 @@ func SetupSLog(lvl slog.Level, rootPath string, requestIdKey any) {
 		rootPath:     strings.TrimSuffix(rootPath, "/") + "/",
 		goPath:       strings.TrimSuffix(gopath, "/") + "/",
 		requestIdKey: requestIdKey,
+		levels:       levels,
+		sampler:      smp,
 	}))
 }
 
@@ -59,6 +60,11 @@ type handler struct {
 	rootPath     string
 	goPath       string
 	requestIdKey any
+	levels       Levels
+	// Set by WithAttrs with ComponentKey
+	component string
+	// Nil if disabled
+	sampler *sampler
 }
 
 func (e *handler) Enabled(ctx context.Context, level slog.Level) bool {
@@ -66,10 +72,30 @@ func (e *handler) Enabled(ctx context.Context, level slog.Level) bool {
 }
 
 func (e *handler) Handle(ctx context.Context, record slog.Record) error {
-	record = record.Clone()
-
 	fs := runtime.CallersFrames([]uintptr{record.PC})
 	f, _ := fs.Next()
+
+	component := e.component
+	record.Attrs(func(a slog.Attr) bool {
+		if a.Key == ComponentKey {
+			component = a.Value.String()
+			return false
+		}
+		return true
+	})
+	if component == "" {
+		component = componentOf(f.Function)
+	}
+
+	if record.Level < e.levels.For(component) {
+		return nil
+	}
+
+	if e.sampler != nil && !e.sampler.allow(&record) {
+		return nil
+	}
+
+	record = record.Clone()
 	file := f.File
 	if strings.HasPrefix(file, e.rootPath) {
 		file = file[len(e.rootPath):]
@@ -86,19 +112,40 @@ func (e *handler) Handle(ctx context.Context, record slog.Record) error {
 		record.AddAttrs(slog.Any("request_id", requestId))
 	}
 
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+
 	return e.baseHandler.Handle(ctx, record)
 }
 
 func (e *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := e.component
+	for _, a := range attrs {
+		if a.Key == ComponentKey {
+			component = a.Value.String()
+		}
+	}
+
 	return &handler{
-		baseHandler: e.baseHandler.WithAttrs(attrs),
-		rootPath:    e.rootPath,
+		baseHandler:  e.baseHandler.WithAttrs(attrs),
+		rootPath:     e.rootPath,
+		goPath:       e.goPath,
+		requestIdKey: e.requestIdKey,
+		levels:       e.levels,
+		component:    component,
+		sampler:      e.sampler,
 	}
 }
 
 func (e *handler) WithGroup(name string) slog.Handler {
 	return &handler{
-		baseHandler: e.baseHandler.WithGroup(name),
-		rootPath:    e.rootPath,
+		baseHandler:  e.baseHandler.WithGroup(name),
+		rootPath:     e.rootPath,
+		goPath:       e.goPath,
+		requestIdKey: e.requestIdKey,
+		levels:       e.levels,
+		component:    e.component,
+		sampler:      e.sampler,
 	}
 }
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ComponentKey is the attribute overriding component of the record, otherwise it is the package
+// of the logging function, like crawler or server
+const ComponentKey = "component"
+
+// Levels is the minimum level of records by component
+type Levels struct {
+	Default    slog.Level
+	Components map[string]slog.Level
+}
+
+// ParseLevels parses comma-separated levels like info,crawler=debug,pgx=warn.
+// The one without component is the default, debug if omitted
+func ParseLevels(s string) (Levels, error) {
+	ret := Levels{Default: slog.LevelDebug, Components: make(map[string]slog.Level)}
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		component, level, found := strings.Cut(item, "=")
+		if !found {
+			component, level = "", item
+		}
+
+		var lvl slog.Level
+		if err := lvl.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+			return Levels{Default: slog.LevelDebug}, fmt.Errorf("invalid level of %q, one of debug, info, warn or error expected", item)
+		}
+
+		if component = strings.TrimSpace(component); component == "" {
+			ret.Default = lvl
+		} else {
+			ret.Components[component] = lvl
+		}
+	}
+
+	return ret, nil
+}
+
+func (l Levels) For(component string) slog.Level {
+	if lvl, ok := l.Components[component]; ok {
+		return lvl
+	}
+
+	return l.Default
+}
+
+// min is the level passing records of every component
+func (l Levels) min() slog.Level {
+	ret := l.Default
+	for _, lvl := range l.Components {
+		ret = min(ret, lvl)
+	}
+
+	return ret
+}
+
+// componentOf tells the package of the function, like crawler for books/internal/crawler.(*Flibusta).Crawl.
+// Major version suffixes are dropped, so pgx/v5 is pgx
+func componentOf(function string) string {
+	pkg := function
+	if slash := strings.LastIndexByte(pkg, '/'); slash >= 0 {
+		if dot := strings.IndexByte(pkg[slash:], '.'); dot >= 0 {
+			pkg = pkg[:slash+dot]
+		}
+	} else if dot := strings.IndexByte(pkg, '.'); dot >= 0 {
+		pkg = pkg[:dot]
+	}
+
+	parts := strings.Split(pkg, "/")
+	last := parts[len(parts)-1]
+	if len(parts) > 1 && len(last) > 1 && last[0] == 'v' && strings.Trim(last[1:], "0123456789") == "" {
+		last = parts[len(parts)-2]
+	}
+
+	return last
+}
@@ -5,17 +5,141 @@ import (
 	"log/slog"
 	"runtime"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/tracelog"
 )
 
-func NewPGXTracer() *tracelog.TraceLog {
+// How long EXPLAIN ANALYZE of slow query may take, it runs the query once more
+const explainTimeout = 30 * time.Second
+
+// PGXTracer logs pgx events, and slow queries with warn level
+type PGXTracer struct {
+	*tracelog.TraceLog
+
+	slow    time.Duration
+	explain bool
+	// Only one EXPLAIN at a time, so slow queries under load do not get even slower
+	explaining atomic.Bool
+}
+
+type slowQueryKey struct{}
+
+type queryStart struct {
+	at   time.Time
+	sql  string
+	args []any
+}
+
+// NewPGXTracer logs queries running longer than slow (zero disables) with warn level,
+// and with explain also their EXPLAIN (ANALYZE, BUFFERS) if they are selects, running them once more
+func NewPGXTracer(slow time.Duration, explain bool) *PGXTracer {
+	return &PGXTracer{
+		TraceLog: newTraceLog(),
+		slow:     slow,
+		explain:  explain,
+	}
+}
+
+func (t *PGXTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.slow > 0 {
+		ctx = context.WithValue(ctx, slowQueryKey{}, &queryStart{at: time.Now(), sql: data.SQL, args: data.Args})
+	}
+
+	return t.TraceLog.TraceQueryStart(ctx, conn, data)
+}
+
+func (t *PGXTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.TraceLog.TraceQueryEnd(ctx, conn, data)
+
+	start, ok := ctx.Value(slowQueryKey{}).(*queryStart)
+	if !ok {
+		return
+	}
+
+	elapsed := time.Since(start.at)
+	if elapsed < t.slow {
+		return
+	}
+
+	logQuery(ctx, "Slow query", start.sql, slog.Any("args", start.args), slog.Duration("elapsed", elapsed))
+
+	if t.explain && isSelect(start.sql) && t.explaining.CompareAndSwap(false, true) {
+		go func() {
+			defer t.explaining.Store(false)
+			t.explainQuery(context.WithoutCancel(ctx), conn.Config(), start)
+		}()
+	}
+}
+
+// explainQuery runs EXPLAIN ANALYZE in read-only transaction on separate untraced connection
+func (t *PGXTracer) explainQuery(ctx context.Context, cfg *pgx.ConnConfig, start *queryStart) {
+	ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+	defer cancel()
+
+	plan, err := func() (string, error) {
+		cfg = cfg.Copy()
+		cfg.Tracer = nil
+
+		conn, err := pgx.ConnectConfig(ctx, cfg)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close(context.Background())
+
+		tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+		if err != nil {
+			return "", err
+		}
+		defer tx.Rollback(context.Background())
+
+		rows, err := tx.Query(ctx, "explain (analyze, buffers) "+start.sql, start.args...)
+		if err != nil {
+			return "", err
+		}
+
+		lines, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return "", err
+		}
+
+		return strings.Join(lines, "\n"), nil
+	}()
+
+	if err != nil {
+		logQuery(ctx, "Failed to explain slow query: "+err.Error(), start.sql)
+		return
+	}
+
+	logQuery(ctx, "Slow query plan", start.sql, slog.String("plan", plan))
+}
+
+func isSelect(sql string) bool {
+	sql = strings.ToLower(strings.TrimSpace(sql))
+	return strings.HasPrefix(sql, "select") || strings.HasPrefix(sql, "with")
+}
+
+func logQuery(ctx context.Context, msg, sql string, attrs ...slog.Attr) {
+	logger := slog.Default()
+	if !logger.Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, msg, 0)
+	r.AddAttrs(slog.String(ComponentKey, "pgx"), slog.String("sql", sql))
+	r.AddAttrs(attrs...)
+	_ = logger.Handler().Handle(ctx, r)
+}
+
+func newTraceLog() *tracelog.TraceLog {
 	logger := slog.Default()
 
 	return &tracelog.TraceLog{
 		Logger: tracelog.LoggerFunc(func(ctx context.Context, l tracelog.LogLevel, msg string, data map[string]any) {
-			attrs := make([]slog.Attr, 0, 2)
+			attrs := []slog.Attr{slog.String(ComponentKey, "pgx")}
 			for k, v := range data {
 				switch k {
 				case "args":
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sampler passes at most limit records with the same level and message per period
+type sampler struct {
+	limit  int
+	period time.Duration
+
+	mu     sync.Mutex
+	counts map[sampleKey]int
+}
+
+type sampleKey struct {
+	level slog.Level
+	msg   string
+}
+
+// ValidateSampling checks sampling rate like 100/1s, at most 100 identical messages per second.
+// Empty string disables sampling
+func ValidateSampling(s string) error {
+	_, err := parseSampling(s)
+	return err
+}
+
+func parseSampling(s string) (*sampler, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	limit, period, found := strings.Cut(s, "/")
+	if !found {
+		return nil, errors.New("must be like 100/1s")
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return nil, errors.New("must be like 100/1s, with positive number of messages")
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return nil, errors.New("must be like 100/1s, with positive period")
+	}
+
+	return &sampler{limit: n, period: d, counts: make(map[sampleKey]int)}, nil
+}
+
+func (s *sampler) allow(r *slog.Record) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sampleKey{level: r.Level, msg: r.Message}
+	s.counts[key]++
+
+	return s.counts[key] <= s.limit
+}
+
+// run resets the counts every period, logging how many records were suppressed with h
+func (s *sampler) run(h slog.Handler) {
+	for range time.Tick(s.period) {
+		s.mu.Lock()
+		counts := s.counts
+		s.counts = make(map[sampleKey]int, len(counts))
+		s.mu.Unlock()
+
+		for key, n := range counts {
+			if n <= s.limit || !h.Enabled(context.Background(), key.level) {
+				continue
+			}
+
+			r := slog.NewRecord(time.Now(), key.level, fmt.Sprintf("Suppressed %d messages", n-s.limit), 0)
+			r.AddAttrs(slog.String("message", key.msg), slog.Duration("period", s.period))
+			_ = h.Handle(context.Background(), r)
+		}
+	}
+}
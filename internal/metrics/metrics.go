@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "books"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by chi route pattern and response status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	httpErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_errors_total",
+		Help:      "Error responses by problem code, each logged with its err_id.",
+	}, []string{"code", "status"})
+
+	crawlerPages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "crawler",
+		Name:      "pages_total",
+		Help:      "Fetched pages by feed type, result is ok or error.",
+	}, []string{"feed", "result"})
+
+	crawlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "crawler",
+		Name:      "fetch_duration_seconds",
+		Help:      "Latency of fetching pages by feed type.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"feed"})
+
+	crawlerBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "crawler",
+		Name:      "downloaded_bytes_total",
+		Help:      "Size of fetched pages by feed type.",
+	}, []string{"feed"})
+
+	crawlerEntities = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "crawler",
+		Name:      "entities_total",
+		Help:      "Crawled entities by result: stored, updated or skipped as unchanged.",
+	}, []string{"entity", "result"})
+
+	crawlerFails = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "crawler",
+		Name:      "fails_total",
+		Help:      "Fails recorded for resuming, by feed type.",
+	}, []string{"feed"})
+)
+
+// Handler exposes the metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware counts requests by chi route pattern, so it must wrap the router.
+// Requests not matching any route are counted as "unmatched" to keep the number of series bounded
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// HTTPError counts error responses
+func HTTPError(code string, status int) {
+	httpErrors.WithLabelValues(code, strconv.Itoa(status)).Inc()
+}
+
+// RegisterPool exposes stats of the pool
+func RegisterPool(pg *pgxpool.Pool) {
+	gauge := func(name, help string, val func(s *pgxpool.Stat) float64) {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "pgx_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return val(pg.Stat()) })
+	}
+	counter := func(name, help string, val func(s *pgxpool.Stat) float64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pgx_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return val(pg.Stat()) })
+	}
+
+	gauge("acquired_conns", "Connections currently in use.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("idle_conns", "Idle connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	gauge("total_conns", "All open connections, including the ones being established.",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("max_conns", "Maximum size of the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	counter("acquires_total", "Successful acquires of connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("acquire_duration_seconds_total", "Time spent acquiring connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+	counter("empty_acquires_total", "Acquires which had to wait for a connection.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("canceled_acquires_total", "Acquires canceled by the context.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+}
+
+// Fetched counts the fetched page, size is ignored on error
+func Fetched(feed string, d time.Duration, size int, err error) {
+	feed = label(feed)
+
+	if err != nil {
+		crawlerPages.WithLabelValues(feed, "error").Inc()
+		return
+	}
+
+	crawlerPages.WithLabelValues(feed, "ok").Inc()
+	crawlerDuration.WithLabelValues(feed).Observe(d.Seconds())
+	crawlerBytes.WithLabelValues(feed).Add(float64(size))
+}
+
+// Crawled counts the entity by result: stored, updated or skipped
+func Crawled(entity, result string, n int) {
+	crawlerEntities.WithLabelValues(entity, result).Add(float64(n))
+}
+
+func Failed(feed string) {
+	crawlerFails.WithLabelValues(label(feed)).Inc()
+}
+
+// label makes human-readable names like "authors feed" look like the other label values
+func label(s string) string {
+	return strings.ReplaceAll(s, " ", "_")
+}
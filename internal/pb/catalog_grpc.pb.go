@@ -0,0 +1,863 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: catalog.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Books_Get_FullMethodName      = "/books.v1.Books/Get"
+	Books_BatchGet_FullMethodName = "/books.v1.Books/BatchGet"
+	Books_Search_FullMethodName   = "/books.v1.Books/Search"
+	Books_Export_FullMethodName   = "/books.v1.Books/Export"
+)
+
+// BooksClient is the client API for Books service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BooksClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Book, error)
+	BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetBooksResponse, error)
+	Search(ctx context.Context, in *SearchBooksRequest, opts ...grpc.CallOption) (*SearchBooksResponse, error)
+	// Export streams all the books matching the filter
+	Export(ctx context.Context, in *ExportBooksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Book], error)
+}
+
+type booksClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBooksClient(cc grpc.ClientConnInterface) BooksClient {
+	return &booksClient{cc}
+}
+
+func (c *booksClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Book, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Book)
+	err := c.cc.Invoke(ctx, Books_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetBooksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetBooksResponse)
+	err := c.cc.Invoke(ctx, Books_BatchGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) Search(ctx context.Context, in *SearchBooksRequest, opts ...grpc.CallOption) (*SearchBooksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchBooksResponse)
+	err := c.cc.Invoke(ctx, Books_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) Export(ctx context.Context, in *ExportBooksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Book], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Books_ServiceDesc.Streams[0], Books_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportBooksRequest, Book]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Books_ExportClient = grpc.ServerStreamingClient[Book]
+
+// BooksServer is the server API for Books service.
+// All implementations must embed UnimplementedBooksServer
+// for forward compatibility.
+type BooksServer interface {
+	Get(context.Context, *GetRequest) (*Book, error)
+	BatchGet(context.Context, *BatchGetRequest) (*BatchGetBooksResponse, error)
+	Search(context.Context, *SearchBooksRequest) (*SearchBooksResponse, error)
+	// Export streams all the books matching the filter
+	Export(*ExportBooksRequest, grpc.ServerStreamingServer[Book]) error
+	mustEmbedUnimplementedBooksServer()
+}
+
+// UnimplementedBooksServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBooksServer struct{}
+
+func (UnimplementedBooksServer) Get(context.Context, *GetRequest) (*Book, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedBooksServer) BatchGet(context.Context, *BatchGetRequest) (*BatchGetBooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedBooksServer) Search(context.Context, *SearchBooksRequest) (*SearchBooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedBooksServer) Export(*ExportBooksRequest, grpc.ServerStreamingServer[Book]) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedBooksServer) mustEmbedUnimplementedBooksServer() {}
+func (UnimplementedBooksServer) testEmbeddedByValue()               {}
+
+// UnsafeBooksServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BooksServer will
+// result in compilation errors.
+type UnsafeBooksServer interface {
+	mustEmbedUnimplementedBooksServer()
+}
+
+func RegisterBooksServer(s grpc.ServiceRegistrar, srv BooksServer) {
+	// If the following call pancis, it indicates UnimplementedBooksServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Books_ServiceDesc, srv)
+}
+
+func _Books_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Books_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Books_BatchGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).BatchGet(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchBooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Books_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).Search(ctx, req.(*SearchBooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportBooksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BooksServer).Export(m, &grpc.GenericServerStream[ExportBooksRequest, Book]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Books_ExportServer = grpc.ServerStreamingServer[Book]
+
+// Books_ServiceDesc is the grpc.ServiceDesc for Books service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Books_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "books.v1.Books",
+	HandlerType: (*BooksServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Books_Get_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _Books_BatchGet_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Books_Search_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Export",
+			Handler:       _Books_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "catalog.proto",
+}
+
+const (
+	Authors_Get_FullMethodName      = "/books.v1.Authors/Get"
+	Authors_BatchGet_FullMethodName = "/books.v1.Authors/BatchGet"
+	Authors_Search_FullMethodName   = "/books.v1.Authors/Search"
+	Authors_Export_FullMethodName   = "/books.v1.Authors/Export"
+)
+
+// AuthorsClient is the client API for Authors service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AuthorsClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Author, error)
+	BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*AuthorsResponse, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*AuthorsResponse, error)
+	// Export streams all the authors found by Search, ordered by id
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Author], error)
+}
+
+type authorsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuthorsClient(cc grpc.ClientConnInterface) AuthorsClient {
+	return &authorsClient{cc}
+}
+
+func (c *authorsClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Author, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Author)
+	err := c.cc.Invoke(ctx, Authors_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorsClient) BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*AuthorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthorsResponse)
+	err := c.cc.Invoke(ctx, Authors_BatchGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorsClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*AuthorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthorsResponse)
+	err := c.cc.Invoke(ctx, Authors_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorsClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Author], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Authors_ServiceDesc.Streams[0], Authors_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, Author]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Authors_ExportClient = grpc.ServerStreamingClient[Author]
+
+// AuthorsServer is the server API for Authors service.
+// All implementations must embed UnimplementedAuthorsServer
+// for forward compatibility.
+type AuthorsServer interface {
+	Get(context.Context, *GetRequest) (*Author, error)
+	BatchGet(context.Context, *BatchGetRequest) (*AuthorsResponse, error)
+	Search(context.Context, *SearchRequest) (*AuthorsResponse, error)
+	// Export streams all the authors found by Search, ordered by id
+	Export(*ExportRequest, grpc.ServerStreamingServer[Author]) error
+	mustEmbedUnimplementedAuthorsServer()
+}
+
+// UnimplementedAuthorsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAuthorsServer struct{}
+
+func (UnimplementedAuthorsServer) Get(context.Context, *GetRequest) (*Author, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedAuthorsServer) BatchGet(context.Context, *BatchGetRequest) (*AuthorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedAuthorsServer) Search(context.Context, *SearchRequest) (*AuthorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedAuthorsServer) Export(*ExportRequest, grpc.ServerStreamingServer[Author]) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedAuthorsServer) mustEmbedUnimplementedAuthorsServer() {}
+func (UnimplementedAuthorsServer) testEmbeddedByValue()                 {}
+
+// UnsafeAuthorsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AuthorsServer will
+// result in compilation errors.
+type UnsafeAuthorsServer interface {
+	mustEmbedUnimplementedAuthorsServer()
+}
+
+func RegisterAuthorsServer(s grpc.ServiceRegistrar, srv AuthorsServer) {
+	// If the following call pancis, it indicates UnimplementedAuthorsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Authors_ServiceDesc, srv)
+}
+
+func _Authors_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorsServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authors_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorsServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authors_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorsServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authors_BatchGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorsServer).BatchGet(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authors_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorsServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authors_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorsServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authors_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AuthorsServer).Export(m, &grpc.GenericServerStream[ExportRequest, Author]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Authors_ExportServer = grpc.ServerStreamingServer[Author]
+
+// Authors_ServiceDesc is the grpc.ServiceDesc for Authors service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Authors_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "books.v1.Authors",
+	HandlerType: (*AuthorsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Authors_Get_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _Authors_BatchGet_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Authors_Search_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Export",
+			Handler:       _Authors_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "catalog.proto",
+}
+
+const (
+	SeriesService_Get_FullMethodName      = "/books.v1.SeriesService/Get"
+	SeriesService_BatchGet_FullMethodName = "/books.v1.SeriesService/BatchGet"
+	SeriesService_Search_FullMethodName   = "/books.v1.SeriesService/Search"
+	SeriesService_Export_FullMethodName   = "/books.v1.SeriesService/Export"
+)
+
+// SeriesServiceClient is the client API for SeriesService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SeriesServiceClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Series, error)
+	BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*SeriesResponse, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SeriesResponse, error)
+	// Export streams all the series found by Search, ordered by id
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Series], error)
+}
+
+type seriesServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSeriesServiceClient(cc grpc.ClientConnInterface) SeriesServiceClient {
+	return &seriesServiceClient{cc}
+}
+
+func (c *seriesServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Series, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Series)
+	err := c.cc.Invoke(ctx, SeriesService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seriesServiceClient) BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*SeriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SeriesResponse)
+	err := c.cc.Invoke(ctx, SeriesService_BatchGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seriesServiceClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SeriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SeriesResponse)
+	err := c.cc.Invoke(ctx, SeriesService_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seriesServiceClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Series], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SeriesService_ServiceDesc.Streams[0], SeriesService_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, Series]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SeriesService_ExportClient = grpc.ServerStreamingClient[Series]
+
+// SeriesServiceServer is the server API for SeriesService service.
+// All implementations must embed UnimplementedSeriesServiceServer
+// for forward compatibility.
+type SeriesServiceServer interface {
+	Get(context.Context, *GetRequest) (*Series, error)
+	BatchGet(context.Context, *BatchGetRequest) (*SeriesResponse, error)
+	Search(context.Context, *SearchRequest) (*SeriesResponse, error)
+	// Export streams all the series found by Search, ordered by id
+	Export(*ExportRequest, grpc.ServerStreamingServer[Series]) error
+	mustEmbedUnimplementedSeriesServiceServer()
+}
+
+// UnimplementedSeriesServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSeriesServiceServer struct{}
+
+func (UnimplementedSeriesServiceServer) Get(context.Context, *GetRequest) (*Series, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedSeriesServiceServer) BatchGet(context.Context, *BatchGetRequest) (*SeriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedSeriesServiceServer) Search(context.Context, *SearchRequest) (*SeriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedSeriesServiceServer) Export(*ExportRequest, grpc.ServerStreamingServer[Series]) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedSeriesServiceServer) mustEmbedUnimplementedSeriesServiceServer() {}
+func (UnimplementedSeriesServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeSeriesServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SeriesServiceServer will
+// result in compilation errors.
+type UnsafeSeriesServiceServer interface {
+	mustEmbedUnimplementedSeriesServiceServer()
+}
+
+func RegisterSeriesServiceServer(s grpc.ServiceRegistrar, srv SeriesServiceServer) {
+	// If the following call pancis, it indicates UnimplementedSeriesServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SeriesService_ServiceDesc, srv)
+}
+
+func _SeriesService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeriesServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeriesService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeriesServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeriesService_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeriesServiceServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeriesService_BatchGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeriesServiceServer).BatchGet(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeriesService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeriesServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SeriesService_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeriesServiceServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeriesService_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SeriesServiceServer).Export(m, &grpc.GenericServerStream[ExportRequest, Series]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SeriesService_ExportServer = grpc.ServerStreamingServer[Series]
+
+// SeriesService_ServiceDesc is the grpc.ServiceDesc for SeriesService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SeriesService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "books.v1.SeriesService",
+	HandlerType: (*SeriesServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _SeriesService_Get_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _SeriesService_BatchGet_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _SeriesService_Search_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Export",
+			Handler:       _SeriesService_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "catalog.proto",
+}
+
+const (
+	Genres_Get_FullMethodName      = "/books.v1.Genres/Get"
+	Genres_BatchGet_FullMethodName = "/books.v1.Genres/BatchGet"
+	Genres_Search_FullMethodName   = "/books.v1.Genres/Search"
+)
+
+// GenresClient is the client API for Genres service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GenresClient interface {
+	Get(ctx context.Context, in *GetGenreRequest, opts ...grpc.CallOption) (*Genre, error)
+	BatchGet(ctx context.Context, in *BatchGetGenresRequest, opts ...grpc.CallOption) (*GenresResponse, error)
+	Search(ctx context.Context, in *SearchGenresRequest, opts ...grpc.CallOption) (*GenresResponse, error)
+}
+
+type genresClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGenresClient(cc grpc.ClientConnInterface) GenresClient {
+	return &genresClient{cc}
+}
+
+func (c *genresClient) Get(ctx context.Context, in *GetGenreRequest, opts ...grpc.CallOption) (*Genre, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Genre)
+	err := c.cc.Invoke(ctx, Genres_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *genresClient) BatchGet(ctx context.Context, in *BatchGetGenresRequest, opts ...grpc.CallOption) (*GenresResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenresResponse)
+	err := c.cc.Invoke(ctx, Genres_BatchGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *genresClient) Search(ctx context.Context, in *SearchGenresRequest, opts ...grpc.CallOption) (*GenresResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenresResponse)
+	err := c.cc.Invoke(ctx, Genres_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GenresServer is the server API for Genres service.
+// All implementations must embed UnimplementedGenresServer
+// for forward compatibility.
+type GenresServer interface {
+	Get(context.Context, *GetGenreRequest) (*Genre, error)
+	BatchGet(context.Context, *BatchGetGenresRequest) (*GenresResponse, error)
+	Search(context.Context, *SearchGenresRequest) (*GenresResponse, error)
+	mustEmbedUnimplementedGenresServer()
+}
+
+// UnimplementedGenresServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGenresServer struct{}
+
+func (UnimplementedGenresServer) Get(context.Context, *GetGenreRequest) (*Genre, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedGenresServer) BatchGet(context.Context, *BatchGetGenresRequest) (*GenresResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedGenresServer) Search(context.Context, *SearchGenresRequest) (*GenresResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedGenresServer) mustEmbedUnimplementedGenresServer() {}
+func (UnimplementedGenresServer) testEmbeddedByValue()                {}
+
+// UnsafeGenresServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GenresServer will
+// result in compilation errors.
+type UnsafeGenresServer interface {
+	mustEmbedUnimplementedGenresServer()
+}
+
+func RegisterGenresServer(s grpc.ServiceRegistrar, srv GenresServer) {
+	// If the following call pancis, it indicates UnimplementedGenresServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Genres_ServiceDesc, srv)
+}
+
+func _Genres_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGenreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenresServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Genres_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenresServer).Get(ctx, req.(*GetGenreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Genres_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetGenresRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenresServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Genres_BatchGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenresServer).BatchGet(ctx, req.(*BatchGetGenresRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Genres_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchGenresRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenresServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Genres_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenresServer).Search(ctx, req.(*SearchGenresRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Genres_ServiceDesc is the grpc.ServiceDesc for Genres service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Genres_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "books.v1.Genres",
+	HandlerType: (*GenresServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Genres_Get_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _Genres_BatchGet_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Genres_Search_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "catalog.proto",
+}
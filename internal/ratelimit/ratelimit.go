@@ -0,0 +1,100 @@
+// Package ratelimit implements token buckets keyed by client
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst requests at once, the bucket is refilled with Rate tokens per second. Rate must be positive
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests per minute, all of them at once as well
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+type Result struct {
+	Allowed bool
+	// Burst of the limit
+	Limit int
+	// Requests which can be made right now
+	Remaining int
+	// Until the next request is allowed, zero when this one is
+	RetryAfter time.Duration
+	// Until the bucket is full again
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// Full buckets are the same as missing ones, so they are swept
+	full time.Time
+}
+
+// Buckets are created on the first request of the key, and dropped once they are full again
+type Buckets struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+const sweepPeriod = time.Minute
+
+func New() *Buckets {
+	return &Buckets{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Take takes a token from the bucket of the key if there is one. Limit of the key should not change
+// between the calls, but if it does the bucket is adjusted
+func (b *Buckets) Take(key string, limit Limit) Result {
+	return b.take(key, limit, time.Now())
+}
+
+func (b *Buckets) take(key string, limit Limit, now time.Time) Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.lastSweep) >= sweepPeriod {
+		for k, bk := range b.buckets {
+			if !bk.full.After(now) {
+				delete(b.buckets, k)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	burst := float64(limit.Burst)
+
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: burst, last: now}
+		b.buckets[key] = bk
+	}
+
+	bk.tokens = math.Min(burst, bk.tokens+now.Sub(bk.last).Seconds()*limit.Rate)
+	bk.last = now
+
+	res := Result{Limit: limit.Burst}
+	if bk.tokens >= 1 {
+		bk.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - bk.tokens) / limit.Rate)
+	}
+
+	res.Remaining = int(bk.tokens)
+	res.Reset = seconds((burst - bk.tokens) / limit.Rate)
+	bk.full = now.Add(res.Reset)
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
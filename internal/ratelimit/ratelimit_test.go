@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	// 1 token per second, 3 at once
+	limit := Limit{Rate: 1, Burst: 3}
+
+	type take struct {
+		// Since the first request
+		at   time.Duration
+		want Result
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "burst then refill",
+			takes: []take{
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+				{at: 0, want: Result{Limit: 3, RetryAfter: time.Second, Reset: 3 * time.Second}},
+				{at: 500 * time.Millisecond, want: Result{
+					Limit: 3, RetryAfter: 500 * time.Millisecond, Reset: 2500 * time.Millisecond,
+				}},
+				{at: time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+			},
+		},
+		{
+			name: "refill is capped by burst",
+			takes: []take{
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+				{at: time.Hour, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+			},
+		},
+		{
+			name: "fractional tokens are not spent",
+			takes: []take{
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+				{at: 0, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+				{at: 1500 * time.Millisecond, want: Result{
+					Allowed: true, Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond,
+				}},
+				{at: 1500 * time.Millisecond, want: Result{
+					Limit: 3, RetryAfter: 500 * time.Millisecond, Reset: 2500 * time.Millisecond,
+				}},
+			},
+		},
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+
+			for ix, tk := range tt.takes {
+				got := b.take("key", limit, start.Add(tk.at))
+				if got != tk.want {
+					t.Errorf("take #%d at %v = %+v, want %+v", ix, tk.at, got, tk.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTakeKeysAreIndependent(t *testing.T) {
+	b := New()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+
+	if !b.take("a", limit, now).Allowed {
+		t.Fatal("first request of a is not allowed")
+	}
+
+	if b.take("a", limit, now).Allowed {
+		t.Fatal("second request of a is allowed")
+	}
+
+	if !b.take("b", limit, now).Allowed {
+		t.Fatal("first request of b is not allowed")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	b := New()
+	limit := PerMinute(60)
+	start := b.lastSweep
+
+	b.take("full", limit, start)
+	for range 60 {
+		b.take("empty", limit, start.Add(sweepPeriod/2))
+	}
+
+	// "full" is refilled a second after its request, "empty" a minute after its last one
+	b.take("other", limit, start.Add(sweepPeriod))
+
+	if _, ok := b.buckets["full"]; ok {
+		t.Error("full bucket is not swept")
+	}
+
+	if _, ok := b.buckets["empty"]; !ok {
+		t.Error("empty bucket is swept")
+	}
+}
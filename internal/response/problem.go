@@ -0,0 +1,158 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrorCode is machine-readable kind of the error, stable across releases
+type ErrorCode string
+
+const (
+	CodeInternal            ErrorCode = "internal"
+	CodeBadRequest          ErrorCode = "bad_request"
+	CodeInvalidParameter    ErrorCode = "invalid_parameter"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeRateLimited         ErrorCode = "rate_limited"
+	CodeUpstreamUnavailable ErrorCode = "upstream_unavailable"
+)
+
+// Problem type URIs are the codes under this prefix, they identify the kind and are not meant to be dereferenced
+const problemTypePrefix = "urn:books:problem:"
+
+// Error is an application error with a status and a code, rendered by Responder as RFC 7807
+// problem details. Unlike other errors, its message is shown even outside of debug mode
+type Error struct {
+	Status int
+	Code   ErrorCode
+	Detail string
+	// Set for CodeInvalidParameter
+	Params []InvalidParam
+	// Sent in Retry-After header when positive
+	RetryAfter time.Duration
+	// Logged, but only shown in debug mode
+	Cause error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Detail + ": " + e.Cause.Error()
+	}
+
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// InvalidParam names the request parameter which was rejected and why
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func NotFound(detail string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: detail}
+}
+
+// BadRequest is for malformed requests not caused by a single parameter, like unparsable body
+func BadRequest(err error) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Detail: err.Error()}
+}
+
+// InvalidParams lists all the rejected params of the request
+func InvalidParams(params ...InvalidParam) *Error {
+	msgs := make([]string, 0, len(params))
+	for _, p := range params {
+		msgs = append(msgs, "invalid parameter "+p.Name+": "+p.Reason)
+	}
+
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   CodeInvalidParameter,
+		Detail: strings.Join(msgs, "; "),
+		Params: params,
+	}
+}
+
+// NewInvalidParam is a shortcut for InvalidParams with the single parameter
+func NewInvalidParam(name, reason string) *Error {
+	return InvalidParams(InvalidParam{Name: name, Reason: reason})
+}
+
+// Unauthorized is for missing or invalid API keys
+func Unauthorized(detail string) *Error {
+	return &Error{
+		Status: http.StatusUnauthorized,
+		Code:   CodeUnauthorized,
+		Detail: detail,
+	}
+}
+
+func RateLimited(retryAfter time.Duration) *Error {
+	return &Error{
+		Status:     http.StatusTooManyRequests,
+		Code:       CodeRateLimited,
+		Detail:     "too many requests",
+		RetryAfter: retryAfter,
+	}
+}
+
+// UpstreamUnavailable is for failures of the database or other services the request depends on
+func UpstreamUnavailable(cause error) *Error {
+	return &Error{
+		Status: http.StatusServiceUnavailable,
+		Code:   CodeUpstreamUnavailable,
+		Detail: "service is temporarily unavailable",
+		Cause:  cause,
+	}
+}
+
+// asError finds Error in the chain, or classifies the unexpected error with the status
+func asError(err error, status int) *Error {
+	if e := new(Error); errors.As(err, &e) {
+		return e
+	}
+
+	if ce := new(pgconn.ConnectError); errors.As(err, &ce) {
+		return UpstreamUnavailable(err)
+	}
+
+	ret := &Error{Status: status, Code: codeOf(status), Cause: err}
+	if status >= http.StatusInternalServerError {
+		ret.Detail = "unknown error occurred while processing your request"
+	} else {
+		// Statuses below 500 are only used for errors caused by the request itself
+		ret.Detail = err.Error()
+		ret.Cause = nil
+	}
+
+	return ret
+}
+
+func codeOf(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return CodeBadRequest
+}
@@ -0,0 +1,257 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// connectFailed wraps ConnectError without calling its Error, which needs the config
+type connectFailed struct {
+	err *pgconn.ConnectError
+}
+
+func (c connectFailed) Error() string { return "connect failed" }
+func (c connectFailed) Unwrap() error { return c.err }
+
+func TestAsError(t *testing.T) {
+	notFound := NotFound("book not found")
+	plain := errors.New("limit is too large")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		want   *Error
+	}{
+		{name: "error", err: notFound, status: http.StatusInternalServerError, want: notFound},
+		{name: "wrapped error", err: fmt.Errorf("loading: %w", notFound), status: http.StatusBadRequest, want: notFound},
+		{
+			name:   "server error hides the message",
+			err:    plain,
+			status: http.StatusInternalServerError,
+			want: &Error{
+				Status: http.StatusInternalServerError,
+				Code:   CodeInternal,
+				Detail: "unknown error occurred while processing your request",
+				Cause:  plain,
+			},
+		},
+		{
+			name:   "client error exposes the message",
+			err:    plain,
+			status: http.StatusBadRequest,
+			want:   &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Detail: "limit is too large"},
+		},
+		{
+			name:   "not found",
+			err:    plain,
+			status: http.StatusNotFound,
+			want:   &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: "limit is too large"},
+		},
+		{
+			name:   "unauthorized",
+			err:    plain,
+			status: http.StatusUnauthorized,
+			want:   &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Detail: "limit is too large"},
+		},
+		{
+			name:   "rate limited",
+			err:    plain,
+			status: http.StatusTooManyRequests,
+			want:   &Error{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Detail: "limit is too large"},
+		},
+		{
+			name:   "other client status",
+			err:    plain,
+			status: http.StatusTeapot,
+			want:   &Error{Status: http.StatusTeapot, Code: CodeBadRequest, Detail: "limit is too large"},
+		},
+		{
+			name:   "upstream status",
+			err:    plain,
+			status: http.StatusBadGateway,
+			want: &Error{
+				Status: http.StatusBadGateway,
+				Code:   CodeUpstreamUnavailable,
+				Detail: "unknown error occurred while processing your request",
+				Cause:  plain,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := asError(tt.err, tt.status)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("asError() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsErrorConnectError(t *testing.T) {
+	err := fmt.Errorf("searching: %w", connectFailed{&pgconn.ConnectError{}})
+
+	got := asError(err, http.StatusBadRequest)
+	if got.Status != http.StatusServiceUnavailable || got.Code != CodeUpstreamUnavailable {
+		t.Errorf("asError() = %d %s, want %d %s",
+			got.Status, got.Code, http.StatusServiceUnavailable, CodeUpstreamUnavailable)
+	}
+
+	if !errors.Is(got.Cause, err) {
+		t.Errorf("asError() cause = %v, want %v", got.Cause, err)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	cause := errors.New("connection reset")
+
+	tests := []struct {
+		name       string
+		debug      bool
+		err        *Error
+		want       problem
+		retryAfter string
+	}{
+		{
+			name: "not found",
+			err:  NotFound("book not found"),
+			want: problem{
+				Type:   "urn:books:problem:not_found",
+				Title:  "Not Found",
+				Status: http.StatusNotFound,
+				Detail: "Book not found",
+				Code:   CodeNotFound,
+				ErrId:  "err-1",
+			},
+		},
+		{
+			name: "invalid params",
+			err: InvalidParams(
+				InvalidParam{Name: "limit", Reason: "must be at most 100"},
+				InvalidParam{Name: "sort", Reason: "must be one of title, year"},
+			),
+			want: problem{
+				Type:   "urn:books:problem:invalid_parameter",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				Detail: "Invalid parameter limit: must be at most 100; invalid parameter sort: must be one of title, year",
+				Code:   CodeInvalidParameter,
+				ErrId:  "err-1",
+				InvalidParams: []InvalidParam{
+					{Name: "limit", Reason: "must be at most 100"},
+					{Name: "sort", Reason: "must be one of title, year"},
+				},
+			},
+		},
+		{
+			name: "cause is hidden",
+			err:  UpstreamUnavailable(cause),
+			want: problem{
+				Type:   "urn:books:problem:upstream_unavailable",
+				Title:  "Service Unavailable",
+				Status: http.StatusServiceUnavailable,
+				Detail: "Service is temporarily unavailable",
+				Code:   CodeUpstreamUnavailable,
+				ErrId:  "err-1",
+			},
+		},
+		{
+			name:  "cause is shown in debug mode",
+			debug: true,
+			err:   UpstreamUnavailable(cause),
+			want: problem{
+				Type:   "urn:books:problem:upstream_unavailable",
+				Title:  "Service Unavailable",
+				Status: http.StatusServiceUnavailable,
+				Detail: "Service is temporarily unavailable: connection reset",
+				Code:   CodeUpstreamUnavailable,
+				ErrId:  "err-1",
+			},
+		},
+		{
+			name: "retry after is rounded up",
+			err:  RateLimited(1500 * time.Millisecond),
+			want: problem{
+				Type:   "urn:books:problem:rate_limited",
+				Title:  "Too Many Requests",
+				Status: http.StatusTooManyRequests,
+				Detail: "Too many requests",
+				Code:   CodeRateLimited,
+				ErrId:  "err-1",
+			},
+			retryAfter: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			// Headers of the successful response set before the failure
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Last-Modified", "Sat, 17 Oct 2026 12:00:00 GMT")
+			w.Header().Set("Cache-Control", "public, max-age=60")
+
+			rr := &Responder{DebugMode: tt.debug}
+			rr.renderError(w, context.Background(), tt.err, "err-1")
+
+			if w.Code != tt.want.Status {
+				t.Errorf("status = %d, want %d", w.Code, tt.want.Status)
+			}
+
+			wantHeaders := map[string]string{
+				"Content-Type":           "application/problem+json; charset=utf-8",
+				"Cache-Control":          "no-store",
+				"X-Content-Type-Options": "nosniff",
+				"ETag":                   "",
+				"Last-Modified":          "",
+				"Retry-After":            tt.retryAfter,
+			}
+			for name, want := range wantHeaders {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+
+			var got problem
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("unmarshaling body: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("body = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Errors other than Error are only expected below 500 when caused by the request,
+// so their messages are shown to the client as is
+func TestRespondAndLogCustomExposesMessage(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	rr := &Responder{}
+	rr.RespondAndLogCustom(w, context.Background(), errors.New("invalid cursor"), 0, http.StatusBadRequest)
+
+	var got problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshaling body: %v", err)
+	}
+
+	if w.Code != http.StatusBadRequest || got.Code != CodeBadRequest || got.Detail != "Invalid cursor" {
+		t.Errorf("response = %d %+v, want 400 bad_request with the message", w.Code, got)
+	}
+
+	if got.ErrId == "" {
+		t.Error("err_id is empty")
+	}
+}
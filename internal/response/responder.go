@@ -3,67 +3,216 @@ package response
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/google/uuid"
+
+	"books/internal/metrics"
 )
 
 type Responder struct {
 	DebugMode bool
+	// max-age of Cache-Control sent with successful GET responses, zero makes clients revalidate every time
+	MaxAge time.Duration
+	// Responses may only be cached by the client, as they depend on it (like the ones limited by API keys)
+	Private bool
 }
 
-// RespondAndLogError will respond with generic error code (500) and log with slog.LevelError level
+// RespondAndLogError responds with the status and code of Error in the err chain, or with 500
+// (503 when the database is unreachable) for other errors. Server errors are logged with slog.LevelError,
+// the ones caused by the request with slog.LevelInfo
 func (rr *Responder) RespondAndLogError(w http.ResponseWriter, ctx context.Context, err error) {
+	e := asError(err, http.StatusInternalServerError)
+
+	lvl := slog.LevelInfo
+	if e.Status >= http.StatusInternalServerError {
+		lvl = slog.LevelError
+	}
+
 	errId := uuid.NewString()
-	log(ctx, slog.LevelError, err.Error(), slog.String("err_id", errId))
-	rr.renderError(w, ctx, http.StatusInternalServerError, err.Error(), errId)
+	log(ctx, lvl, err.Error(), slog.String("err_id", errId), slog.String("code", string(e.Code)))
+	rr.renderError(w, ctx, e, errId)
 }
 
+// RespondAndLogCustom is RespondAndLogError with the level and the status used for errors other than Error
 func (rr *Responder) RespondAndLogCustom(w http.ResponseWriter, ctx context.Context, err error, lvl slog.Level, status int) {
+	e := asError(err, status)
 	errId := uuid.NewString()
-	log(ctx, lvl, err.Error(), slog.String("err_id", errId))
-	rr.renderError(w, ctx, status, err.Error(), errId)
+	log(ctx, lvl, err.Error(), slog.String("err_id", errId), slog.String("code", string(e.Code)))
+	rr.renderError(w, ctx, e, errId)
 }
 
-func (rr *Responder) SendJson(w http.ResponseWriter, ctx context.Context, data any) {
+func (rr *Responder) SendJson(w http.ResponseWriter, r *http.Request, data any) {
+	rr.SendJsonAs(w, r, "application/json; charset=utf-8", data)
+}
+
+// SendJsonAs is SendJson for JSON based media types, like application/opds+json
+func (rr *Responder) SendJsonAs(w http.ResponseWriter, r *http.Request, contentType string, data any) {
 	bs, err := json.Marshal(data)
 	if err != nil {
-		rr.RespondAndLogError(w, ctx, err)
+		rr.RespondAndLogError(w, r.Context(), err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_, _ = io.Copy(w, bytes.NewReader(bs))
+	rr.send(w, r, contentType, bs)
 }
 
-func (rr *Responder) renderError(w http.ResponseWriter, ctx context.Context, status int, message, errId string) {
-	data := map[string]any{}
+// SendXml marshals data with the XML declaration, contentType should include the charset
+func (rr *Responder) SendXml(w http.ResponseWriter, r *http.Request, contentType string, data any) {
+	bs, err := xml.Marshal(data)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
 
+	rr.send(w, r, contentType, append([]byte(xml.Header), bs...))
+}
+
+// Send writes the already encoded body, like SendJson does
+func (rr *Responder) Send(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	rr.send(w, r, contentType, body)
+}
+
+// SetLastModified sets Last-Modified header to the latest of the times, zero ones are skipped.
+// Must be called before Send* methods, which answer If-Modified-Since with it
+func SetLastModified(w http.ResponseWriter, times ...time.Time) {
+	var last time.Time
+	for _, t := range times {
+		if t.After(last) {
+			last = t
+		}
+	}
+
+	if !last.IsZero() {
+		w.Header().Set("Last-Modified", last.UTC().Format(http.TimeFormat))
+	}
+}
+
+// send writes the body with strong ETag computed from it, and responds with 304 instead
+// when the conditional GET request already has the same body
+func (rr *Responder) send(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	h := w.Header()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", "no-store")
+		}
+		h.Set("Content-Type", contentType)
+		_, _ = io.Copy(w, bytes.NewReader(body))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	h.Set("ETag", etag)
+	if h.Get("Cache-Control") == "" {
+		if rr.MaxAge > 0 {
+			scope := "public"
+			if rr.Private {
+				scope = "private"
+			}
+			h.Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(rr.MaxAge.Seconds())))
+		} else {
+			h.Set("Cache-Control", "no-cache")
+		}
+	}
+
+	if notModified(r, etag, h.Get("Last-Modified")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	_, _ = io.Copy(w, bytes.NewReader(body))
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is no If-None-Match (RFC 9110, 13.2.2)
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified == "" {
+		return false
+	}
+
+	lm, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !lm.After(ims)
+}
+
+// problem is RFC 7807 body extended with the code, the error id for log correlation and the invalid params
+type problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail"`
+	Code          ErrorCode      `json:"code"`
+	ErrId         string         `json:"err_id"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+func (rr *Responder) renderError(w http.ResponseWriter, ctx context.Context, e *Error, errId string) {
+	metrics.HTTPError(string(e.Code), e.Status)
+
+	detail := e.Detail
 	if rr.DebugMode {
-		r, s := utf8.DecodeRuneInString(message)
-		data["error"] = string(unicode.ToUpper(r)) + message[s:]
-	} else {
-		data["error"] = "Unknown error occurred while processing your request. Error ID: " + errId
+		detail = e.Error()
 	}
 
-	bs, err := json.Marshal(data)
+	r, s := utf8.DecodeRuneInString(detail)
+
+	bs, err := json.Marshal(problem{
+		Type:          problemTypePrefix + string(e.Code),
+		Title:         http.StatusText(e.Status),
+		Status:        e.Status,
+		Detail:        string(unicode.ToUpper(r)) + detail[s:],
+		Code:          e.Code,
+		ErrId:         errId,
+		InvalidParams: e.Params,
+	})
 	if err == nil {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
 	} else {
 		log(ctx, slog.LevelError, "cannot marshall error response body: "+err.Error())
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		bs = []byte("unknown error")
 	}
 
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(status)
+	w.WriteHeader(e.Status)
 	_, _ = io.Copy(w, bytes.NewReader(bs))
 }
 
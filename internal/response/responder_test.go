@@ -0,0 +1,240 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	const etag = `"abc"`
+	lastModified := "Sat, 17 Oct 2026 12:00:00 GMT"
+
+	tests := []struct {
+		name         string
+		inm          string
+		ims          string
+		lastModified string
+		want         bool
+	}{
+		{name: "no conditions", lastModified: lastModified},
+		{name: "strong etag", inm: `"abc"`, want: true},
+		{name: "weak etag", inm: `W/"abc"`, want: true},
+		{name: "other etag", inm: `"abd"`},
+		{name: "unquoted etag", inm: "abc"},
+		{name: "any", inm: "*", want: true},
+		{name: "list", inm: `"x", W/"abc" ,"y"`, want: true},
+		{name: "list without match", inm: `"x", "y"`},
+		{name: "not modified since", ims: lastModified, lastModified: lastModified, want: true},
+		{name: "modified since", ims: "Sat, 17 Oct 2026 11:59:59 GMT", lastModified: lastModified},
+		{name: "later since", ims: "Sun, 18 Oct 2026 00:00:00 GMT", lastModified: lastModified, want: true},
+		{name: "since without last modified", ims: lastModified},
+		{name: "invalid since", ims: "yesterday", lastModified: lastModified},
+		{
+			name:         "etag takes precedence over matching since",
+			inm:          `"x"`,
+			ims:          lastModified,
+			lastModified: lastModified,
+		},
+		{
+			name:         "etag takes precedence over modified since",
+			inm:          `"abc"`,
+			ims:          "Sat, 17 Oct 2026 11:00:00 GMT",
+			lastModified: lastModified,
+			want:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.inm != "" {
+				r.Header.Set("If-None-Match", tt.inm)
+			}
+			if tt.ims != "" {
+				r.Header.Set("If-Modified-Since", tt.ims)
+			}
+
+			if got := notModified(r, etag, tt.lastModified); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	lastModified := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	send := func(rr *Responder, method string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		SetLastModified(w, lastModified)
+		rr.Send(w, r, "application/json", body)
+
+		return w
+	}
+
+	first := send(&Responder{}, http.MethodGet, nil)
+	etag := first.Header().Get("ETag")
+	if etag == "" || etag[0] != '"' {
+		t.Fatalf("ETag = %q, want strong one", etag)
+	}
+
+	tests := []struct {
+		name         string
+		rr           *Responder
+		method       string
+		headers      map[string]string
+		status       int
+		cacheControl string
+	}{
+		{name: "no cache", rr: &Responder{}, method: http.MethodGet, status: http.StatusOK, cacheControl: "no-cache"},
+		{
+			name:         "public",
+			rr:           &Responder{MaxAge: time.Minute},
+			method:       http.MethodGet,
+			status:       http.StatusOK,
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "private",
+			rr:           &Responder{MaxAge: time.Minute, Private: true},
+			method:       http.MethodGet,
+			status:       http.StatusOK,
+			cacheControl: "private, max-age=60",
+		},
+		{
+			name:         "matching etag",
+			rr:           &Responder{MaxAge: time.Minute},
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-None-Match": etag},
+			status:       http.StatusNotModified,
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "head with matching etag",
+			rr:           &Responder{},
+			method:       http.MethodHead,
+			headers:      map[string]string{"If-None-Match": "W/" + etag},
+			status:       http.StatusNotModified,
+			cacheControl: "no-cache",
+		},
+		{
+			name:         "not modified since",
+			rr:           &Responder{},
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			status:       http.StatusNotModified,
+			cacheControl: "no-cache",
+		},
+		{
+			name:         "changed body wins over not modified since",
+			rr:           &Responder{},
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			status:       http.StatusOK,
+			cacheControl: "no-cache",
+		},
+		{
+			name:         "post is not conditional",
+			rr:           &Responder{MaxAge: time.Minute},
+			method:       http.MethodPost,
+			headers:      map[string]string{"If-None-Match": etag},
+			status:       http.StatusOK,
+			cacheControl: "no-store",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.rr, tt.method, tt.headers)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+
+			if tt.method == http.MethodPost {
+				if got := w.Header().Get("ETag"); got != "" {
+					t.Errorf("ETag = %q, want none", got)
+				}
+			} else if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+
+			wantBody := string(body)
+			if tt.status == http.StatusNotModified {
+				wantBody = ""
+				if got := w.Header().Get("Content-Type"); got != "" {
+					t.Errorf("Content-Type of 304 = %q, want none", got)
+				}
+			}
+
+			if got := w.Body.String(); got != wantBody {
+				t.Errorf("body = %q, want %q", got, wantBody)
+			}
+		})
+	}
+}
+
+func TestSendKeepsCacheControl(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Cache-Control", "no-store")
+
+	(&Responder{MaxAge: time.Minute}).Send(w, httptest.NewRequest(http.MethodGet, "/", nil), "text/plain", []byte("x"))
+
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+}
+
+func TestSendBodyChangesETag(t *testing.T) {
+	etag := func(body string) string {
+		w := httptest.NewRecorder()
+		(&Responder{}).Send(w, httptest.NewRequest(http.MethodGet, "/", nil), "text/plain", []byte(body))
+		return w.Header().Get("ETag")
+	}
+
+	if etag("a") == etag("b") {
+		t.Error("different bodies have the same ETag")
+	}
+
+	if etag("a") != etag("a") {
+		t.Error("same bodies have different ETags")
+	}
+}
+
+func TestSetLastModified(t *testing.T) {
+	earlier := time.Date(2026, 10, 17, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	later := earlier.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  string
+	}{
+		{name: "none"},
+		{name: "zero only", times: []time.Time{{}}},
+		{name: "latest in UTC", times: []time.Time{earlier, {}, later}, want: "Sat, 17 Oct 2026 10:00:00 GMT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			SetLastModified(w, tt.times...)
+
+			if got := w.Header().Get("Last-Modified"); got != tt.want {
+				t.Errorf("Last-Modified = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
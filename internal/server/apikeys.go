@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"books/internal/cache"
+	"books/internal/ratelimit"
+	"books/internal/response"
+	"books/internal/storage/apikeys"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	APIKeyParam  = "api_key"
+
+	// Revoked keys keep working for that long
+	apiKeyCacheTTL = time.Minute
+)
+
+type usageKey struct {
+	id  uint32
+	day string
+}
+
+// APIKeys limits requests by the rate and the daily quota of the API key in the header or the query.
+// Requests without the key are limited by the anonymous rate per client IP, or rejected if it is zero.
+// Daily usage is shared by the instances through the database, so the quota can be exceeded by
+// the requests made during a flush period
+type APIKeys struct {
+	keys      apikeys.Repository
+	rr        *response.Responder
+	anonymous ratelimit.Limit
+	buckets   *ratelimit.Buckets
+	// Unknown and revoked keys are cached as nil
+	cache *cache.Cache[string, *apikeys.Key]
+
+	mu      sync.Mutex
+	day     string
+	used    map[uint32]int
+	pending map[usageKey]int
+}
+
+// NewAPIKeys limits anonymous clients to anonymousRate requests per minute
+func NewAPIKeys(keys apikeys.Repository, rr *response.Responder, anonymousRate int) *APIKeys {
+	return &APIKeys{
+		keys:      keys,
+		rr:        rr,
+		anonymous: ratelimit.PerMinute(anonymousRate),
+		buckets:   ratelimit.New(),
+		cache:     cache.New[string, *apikeys.Key](10000, apiKeyCacheTTL),
+		used:      make(map[uint32]int),
+		pending:   make(map[usageKey]int),
+	}
+}
+
+func (a *APIKeys) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", APIKeyHeader)
+
+		key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+		if key == "" {
+			key = strings.TrimSpace(r.URL.Query().Get(APIKeyParam))
+		}
+
+		if key == "" {
+			if a.anonymous.Burst <= 0 {
+				a.rr.RespondAndLogError(w, r.Context(),
+					response.Unauthorized("API key is required in "+APIKeyHeader+" header or "+APIKeyParam+" param"))
+				return
+			}
+
+			if !a.take(w, r, "ip:"+clientIP(r), a.anonymous) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		k, err := a.get(r.Context(), key)
+		if err != nil {
+			a.rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		if k == nil {
+			// Guessing keys costs as much as anonymous requests
+			if a.anonymous.Burst > 0 && !a.take(w, r, "ip:"+clientIP(r), a.anonymous) {
+				return
+			}
+
+			a.rr.RespondAndLogError(w, r.Context(), response.Unauthorized("API key is invalid or revoked"))
+			return
+		}
+
+		if !a.take(w, r, "key:"+strconv.FormatUint(uint64(k.Id), 10), ratelimit.PerMinute(k.RatePerMinute)) {
+			return
+		}
+
+		if retryAfter, ok := a.count(k, time.Now().UTC()); !ok {
+			e := response.RateLimited(retryAfter)
+			e.Detail = fmt.Sprintf("daily quota of %d requests is exceeded", k.DailyQuota)
+			a.rr.RespondAndLogError(w, r.Context(), e)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *APIKeys) get(ctx context.Context, key string) (*apikeys.Key, error) {
+	if k, ok := a.cache.Get(key); ok {
+		return k, nil
+	}
+
+	gen := a.cache.Generation()
+	k, err := a.keys.GetByKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	a.cache.SetSince(gen, key, k)
+
+	return k, nil
+}
+
+// take responds with 429 if the bucket is empty
+func (a *APIKeys) take(w http.ResponseWriter, r *http.Request, bucket string, limit ratelimit.Limit) bool {
+	res := a.buckets.Take(bucket, limit)
+	if !res.Allowed {
+		a.rr.RespondAndLogError(w, r.Context(), response.RateLimited(res.RetryAfter))
+	}
+
+	return res.Allowed
+}
+
+// count adds the request to the usage of the key today, unless the quota is exceeded
+func (a *APIKeys) count(k *apikeys.Key, now time.Time) (time.Duration, bool) {
+	day := now.Format(time.DateOnly)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if day != a.day {
+		a.day = day
+		clear(a.used)
+	}
+
+	if a.used[k.Id] >= k.DailyQuota {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return tomorrow.Sub(now), false
+	}
+
+	a.used[k.Id]++
+	a.pending[usageKey{id: k.Id, day: day}]++
+
+	return 0, true
+}
+
+// Run flushes the usage every period until ctx is done. Flush the rest once the requests are drained
+func (a *APIKeys) Run(ctx context.Context, period time.Duration, l *slog.Logger) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.Flush(ctx, l)
+		}
+	}
+}
+
+// Flush stores the usage counted since the last flush, and updates it with the usage of the other instances
+func (a *APIKeys) Flush(ctx context.Context, l *slog.Logger) {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[usageKey]int)
+	a.mu.Unlock()
+
+	days := make(map[string]map[uint32]int)
+	for uk, n := range pending {
+		if days[uk.day] == nil {
+			days[uk.day] = make(map[uint32]int)
+		}
+		days[uk.day][uk.id] = n
+	}
+
+	for day, requests := range days {
+		t, _ := time.Parse(time.DateOnly, day)
+
+		totals, err := a.keys.AddUsage(ctx, t, requests)
+		if err != nil {
+			l.ErrorContext(ctx, "Failed to store API key usage: "+err.Error())
+
+			// Retried with the next flush
+			a.mu.Lock()
+			for id, n := range requests {
+				a.pending[usageKey{id: id, day: day}] += n
+			}
+			a.mu.Unlock()
+			continue
+		}
+
+		// Totals include the requests to the other instances, but not the ones counted during the flush
+		a.mu.Lock()
+		if day == a.day {
+			for id, total := range totals {
+				a.used[id] = total + a.pending[usageKey{id: id, day: day}]
+			}
+		}
+		a.mu.Unlock()
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"books/internal/response"
+	"books/internal/storage/apikeys"
+)
+
+// fakeKeys is apikeys.Repository holding the keys by their plain values
+type fakeKeys struct {
+	mu      sync.Mutex
+	keys    map[string]*apikeys.Key
+	lookups map[string]int
+	// Requests of the other instances, added to the totals
+	others   map[uint32]int
+	added    []map[uint32]int
+	failAdds bool
+}
+
+func newFakeKeys(keys map[string]*apikeys.Key) *fakeKeys {
+	return &fakeKeys{keys: keys, lookups: make(map[string]int), others: make(map[uint32]int)}
+}
+
+func (f *fakeKeys) Create(context.Context, string, int, int) (string, *apikeys.Key, error) {
+	return "", nil, errors.New("not implemented")
+}
+
+func (f *fakeKeys) GetByKey(_ context.Context, key string) (*apikeys.Key, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lookups[key]++
+
+	k := f.keys[key]
+	if k == nil || k.RevokedAt != nil {
+		return nil, nil
+	}
+
+	return k, nil
+}
+
+func (f *fakeKeys) List(context.Context) ([]*apikeys.Key, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeKeys) Revoke(context.Context, uint32) (bool, error) {
+	return false, errors.New("not implemented")
+}
+
+func (f *fakeKeys) AddUsage(_ context.Context, _ time.Time, requests map[uint32]int) (map[uint32]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failAdds {
+		return nil, errors.New("database is down")
+	}
+
+	f.added = append(f.added, requests)
+
+	totals := make(map[uint32]int, len(requests))
+	for id, n := range requests {
+		f.others[id] += n
+		totals[id] = f.others[id]
+	}
+
+	return totals, nil
+}
+
+func serveWithKeys(a *APIKeys, header, param string) *httptest.ResponseRecorder {
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	target := "/books"
+	if param != "" {
+		target += "?" + APIKeyParam + "=" + param
+	}
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.RemoteAddr = "203.0.113.1:1234"
+	if header != "" {
+		r.Header.Set(APIKeyHeader, header)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAPIKeysMiddleware(t *testing.T) {
+	revokedAt := time.Now()
+	keys := map[string]*apikeys.Key{
+		"bk_valid":   {Id: 1, RatePerMinute: 600, DailyQuota: 1000},
+		"bk_revoked": {Id: 2, RatePerMinute: 600, DailyQuota: 1000, RevokedAt: &revokedAt},
+		"bk_slow":    {Id: 3, RatePerMinute: 1, DailyQuota: 1000},
+	}
+
+	type request struct {
+		header string
+		param  string
+		status int
+	}
+
+	tests := []struct {
+		name          string
+		anonymousRate int
+		requests      []request
+	}{
+		{
+			name:          "anonymous rate 0 requires the key",
+			anonymousRate: 0,
+			requests: []request{
+				{status: http.StatusUnauthorized},
+				{header: "bk_valid", status: http.StatusOK},
+			},
+		},
+		{
+			name:          "anonymous rate",
+			anonymousRate: 1,
+			requests: []request{
+				{status: http.StatusOK},
+				{status: http.StatusTooManyRequests},
+				// The key has its own bucket
+				{header: "bk_valid", status: http.StatusOK},
+			},
+		},
+		{
+			name:          "key in header or param",
+			anonymousRate: 0,
+			requests: []request{
+				{header: " bk_valid ", status: http.StatusOK},
+				{param: "bk_valid", status: http.StatusOK},
+				{header: "bk_valid", param: "bk_unknown", status: http.StatusOK},
+			},
+		},
+		{
+			name:          "unknown and revoked keys",
+			anonymousRate: 0,
+			requests: []request{
+				{header: "bk_unknown", status: http.StatusUnauthorized},
+				{header: "bk_revoked", status: http.StatusUnauthorized},
+			},
+		},
+		{
+			name:          "guessing keys costs anonymous requests",
+			anonymousRate: 1,
+			requests: []request{
+				{header: "bk_unknown", status: http.StatusUnauthorized},
+				{header: "bk_other", status: http.StatusTooManyRequests},
+				{status: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:          "key rate",
+			anonymousRate: 0,
+			requests: []request{
+				{header: "bk_slow", status: http.StatusOK},
+				{header: "bk_slow", status: http.StatusTooManyRequests},
+				{header: "bk_valid", status: http.StatusOK},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAPIKeys(newFakeKeys(keys), &response.Responder{}, tt.anonymousRate)
+
+			for ix, req := range tt.requests {
+				w := serveWithKeys(a, req.header, req.param)
+
+				if w.Code != req.status {
+					t.Errorf("request #%d status = %d, want %d", ix, w.Code, req.status)
+				}
+
+				if got := w.Header().Get("Vary"); got != APIKeyHeader {
+					t.Errorf("request #%d Vary = %q, want %q", ix, got, APIKeyHeader)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeysCache(t *testing.T) {
+	fake := newFakeKeys(map[string]*apikeys.Key{
+		"bk_valid": {Id: 1, RatePerMinute: 600, DailyQuota: 1000},
+	})
+	a := NewAPIKeys(fake, &response.Responder{}, 0)
+
+	for range 3 {
+		serveWithKeys(a, "bk_valid", "")
+		serveWithKeys(a, "bk_unknown", "")
+	}
+
+	// Revocation is only seen once the cached key expires
+	revokedAt := time.Now()
+	fake.mu.Lock()
+	fake.keys["bk_valid"].RevokedAt = &revokedAt
+	fake.mu.Unlock()
+
+	if w := serveWithKeys(a, "bk_valid", ""); w.Code != http.StatusOK {
+		t.Errorf("cached key status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	want := map[string]int{"bk_valid": 1, "bk_unknown": 1}
+	if !reflect.DeepEqual(fake.lookups, want) {
+		t.Errorf("lookups = %v, want %v", fake.lookups, want)
+	}
+
+	a.cache.Purge()
+
+	if w := serveWithKeys(a, "bk_valid", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIKeysQuota(t *testing.T) {
+	a := NewAPIKeys(newFakeKeys(nil), &response.Responder{}, 0)
+	k := &apikeys.Key{Id: 1, DailyQuota: 2}
+
+	now := time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+
+	for ix := range 2 {
+		if _, ok := a.count(k, now); !ok {
+			t.Fatalf("request #%d is over the quota", ix)
+		}
+	}
+
+	retryAfter, ok := a.count(k, now)
+	if ok {
+		t.Fatal("request over the quota is allowed")
+	}
+	if retryAfter != 6*time.Hour {
+		t.Errorf("retry after %v, want till midnight UTC", retryAfter)
+	}
+
+	// Other keys have their own quotas
+	if _, ok := a.count(&apikeys.Key{Id: 2, DailyQuota: 1}, now); !ok {
+		t.Error("request of the other key is over the quota")
+	}
+
+	// Usage is reset the next day
+	if _, ok := a.count(k, now.Add(6*time.Hour)); !ok {
+		t.Error("request of the next day is over the quota")
+	}
+
+	want := map[usageKey]int{
+		{id: 1, day: "2026-10-18"}: 2,
+		{id: 2, day: "2026-10-18"}: 1,
+		{id: 1, day: "2026-10-19"}: 1,
+	}
+	if !reflect.DeepEqual(a.pending, want) {
+		t.Errorf("pending = %v, want %v", a.pending, want)
+	}
+}
+
+func TestAPIKeysQuotaResponse(t *testing.T) {
+	fake := newFakeKeys(map[string]*apikeys.Key{
+		"bk_valid": {Id: 1, RatePerMinute: 600, DailyQuota: 1},
+	})
+	a := NewAPIKeys(fake, &response.Responder{}, 0)
+
+	if w := serveWithKeys(a, "bk_valid", ""); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w := serveWithKeys(a, "bk_valid", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After is missing")
+	}
+}
+
+func TestAPIKeysFlush(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fake := newFakeKeys(nil)
+	a := NewAPIKeys(fake, &response.Responder{}, 0)
+	k := &apikeys.Key{Id: 1, DailyQuota: 10}
+
+	now := time.Now().UTC()
+	for range 2 {
+		a.count(k, now)
+	}
+
+	// The other instances served 7 requests with the key
+	fake.others[1] = 7
+	a.Flush(context.Background(), l)
+
+	if want := []map[uint32]int{{1: 2}}; !reflect.DeepEqual(fake.added, want) {
+		t.Errorf("added usage %v, want %v", fake.added, want)
+	}
+	if a.used[1] != 9 {
+		t.Errorf("used = %d, want the total of 9", a.used[1])
+	}
+
+	// Nothing is added again
+	a.Flush(context.Background(), l)
+	if len(fake.added) != 1 {
+		t.Errorf("added usage %v, want no more", fake.added[1:])
+	}
+
+	if _, ok := a.count(k, now); !ok {
+		t.Error("10th request is over the quota")
+	}
+	if _, ok := a.count(k, now); ok {
+		t.Error("11th request is allowed")
+	}
+
+	// Failed flush is retried with the next one
+	fake.failAdds = true
+	a.Flush(context.Background(), l)
+
+	a.count(&apikeys.Key{Id: 2, DailyQuota: 10}, now)
+
+	fake.failAdds = false
+	a.Flush(context.Background(), l)
+
+	if want := []map[uint32]int{{1: 2}, {1: 1, 2: 1}}; !reflect.DeepEqual(fake.added, want) {
+		t.Errorf("added usage %v, want %v", fake.added, want)
+	}
+	if len(a.pending) != 0 {
+		t.Errorf("pending = %v after the flush, want none", a.pending)
+	}
+}
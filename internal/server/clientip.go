@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIP resolves the address of the client for the rate limits. Requests from the trusted proxies
+// are attributed to the address before them in X-Forwarded-For, the header is ignored otherwise
+func ClientIP(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedFor(remoteAddr(r), r.Header.Values("X-Forwarded-For"), trustedProxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+		})
+	}
+}
+
+// clientIP is the address resolved by ClientIP, or the connected one
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(netip.Addr); ok {
+		return ip.String()
+	}
+
+	if ip := remoteAddr(r); ip.IsValid() {
+		return ip.String()
+	}
+
+	return r.RemoteAddr
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip, _ := netip.ParseAddr(host)
+	return ip.Unmap()
+}
+
+// forwardedFor walks the proxies from the closest one, and returns the first address not trusted.
+// Each proxy appends the address it got the request from, so the ones before the untrusted may be forged
+func forwardedFor(remote netip.Addr, headers []string, trusted []netip.Prefix) netip.Addr {
+	var hops []string
+	for _, h := range headers {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	ip := remote
+	for i := len(hops) - 1; i >= 0 && isTrusted(ip, trusted); i-- {
+		hop := strings.TrimSpace(hops[i])
+
+		prev, err := netip.ParseAddr(hop)
+		if err != nil {
+			ap, err := netip.ParseAddrPort(hop)
+			if err != nil {
+				break
+			}
+			prev = ap.Addr()
+		}
+
+		ip = prev.Unmap()
+	}
+
+	return ip
+}
+
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
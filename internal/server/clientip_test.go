@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedFor(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers []string
+		want    string
+	}{
+		{
+			name:   "no header",
+			remote: "10.0.0.1",
+			want:   "10.0.0.1",
+		},
+		{
+			name:    "untrusted remote",
+			remote:  "203.0.113.1",
+			headers: []string{"198.51.100.1"},
+			want:    "203.0.113.1",
+		},
+		{
+			name:    "trusted proxy",
+			remote:  "10.0.0.1",
+			headers: []string{"198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "chain of trusted proxies",
+			remote:  "10.0.0.1",
+			headers: []string{"198.51.100.1, 10.0.0.3", "10.0.0.2"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "forged hops before the client",
+			remote:  "10.0.0.1",
+			headers: []string{"10.1.1.1, 192.0.2.1, 198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "only trusted hops",
+			remote:  "10.0.0.1",
+			headers: []string{"10.0.0.3, 10.0.0.2"},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "address with port",
+			remote:  "10.0.0.1",
+			headers: []string{"198.51.100.1:4321"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "ipv6 with port",
+			remote:  "fd00::1",
+			headers: []string{"[2001:db8::1]:4321"},
+			want:    "2001:db8::1",
+		},
+		{
+			name:    "ipv4-mapped ipv6",
+			remote:  "10.0.0.1",
+			headers: []string{"::ffff:198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "garbage stops the walk",
+			remote:  "10.0.0.1",
+			headers: []string{"198.51.100.1, unknown, 10.0.0.2"},
+			want:    "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := forwardedFor(netip.MustParseAddr(tt.remote), tt.headers, trusted)
+			if got.String() != tt.want {
+				t.Errorf("forwardedFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		want       string
+	}{
+		{name: "remote with port", remoteAddr: "203.0.113.1:1234", want: "203.0.113.1"},
+		{name: "mapped remote", remoteAddr: "[::ffff:203.0.113.1]:1234", want: "203.0.113.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", header: "198.51.100.1", want: "198.51.100.1"},
+		{name: "untrusted proxy", remoteAddr: "203.0.113.1:1234", header: "198.51.100.1", want: "203.0.113.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := ClientIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				r.Header.Set("X-Forwarded-For", tt.header)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("clientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"books/internal/response"
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/series"
+	"books/internal/types"
+)
+
+// How many related entities are embedded into the details, like books of the series.
+// The rest are cut off, as documented in openapi.yaml
+const detailsLimit = 1000
+
+type seriesPosition struct {
+	*types.Series
+	Order uint16 `json:"order"`
+}
+
+func bookDetails(ar authors.Repository, br books.Repository, sr series.Repository,
+	rr *response.Responder) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		book, err := br.GetById(r.Context(), getId(r))
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		if book == nil {
+			rr.RespondAndLogError(w, r.Context(), response.NotFound("book not found"))
+			return
+		}
+
+		as, err := ar.GetByIds(r.Context(), book.Authors...)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		seriesIds := make([]string, 0, len(book.Series))
+		for _, s := range book.Series {
+			seriesIds = append(seriesIds, s.Id)
+		}
+
+		ss, err := sr.GetByIds(r.Context(), seriesIds...)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		bookAuthors := make([]*types.Author, 0, len(book.Authors))
+		for _, authorId := range book.Authors {
+			if a, ok := as[authorId]; ok {
+				bookAuthors = append(bookAuthors, a)
+			}
+		}
+
+		bookSeries := make([]seriesPosition, 0, len(book.Series))
+		for _, s := range book.Series {
+			if ser, ok := ss[s.Id]; ok {
+				bookSeries = append(bookSeries, seriesPosition{Series: ser, Order: s.Order})
+			}
+		}
+
+		updated := []time.Time{book.UpdatedAt}
+		for _, a := range bookAuthors {
+			updated = append(updated, a.UpdatedAt)
+		}
+		for _, s := range bookSeries {
+			updated = append(updated, s.UpdatedAt)
+		}
+		response.SetLastModified(w, updated...)
+
+		rr.SendJson(w, r, struct {
+			*types.Book
+			Authors []*types.Author  `json:"authors"`
+			Series  []seriesPosition `json:"series"`
+		}{
+			Book:    book,
+			Authors: bookAuthors,
+			Series:  bookSeries,
+		})
+	}
+}
+
+func authorDetails(ar authors.Repository, br books.Repository, sr series.Repository,
+	rr *response.Responder) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		author, err := ar.GetById(r.Context(), getId(r))
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		if author == nil {
+			rr.RespondAndLogError(w, r.Context(), response.NotFound("author not found"))
+			return
+		}
+
+		filter := books.Filter{AuthorIds: []string{author.Id}}
+
+		// Books of a single author are few enough to always count them exactly
+		numBooks, _, err := br.Count(r.Context(), filter, math.MaxInt)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		facets, err := br.Facets(r.Context(), filter, books.FacetGenre)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		genreCounts := facets[books.FacetGenre]
+		if genreCounts == nil {
+			genreCounts = make([]books.FacetValue, 0)
+		}
+
+		ss, err := sr.Search(r.Context(), "", filter, detailsLimit, 0)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		if ss == nil {
+			ss = make([]*types.Series, 0)
+		}
+
+		// Authors of the same books, including this one
+		as, err := ar.Search(r.Context(), "", filter, detailsLimit+1, 0)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		// Counts and genres only change with the books
+		booksUpdated, err := br.LastUpdated(r.Context(), filter)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		updated := []time.Time{booksUpdated}
+
+		coauthors := make([]*types.Author, 0, len(as))
+		for _, a := range as {
+			updated = append(updated, a.UpdatedAt)
+			if a.Id != author.Id {
+				coauthors = append(coauthors, a)
+			}
+		}
+		for _, s := range ss {
+			updated = append(updated, s.UpdatedAt)
+		}
+		response.SetLastModified(w, append(updated, author.UpdatedAt)...)
+
+		rr.SendJson(w, r, struct {
+			*types.Author
+			NumBooks  int                `json:"num_books"`
+			Genres    []books.FacetValue `json:"genres"`
+			Series    []*types.Series    `json:"series"`
+			Coauthors []*types.Author    `json:"coauthors"`
+		}{
+			Author:    author,
+			NumBooks:  numBooks,
+			Genres:    genreCounts,
+			Series:    ss,
+			Coauthors: coauthors,
+		})
+	}
+}
+
+func seriesDetails(ar authors.Repository, br books.Repository, sr series.Repository,
+	rr *response.Responder) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ser, err := sr.GetById(r.Context(), getId(r))
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		if ser == nil {
+			rr.RespondAndLogError(w, r.Context(), response.NotFound("series not found"))
+			return
+		}
+
+		rows, _, err := br.Search(r.Context(), books.Filter{SeriesIds: []string{ser.Id}}, books.SortSeriesOrder,
+			books.Page{Limit: detailsLimit})
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		bks := make([]*types.Book, 0, len(rows))
+		for _, row := range rows {
+			bks = append(bks, row.Book)
+		}
+
+		seriesAuthors, err := authorsOf(r.Context(), bks, ar)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		updated := []time.Time{ser.UpdatedAt}
+		for _, b := range bks {
+			updated = append(updated, b.UpdatedAt)
+		}
+		for _, a := range seriesAuthors {
+			updated = append(updated, a.UpdatedAt)
+		}
+		response.SetLastModified(w, updated...)
+
+		rr.SendJson(w, r, struct {
+			*types.Series
+			Books   []*types.Book   `json:"books"`
+			Authors []*types.Author `json:"authors"`
+		}{
+			Series:  ser,
+			Books:   bks,
+			Authors: seriesAuthors,
+		})
+	}
+}
+
+// authorsOf loads authors of the books in order of their first appearance
+func authorsOf(ctx context.Context, bks []*types.Book, ar authors.Repository) ([]*types.Author, error) {
+	var authorIds []string
+	seenAuthor := make(map[string]struct{})
+
+	for _, book := range bks {
+		for _, authorId := range book.Authors {
+			if _, ok := seenAuthor[authorId]; !ok {
+				seenAuthor[authorId] = struct{}{}
+				authorIds = append(authorIds, authorId)
+			}
+		}
+	}
+
+	as, err := ar.GetByIds(ctx, authorIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*types.Author, 0, len(authorIds))
+	for _, authorId := range authorIds {
+		if a, ok := as[authorId]; ok {
+			ret = append(ret, a)
+		}
+	}
+
+	return ret, nil
+}
+
+func getId(r *http.Request) string {
+	id := chi.URLParam(r, "id")
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+
+	return id
+}
@@ -0,0 +1,875 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/graph-gophers/graphql-go"
+
+	"books/internal/response"
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/genres"
+	"books/internal/storage/series"
+	"books/internal/types"
+)
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+const (
+	graphqlMaxDepth       = 10
+	graphqlMaxQueryLength = 10000
+	// How many entities and searches a single request may resolve, see gqlCharge
+	graphqlMaxComplexity = 5000
+	// Max value of limit arguments
+	graphqlMaxLimit = 100
+)
+
+var gqlSortTypes = map[string]books.SortType{
+	"TITLE":         books.SortTitle,
+	"YEAR":          books.SortYear,
+	"YEAR_DESC":     books.SortYearDesc,
+	"AUTHOR":        books.SortAuthor,
+	"SERIES_ORDER":  books.SortSeriesOrder,
+	"ADDED_AT":      books.SortAddedAt,
+	"ADDED_AT_DESC": books.SortAddedAtDesc,
+	"RELEVANCE":     books.SortRelevance,
+}
+
+type gqlLoadersKey struct{}
+
+// gqlLoaders live for the single request. They gather ids requested by the resolvers running in parallel
+// and load them with the single GetByIds call. Lists of the related entities are gathered the same way,
+// so that each level of the query costs one search instead of one per parent
+type gqlLoaders struct {
+	authors  *dataloader.Loader[string, *types.Author]
+	series   *dataloader.Loader[string, *types.Series]
+	genreIds *dataloader.Loader[string, uint16]
+
+	authorBooks   *dataloader.Loader[gqlEachKey, books.Listed]
+	genreBooks    *dataloader.Loader[gqlEachKey, books.Listed]
+	seriesBooks   *dataloader.Loader[gqlEachKey, books.Listed]
+	authorSeries  *dataloader.Loader[gqlEachKey, []*types.Series]
+	seriesAuthors *dataloader.Loader[gqlEachKey, []*types.Author]
+
+	// Complexity left for the request
+	budget atomic.Int64
+}
+
+// gqlEachKey is the parent of the list and the arguments of the field. Parents with the same arguments
+// are loaded together
+type gqlEachKey struct {
+	id     string
+	sort   books.SortType
+	limit  int
+	offset int
+	after  string
+}
+
+func newGqlLoaders(ar authors.Repository, br books.Repository, gr genres.Repository,
+	sr series.Repository) *gqlLoaders {
+
+	booksOf := func(link books.Link) dataloader.BatchFunc[gqlEachKey, books.Listed] {
+		return batchEach(func(ctx context.Context, ids []string, args gqlEachKey) (map[string]books.Listed, error) {
+			return br.SearchEach(ctx, link, ids, args.sort, books.Page{Limit: args.limit, Cursor: args.after})
+		})
+	}
+
+	l := &gqlLoaders{
+		authors:  dataloader.NewBatchedLoader(batchByIds(ar.GetByIds)),
+		series:   dataloader.NewBatchedLoader(batchByIds(sr.GetByIds)),
+		genreIds: dataloader.NewBatchedLoader(batchByIds(gr.GetIdByTitles)),
+
+		authorBooks: dataloader.NewBatchedLoader(booksOf(books.LinkAuthor)),
+		genreBooks:  dataloader.NewBatchedLoader(booksOf(books.LinkGenre)),
+		seriesBooks: dataloader.NewBatchedLoader(booksOf(books.LinkSeries)),
+		authorSeries: dataloader.NewBatchedLoader(batchEach(
+			func(ctx context.Context, ids []string, args gqlEachKey) (map[string][]*types.Series, error) {
+				return sr.ByAuthors(ctx, ids, args.limit, args.offset)
+			})),
+		seriesAuthors: dataloader.NewBatchedLoader(batchEach(
+			func(ctx context.Context, ids []string, args gqlEachKey) (map[string][]*types.Author, error) {
+				return ar.BySeries(ctx, ids, args.limit, args.offset)
+			})),
+	}
+	l.budget.Store(graphqlMaxComplexity)
+
+	return l
+}
+
+// batchByIds adapts GetByIds-like method to the loader, missing entities are loaded as zero values
+func batchByIds[K comparable, V any](get func(ctx context.Context, keys ...K) (map[K]V, error)) dataloader.BatchFunc[K, V] {
+	return func(ctx context.Context, keys []K) []*dataloader.Result[V] {
+		m, err := get(ctx, keys...)
+
+		ret := make([]*dataloader.Result[V], 0, len(keys))
+		for _, key := range keys {
+			if err != nil {
+				ret = append(ret, &dataloader.Result[V]{Error: err})
+			} else {
+				ret = append(ret, &dataloader.Result[V]{Data: m[key]})
+			}
+		}
+
+		return ret
+	}
+}
+
+// batchEach adapts SearchEach-like method to the loader, calling it once for all the parents with the same
+// arguments. Parents without entities are loaded as zero values
+func batchEach[V any](get func(ctx context.Context, ids []string, args gqlEachKey) (map[string]V, error),
+) dataloader.BatchFunc[gqlEachKey, V] {
+
+	return func(ctx context.Context, keys []gqlEachKey) []*dataloader.Result[V] {
+		byArgs := make(map[gqlEachKey][]string)
+		for _, key := range keys {
+			args := key
+			args.id = ""
+			byArgs[args] = append(byArgs[args], key.id)
+		}
+
+		loaded := make(map[gqlEachKey]map[string]V, len(byArgs))
+		errs := make(map[gqlEachKey]error)
+		for args, ids := range byArgs {
+			loaded[args], errs[args] = get(ctx, ids, args)
+		}
+
+		ret := make([]*dataloader.Result[V], 0, len(keys))
+		for _, key := range keys {
+			args := key
+			args.id = ""
+
+			if err := errs[args]; err != nil {
+				ret = append(ret, &dataloader.Result[V]{Error: err})
+			} else {
+				ret = append(ret, &dataloader.Result[V]{Data: loaded[args][key.id]})
+			}
+		}
+
+		return ret
+	}
+}
+
+func gqlLoadersFrom(ctx context.Context) *gqlLoaders {
+	return ctx.Value(gqlLoadersKey{}).(*gqlLoaders)
+}
+
+// gqlCharge takes n from the complexity budget of the request. Each search costs 1, and each resolved entity
+// costs 1 more, so that wide nested queries are stopped before they load the whole catalog
+func gqlCharge(ctx context.Context, n int) error {
+	if gqlLoadersFrom(ctx).budget.Add(-int64(n)) < 0 {
+		return fmt.Errorf("query is too complex, it may resolve at most %d entities and searches", graphqlMaxComplexity)
+	}
+
+	return nil
+}
+
+func checkLimit(limit int32) error {
+	if limit < 1 || limit > graphqlMaxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", graphqlMaxLimit)
+	}
+
+	return nil
+}
+
+func checkOffset(offset int32) error {
+	if offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+
+	return nil
+}
+
+func graphqlHandler(ar authors.Repository, br books.Repository, gr genres.Repository, sr series.Repository,
+	rr *response.Responder) http.HandlerFunc {
+
+	root := &gqlRoot{ar: ar, br: br, gr: gr, sr: sr, rr: rr, qr: &queryResolver{ar: ar, gr: gr, sr: sr}}
+	schema := graphql.MustParseSchema(graphqlSchema, root,
+		graphql.MaxDepth(graphqlMaxDepth),
+		graphql.MaxQueryLength(graphqlMaxQueryLength),
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+
+		if r.Method == http.MethodGet {
+			q := r.URL.Query()
+			params.Query = q.Get("query")
+			params.OperationName = q.Get("operationName")
+
+			if vars := q.Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &params.Variables); err != nil {
+					rr.RespondAndLogError(w, r.Context(), response.BadRequest(fmt.Errorf("invalid variables: %w", err)))
+					return
+				}
+			}
+		} else {
+			d := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*graphqlMaxQueryLength))
+			if err := d.Decode(&params); err != nil {
+				rr.RespondAndLogError(w, r.Context(), response.BadRequest(fmt.Errorf("invalid request body: %w", err)))
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), gqlLoadersKey{}, newGqlLoaders(ar, br, gr, sr))
+		rr.SendJson(w, r, schema.Exec(ctx, params.Query, params.OperationName, params.Variables))
+	}
+}
+
+type gqlRoot struct {
+	ar authors.Repository
+	br books.Repository
+	gr genres.Repository
+	sr series.Repository
+	rr *response.Responder
+	qr *queryResolver
+}
+
+// fail passes errors caused by the request as is, and hides the rest like Responder does
+func (q *gqlRoot) fail(ctx context.Context, err error) error {
+	if qe := new(QueryError); errors.As(err, &qe) || errors.Is(err, books.ErrInvalidCursor) {
+		return err
+	}
+
+	errId := uuid.NewString()
+	slog.ErrorContext(ctx, err.Error(), slog.String("err_id", errId))
+
+	if q.rr.DebugMode {
+		return err
+	}
+
+	return errors.New("unknown error occurred while processing your request. Error ID: " + errId)
+}
+
+func (q *gqlRoot) Book(ctx context.Context, args struct{ ID graphql.ID }) (*gqlBook, error) {
+	if err := gqlCharge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	b, err := q.br.GetById(ctx, string(args.ID))
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if b == nil {
+		return nil, nil
+	}
+
+	return &gqlBook{root: q, b: b}, nil
+}
+
+func (q *gqlRoot) Author(ctx context.Context, args struct{ ID graphql.ID }) (*gqlAuthor, error) {
+	as, err := q.authors(ctx, []string{string(args.ID)})
+	if err != nil || len(as) == 0 {
+		return nil, err
+	}
+
+	return as[0], nil
+}
+
+func (q *gqlRoot) Series(ctx context.Context, args struct{ ID graphql.ID }) (*gqlSeries, error) {
+	ss, err := q.series(ctx, []string{string(args.ID)})
+	if err != nil || len(ss) == 0 {
+		return nil, err
+	}
+
+	return ss[0], nil
+}
+
+func (q *gqlRoot) Genres(ctx context.Context) ([]*gqlGenre, error) {
+	titles, err := q.gr.GetAll(ctx)
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if err := gqlCharge(ctx, len(titles)); err != nil {
+		return nil, err
+	}
+
+	ret := make([]*gqlGenre, 0, len(titles))
+	for _, title := range titles {
+		ret = append(ret, &gqlGenre{root: q, title: title})
+	}
+
+	return ret, nil
+}
+
+type gqlBookFilter struct {
+	Query     *string
+	Title     *string
+	AuthorIds *[]graphql.ID
+	Genres    *[]string
+	SeriesIds *[]graphql.ID
+	Languages *[]string
+	YearMin   *int32
+	YearMax   *int32
+	HasCover  *bool
+	HasSeries *bool
+}
+
+func (q *gqlRoot) SearchBooks(ctx context.Context, args struct {
+	Filter *gqlBookFilter
+	Sort   string
+	Limit  int32
+	After  *string
+}) (*gqlBookConnection, error) {
+
+	var filter books.Filter
+
+	if f := args.Filter; f != nil {
+		var err error
+
+		if f.Query != nil {
+			filter, err = q.qr.filter(ctx, *f.Query)
+			if err != nil {
+				return nil, q.fail(ctx, err)
+			}
+		}
+
+		if f.Title != nil {
+			filter.Titles = append(filter.Titles, *f.Title)
+		}
+
+		if f.AuthorIds != nil {
+			for _, id := range *f.AuthorIds {
+				filter.AuthorIds = append(filter.AuthorIds, string(id))
+			}
+		}
+
+		if f.Genres != nil {
+			ids, err := q.gr.GetIdByTitles(ctx, *f.Genres...)
+			if err != nil {
+				return nil, q.fail(ctx, err)
+			}
+
+			// Titles match case-insensitively, as in REST
+			lowerIds := make(map[string]uint16, len(ids))
+			for title, id := range ids {
+				lowerIds[strings.ToLower(title)] = id
+			}
+
+			for _, title := range *f.Genres {
+				id, ok := lowerIds[strings.ToLower(title)]
+				if !ok {
+					return nil, fmt.Errorf("unknown genre %q", title)
+				}
+				filter.GenreIds = append(filter.GenreIds, id)
+			}
+		}
+
+		if f.SeriesIds != nil {
+			for _, id := range *f.SeriesIds {
+				filter.SeriesIds = append(filter.SeriesIds, string(id))
+			}
+		}
+
+		if f.Languages != nil {
+			filter.Languages = append(filter.Languages, *f.Languages...)
+		}
+
+		for _, year := range []*int32{f.YearMin, f.YearMax} {
+			if year != nil && (*year < 0 || *year > 0xffff) {
+				return nil, fmt.Errorf("invalid year %d", *year)
+			}
+		}
+
+		if f.YearMin != nil {
+			filter.YearMin = uint16(*f.YearMin)
+		}
+
+		if f.YearMax != nil {
+			filter.YearMax = uint16(*f.YearMax)
+		}
+
+		filter.HasCover = f.HasCover
+		filter.HasSeries = f.HasSeries
+	}
+
+	return q.books(ctx, filter, args.Sort, args.Limit, args.After)
+}
+
+func (q *gqlRoot) SearchAuthors(ctx context.Context, args struct {
+	Search string
+	Limit  int32
+	Offset int32
+}) ([]*gqlAuthor, error) {
+
+	return q.searchAuthors(ctx, args.Search, books.Filter{}, args.Limit, args.Offset)
+}
+
+func (q *gqlRoot) SearchSeries(ctx context.Context, args struct {
+	Search string
+	Limit  int32
+	Offset int32
+}) ([]*gqlSeries, error) {
+
+	return q.searchSeries(ctx, args.Search, books.Filter{}, args.Limit, args.Offset)
+}
+
+func (q *gqlRoot) books(ctx context.Context, filter books.Filter, sort string, limit int32,
+	after *string) (*gqlBookConnection, error) {
+
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	if err := gqlCharge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	page := books.Page{Limit: int(limit)}
+	if after != nil {
+		page.Cursor = *after
+	}
+
+	rows, next, err := q.br.Search(ctx, filter, gqlSortTypes[sort], page)
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if err := gqlCharge(ctx, len(rows)); err != nil {
+		return nil, err
+	}
+
+	ret := &gqlBookConnection{books: make([]*gqlBook, 0, len(rows)), next: next}
+	for _, row := range rows {
+		ret.books = append(ret.books, &gqlBook{root: q, b: row.Book})
+	}
+
+	return ret, nil
+}
+
+// booksOf lists books of the author, genre or series through the request loader
+func (q *gqlRoot) booksOf(ctx context.Context, loader *dataloader.Loader[gqlEachKey, books.Listed], id string,
+	sort string, limit int32, after *string) (*gqlBookConnection, error) {
+
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	if err := gqlCharge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	key := gqlEachKey{id: id, sort: gqlSortTypes[sort], limit: int(limit)}
+	if after != nil {
+		key.after = *after
+	}
+
+	listed, err := loader.Load(ctx, key)()
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if err := gqlCharge(ctx, len(listed.Books)); err != nil {
+		return nil, err
+	}
+
+	ret := &gqlBookConnection{books: make([]*gqlBook, 0, len(listed.Books)), next: listed.Next}
+	for _, b := range listed.Books {
+		ret.books = append(ret.books, &gqlBook{root: q, b: b})
+	}
+
+	return ret, nil
+}
+
+// loadEach loads list related to the parent through the request loader
+func loadEach[V any](ctx context.Context, q *gqlRoot, loader *dataloader.Loader[gqlEachKey, []V], id string,
+	limit, offset int32) ([]V, error) {
+
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	if err := checkOffset(offset); err != nil {
+		return nil, err
+	}
+
+	if err := gqlCharge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	ret, err := loader.Load(ctx, gqlEachKey{id: id, limit: int(limit), offset: int(offset)})()
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if err := gqlCharge(ctx, len(ret)); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (q *gqlRoot) searchAuthors(ctx context.Context, search string, filter books.Filter,
+	limit, offset int32) ([]*gqlAuthor, error) {
+
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	if err := checkOffset(offset); err != nil {
+		return nil, err
+	}
+
+	if err := gqlCharge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	as, err := q.ar.Search(ctx, search, filter, int(limit), int(offset))
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if err := gqlCharge(ctx, len(as)); err != nil {
+		return nil, err
+	}
+
+	ret := make([]*gqlAuthor, 0, len(as))
+	for _, a := range as {
+		ret = append(ret, &gqlAuthor{root: q, a: a})
+	}
+
+	return ret, nil
+}
+
+func (q *gqlRoot) searchSeries(ctx context.Context, search string, filter books.Filter,
+	limit, offset int32) ([]*gqlSeries, error) {
+
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	if err := checkOffset(offset); err != nil {
+		return nil, err
+	}
+
+	if err := gqlCharge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	ss, err := q.sr.Search(ctx, search, filter, int(limit), int(offset))
+	if err != nil {
+		return nil, q.fail(ctx, err)
+	}
+
+	if err := gqlCharge(ctx, len(ss)); err != nil {
+		return nil, err
+	}
+
+	ret := make([]*gqlSeries, 0, len(ss))
+	for _, s := range ss {
+		ret = append(ret, &gqlSeries{root: q, s: s})
+	}
+
+	return ret, nil
+}
+
+// authors loads authors through the request loader, skipping unknown ids
+func (q *gqlRoot) authors(ctx context.Context, ids []string) ([]*gqlAuthor, error) {
+	if err := gqlCharge(ctx, len(ids)); err != nil {
+		return nil, err
+	}
+
+	as, errs := gqlLoadersFrom(ctx).authors.LoadMany(ctx, ids)()
+	for _, err := range errs {
+		if err != nil {
+			return nil, q.fail(ctx, err)
+		}
+	}
+
+	ret := make([]*gqlAuthor, 0, len(as))
+	for _, a := range as {
+		if a != nil {
+			ret = append(ret, &gqlAuthor{root: q, a: a})
+		}
+	}
+
+	return ret, nil
+}
+
+// series loads series through the request loader, skipping unknown ids
+func (q *gqlRoot) series(ctx context.Context, ids []string) ([]*gqlSeries, error) {
+	if err := gqlCharge(ctx, len(ids)); err != nil {
+		return nil, err
+	}
+
+	ss, errs := gqlLoadersFrom(ctx).series.LoadMany(ctx, ids)()
+	for _, err := range errs {
+		if err != nil {
+			return nil, q.fail(ctx, err)
+		}
+	}
+
+	ret := make([]*gqlSeries, 0, len(ss))
+	for _, s := range ss {
+		if s != nil {
+			ret = append(ret, &gqlSeries{root: q, s: s})
+		}
+	}
+
+	return ret, nil
+}
+
+type gqlBookConnection struct {
+	books []*gqlBook
+	next  string
+}
+
+func (c *gqlBookConnection) Books() []*gqlBook {
+	return c.books
+}
+
+func (c *gqlBookConnection) NextCursor() *string {
+	return optional(c.next)
+}
+
+type gqlBook struct {
+	root *gqlRoot
+	b    *types.Book
+}
+
+func (b *gqlBook) ID() graphql.ID {
+	return graphql.ID(b.b.Id)
+}
+
+func (b *gqlBook) Title() string {
+	return b.b.Title
+}
+
+func (b *gqlBook) Authors(ctx context.Context) ([]*gqlAuthor, error) {
+	return b.root.authors(ctx, b.b.Authors)
+}
+
+func (b *gqlBook) Series(ctx context.Context) ([]*gqlBookInSeries, error) {
+	ids := make([]string, 0, len(b.b.Series))
+	for _, s := range b.b.Series {
+		ids = append(ids, s.Id)
+	}
+
+	ss, err := b.root.series(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make(map[string]uint16, len(b.b.Series))
+	for _, s := range b.b.Series {
+		order[s.Id] = s.Order
+	}
+
+	ret := make([]*gqlBookInSeries, 0, len(ss))
+	for _, s := range ss {
+		ret = append(ret, &gqlBookInSeries{series: s, order: order[s.s.Id]})
+	}
+
+	return ret, nil
+}
+
+func (b *gqlBook) Genres() []*gqlGenre {
+	ret := make([]*gqlGenre, 0, len(b.b.Genres))
+	for _, title := range b.b.Genres {
+		ret = append(ret, &gqlGenre{root: b.root, title: title})
+	}
+
+	return ret
+}
+
+func (b *gqlBook) Language() string {
+	return b.b.Language
+}
+
+func (b *gqlBook) Year() *int32 {
+	if b.b.Year == 0 {
+		return nil
+	}
+
+	year := int32(b.b.Year)
+	return &year
+}
+
+func (b *gqlBook) About() *string {
+	return optional(b.b.About)
+}
+
+func (b *gqlBook) CoverUrl() *string {
+	return optional(b.b.Cover)
+}
+
+func (b *gqlBook) Files() []*gqlBookFile {
+	ret := make([]*gqlBookFile, 0, len(b.b.Files))
+	for ix := range b.b.Files {
+		ret = append(ret, &gqlBookFile{f: &b.b.Files[ix]})
+	}
+
+	return ret
+}
+
+func (b *gqlBook) AddedAt() graphql.Time {
+	return graphql.Time{Time: b.b.AddedAt}
+}
+
+type gqlBookInSeries struct {
+	series *gqlSeries
+	order  uint16
+}
+
+func (s *gqlBookInSeries) Series() *gqlSeries {
+	return s.series
+}
+
+func (s *gqlBookInSeries) Order() int32 {
+	return int32(s.order)
+}
+
+type gqlBookFile struct {
+	f *types.BookFile
+}
+
+func (f *gqlBookFile) Format() string {
+	return f.f.Format
+}
+
+func (f *gqlBookFile) Type() *string {
+	return optional(f.f.Type)
+}
+
+func (f *gqlBookFile) Url() string {
+	return f.f.Url
+}
+
+type gqlAuthor struct {
+	root *gqlRoot
+	a    *types.Author
+}
+
+func (a *gqlAuthor) ID() graphql.ID {
+	return graphql.ID(a.a.Id)
+}
+
+func (a *gqlAuthor) Name() string {
+	return a.a.Name
+}
+
+func (a *gqlAuthor) Bio() *string {
+	return optional(a.a.Bio)
+}
+
+func (a *gqlAuthor) AvatarUrl() *string {
+	return optional(a.a.Avatar)
+}
+
+func (a *gqlAuthor) Books(ctx context.Context, args struct {
+	Sort  string
+	Limit int32
+	After *string
+}) (*gqlBookConnection, error) {
+
+	return a.root.booksOf(ctx, gqlLoadersFrom(ctx).authorBooks, a.a.Id, args.Sort, args.Limit, args.After)
+}
+
+func (a *gqlAuthor) Series(ctx context.Context, args struct {
+	Limit  int32
+	Offset int32
+}) ([]*gqlSeries, error) {
+
+	ss, err := loadEach(ctx, a.root, gqlLoadersFrom(ctx).authorSeries, a.a.Id, args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*gqlSeries, 0, len(ss))
+	for _, s := range ss {
+		ret = append(ret, &gqlSeries{root: a.root, s: s})
+	}
+
+	return ret, nil
+}
+
+type gqlSeries struct {
+	root *gqlRoot
+	s    *types.Series
+}
+
+func (s *gqlSeries) ID() graphql.ID {
+	return graphql.ID(s.s.Id)
+}
+
+func (s *gqlSeries) Title() string {
+	return s.s.Title
+}
+
+func (s *gqlSeries) Books(ctx context.Context, args struct {
+	Limit int32
+	After *string
+}) (*gqlBookConnection, error) {
+
+	return s.root.booksOf(ctx, gqlLoadersFrom(ctx).seriesBooks, s.s.Id, "SERIES_ORDER", args.Limit, args.After)
+}
+
+func (s *gqlSeries) Authors(ctx context.Context, args struct {
+	Limit  int32
+	Offset int32
+}) ([]*gqlAuthor, error) {
+
+	as, err := loadEach(ctx, s.root, gqlLoadersFrom(ctx).seriesAuthors, s.s.Id, args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*gqlAuthor, 0, len(as))
+	for _, a := range as {
+		ret = append(ret, &gqlAuthor{root: s.root, a: a})
+	}
+
+	return ret, nil
+}
+
+type gqlGenre struct {
+	root  *gqlRoot
+	title string
+}
+
+func (g *gqlGenre) Title() string {
+	return g.title
+}
+
+func (g *gqlGenre) Books(ctx context.Context, args struct {
+	Sort  string
+	Limit int32
+	After *string
+}) (*gqlBookConnection, error) {
+
+	id, err := gqlLoadersFrom(ctx).genreIds.Load(ctx, g.title)()
+	if err != nil {
+		return nil, g.root.fail(ctx, err)
+	}
+
+	if id == 0 {
+		return &gqlBookConnection{books: make([]*gqlBook, 0)}, nil
+	}
+
+	return g.root.booksOf(ctx, gqlLoadersFrom(ctx).genreBooks, strconv.Itoa(int(id)), args.Sort, args.Limit, args.After)
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -17,10 +19,15 @@ import (
 	"books/internal/types"
 )
 
+// Handler serves the API, the middlewares run before the validation and see the paths relative to it
 func Handler(ar authors.Repository, br books.Repository, gr genres.Repository, sr series.Repository,
-	rr *response.Responder) http.Handler {
+	rr *response.Responder, v *Validator, middlewares ...func(http.Handler) http.Handler) http.Handler {
 
 	r := chi.NewRouter()
+	r.Use(middlewares...)
+	r.Use(v.Middleware(rr))
+
+	qr := &queryResolver{ar: ar, gr: gr, sr: sr}
 
 	r.Get("/genres", func(w http.ResponseWriter, r *http.Request) {
 		rows, err := gr.GetAll(r.Context())
@@ -33,7 +40,7 @@ func Handler(ar authors.Repository, br books.Repository, gr genres.Repository, s
 			rows = make([]string, 0)
 		}
 
-		rr.SendJson(w, r.Context(), struct {
+		rr.SendJson(w, r, struct {
 			Titles []string `json:"titles"`
 		}{Titles: rows})
 	})
@@ -41,139 +48,403 @@ func Handler(ar authors.Repository, br books.Repository, gr genres.Repository, s
 	r.Get("/authors", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
-		rows, err := ar.Search(r.Context(), q.Get("search"),
-			getGenreIds(r.Context(), q, gr),
-			getIntOrDefault("limit", q, 10),
-		)
+		filter, err := getBookConditions(r.Context(), q, gr)
+		if err != nil {
+			respondSearchError(w, r.Context(), rr, err)
+			return
+		}
+
+		page := getPage(q, 10, v.maxLimit)
 
+		// One more row tells whether there is the next page
+		rows, err := ar.Search(r.Context(), q.Get("search"), filter, page.Limit+1, page.Offset)
 		if err != nil {
 			rr.RespondAndLogError(w, r.Context(), err)
 			return
 		}
 
-		rr.SendJson(w, r.Context(), struct {
+		total, exact, err := ar.Count(r.Context(), q.Get("search"), filter, exactCountUpTo)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		more := len(rows) > page.Limit
+		if more {
+			rows = rows[:page.Limit]
+		}
+
+		rr.SendJson(w, r, struct {
 			Authors []*types.Author `json:"authors"`
-		}{Authors: rows})
+			pagination
+		}{
+			Authors:    rows,
+			pagination: getPagination(r, page, total, exact, more, ""),
+		})
 	})
 
 	r.Get("/series", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
-		rows, err := sr.Search(r.Context(), q.Get("search"),
-			q.Get("author"), getGenreIds(r.Context(), q, gr),
-			getIntOrDefault("limit", q, 10),
-		)
+		filter, err := getBookConditions(r.Context(), q, gr)
+		if err != nil {
+			respondSearchError(w, r.Context(), rr, err)
+			return
+		}
+
+		page := getPage(q, 10, v.maxLimit)
 
+		// One more row tells whether there is the next page
+		rows, err := sr.Search(r.Context(), q.Get("search"), filter, page.Limit+1, page.Offset)
 		if err != nil {
 			rr.RespondAndLogError(w, r.Context(), err)
 			return
 		}
 
+		total, exact, err := sr.Count(r.Context(), q.Get("search"), filter, exactCountUpTo)
+		if err != nil {
+			rr.RespondAndLogError(w, r.Context(), err)
+			return
+		}
+
+		more := len(rows) > page.Limit
+		if more {
+			rows = rows[:page.Limit]
+		}
+
 		if rows == nil {
 			rows = make([]*types.Series, 0)
 		}
 
-		rr.SendJson(w, r.Context(), struct {
+		rr.SendJson(w, r, struct {
 			Sequences []*types.Series `json:"sequences"`
-		}{Sequences: rows})
+			pagination
+		}{
+			Sequences:  rows,
+			pagination: getPagination(r, page, total, exact, more, ""),
+		})
 	})
 
 	r.Get("/books", func(w http.ResponseWriter, r *http.Request) {
+		_, res, err := searchBooks(r, ar, br, gr, sr, qr, v.maxLimit)
+		if err != nil {
+			respondSearchError(w, r.Context(), rr, err)
+			return
+		}
+
+		rr.SendJson(w, r, res)
+	})
+
+	r.Get("/search", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
-		var groupings []books.GroupingType
-		for _, t := range getMulti("group", q) {
-			groupings = append(groupings, books.GroupingType(t))
+		filter, res, err := searchBooks(r, ar, br, gr, sr, qr, v.maxLimit)
+		if err != nil {
+			respondSearchError(w, r.Context(), rr, err)
+			return
 		}
 
-		rows, err := br.Search(r.Context(), q.Get("search"),
-			q.Get("author"), getGenreIds(r.Context(), q, gr), q.Get("series"),
-			uint16(getIntOrDefault("year_min", q, 0)),
-			uint16(getIntOrDefault("year_max", q, 0)),
-			getIntOrDefault("limit", q, 20), getIntOrDefault("offset", q, 0),
-			groupings...)
+		// Search term is matched against names of authors and series instead of book titles
+		search := strings.Join(filter.Titles, " ")
+		related := filter
+		related.Titles = nil
 
+		as, err := ar.Search(r.Context(), search, related,
+			getLimit("authors_limit", q, 5, v.maxLimit), 0)
 		if err != nil {
 			rr.RespondAndLogError(w, r.Context(), err)
 			return
 		}
 
-		var authorIds []string
-		seenAuthor := make(map[string]struct{})
-		var seriesIds []string
-		seenSeries := make(map[string]struct{})
-
-		for _, row := range rows {
-			for _, authorId := range row.Book.Authors {
-				if _, ok := seenAuthor[authorId]; !ok {
-					seenAuthor[authorId] = struct{}{}
-					authorIds = append(authorIds, authorId)
-				}
-			}
-			for _, s := range row.Book.Series {
-				if _, ok := seenSeries[s.Id]; !ok {
-					seenSeries[s.Id] = struct{}{}
-					seriesIds = append(seriesIds, s.Id)
-				}
-			}
+		if as == nil {
+			as = make([]*types.Author, 0)
 		}
 
-		as, err := ar.GetByIds(r.Context(), authorIds...)
+		ss, err := sr.Search(r.Context(), search, related,
+			getLimit("series_limit", q, 5, v.maxLimit), 0)
 		if err != nil {
 			rr.RespondAndLogError(w, r.Context(), err)
 			return
 		}
 
-		ss, err := sr.GetByIds(r.Context(), seriesIds...)
+		if ss == nil {
+			ss = make([]*types.Series, 0)
+		}
+
+		facets, err := br.Facets(r.Context(), filter, getFacetTypes(q)...)
 		if err != nil {
 			rr.RespondAndLogError(w, r.Context(), err)
 			return
 		}
 
-		if rows == nil {
-			rows = make([]books.BookInGroup, 0)
-		}
-
-		rr.SendJson(w, r.Context(), struct {
-			Books   []books.BookInGroup      `json:"books"`
-			Authors map[string]*types.Author `json:"authors"`
-			Series  map[string]*types.Series `json:"series"`
+		rr.SendJson(w, r, struct {
+			booksPage
+			MatchingAuthors []*types.Author                        `json:"matching_authors"`
+			MatchingSeries  []*types.Series                        `json:"matching_series"`
+			Facets          map[books.FacetType][]books.FacetValue `json:"facets"`
 		}{
-			Books:   rows,
-			Authors: as,
-			Series:  ss,
+			booksPage:       res,
+			MatchingAuthors: as,
+			MatchingSeries:  ss,
+			Facets:          facets,
 		})
 	})
 
+	r.Get("/books/{id}", bookDetails(ar, br, sr, rr))
+	r.Get("/authors/{id}", authorDetails(ar, br, sr, rr))
+	r.Get("/series/{id}", seriesDetails(ar, br, sr, rr))
+
+	gql := graphqlHandler(ar, br, gr, sr, rr)
+	r.Get("/graphql", gql)
+	r.Post("/graphql", gql)
+
 	return r
 }
 
-func Static(r chi.Router, openApiYaml, webDir string) {
-	r.Get("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, openApiYaml)
-	})
+type booksPage struct {
+	Books   []books.BookInGroup      `json:"books"`
+	Authors map[string]*types.Author `json:"authors"`
+	Series  map[string]*types.Series `json:"series"`
+	// Empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	pagination
+}
 
-	for _, filename := range []string{"/rapidoc.html", "/redocly.html", "/swagger-ui.html", "/scalar.html"} {
-		r.Get(filename, func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, webDir+filename)
-		})
+// Totals are counted exactly up to this number, planner estimate is used above it
+const exactCountUpTo = 10000
+
+type pagination struct {
+	Total      int  `json:"total"`
+	TotalExact bool `json:"total_exact"`
+	Offset     int  `json:"offset"`
+	// Link to the next page, nil on the last one
+	Next *string `json:"next"`
+}
+
+// getPagination builds link to the next page from the current request. It uses cursor
+// if the request did, and offset otherwise. API key is dropped, so that it is not leaked with the link
+func getPagination(r *http.Request, page books.Page, total int, exact, more bool, nextCursor string) pagination {
+	p := pagination{
+		Total:      total,
+		TotalExact: exact,
+		Offset:     page.Offset,
+	}
+
+	if !more {
+		return p
+	}
+
+	u := *r.URL
+	q := u.Query()
+	q.Del(APIKeyParam)
+
+	if page.Cursor != "" && nextCursor != "" {
+		q.Set("cursor", nextCursor)
+		q.Del("offset")
+	} else {
+		q.Set("offset", strconv.Itoa(page.Offset+page.Limit))
+	}
+
+	u.RawQuery = q.Encode()
+	next := u.String()
+	p.Next = &next
+
+	return p
+}
+
+// searchBooks finds the page of books by the filter, sort, groupings and pagination of the request
+func searchBooks(r *http.Request, ar authors.Repository, br books.Repository, gr genres.Repository,
+	sr series.Repository, qr *queryResolver, maxLimit int) (books.Filter, booksPage, error) {
+
+	q := r.URL.Query()
+
+	filter, err := getBooksFilter(r.Context(), q, gr, qr)
+	if err != nil {
+		return filter, booksPage{}, err
+	}
+
+	page := getPage(q, 20, maxLimit)
+	groupings := getGroupings(q)
+
+	rows, next, err := br.Search(r.Context(), filter, books.SortType(q.Get("sort")), page, groupings...)
+	if err != nil {
+		return filter, booksPage{}, err
+	}
+
+	total, exact, err := br.Count(r.Context(), filter, exactCountUpTo, groupings...)
+	if err != nil {
+		return filter, booksPage{}, err
 	}
+
+	res, err := withRelated(r.Context(), rows, next, ar, sr)
+	if err != nil {
+		return filter, booksPage{}, err
+	}
+
+	res.pagination = getPagination(r, page, total, exact, next != "", next)
+
+	return filter, res, nil
 }
 
-func getGenreIds(ctx context.Context, q url.Values, gr genres.Repository) []uint16 {
-	var genreIds []uint16
+// withRelated loads authors and series referenced by the found books
+func withRelated(ctx context.Context, rows []books.BookInGroup, next string,
+	ar authors.Repository, sr series.Repository) (booksPage, error) {
+
+	var authorIds []string
+	seenAuthor := make(map[string]struct{})
+	var seriesIds []string
+	seenSeries := make(map[string]struct{})
 
-	genres_ := getMulti("genre", q)
-	if len(genres_) > 0 {
-		gs, err := gr.GetIdByTitles(ctx, genres_...)
-		if err == nil && len(gs) > 0 {
-			for _, genreId := range gs {
-				genreIds = append(genreIds, genreId)
+	for _, row := range rows {
+		for _, authorId := range row.Book.Authors {
+			if _, ok := seenAuthor[authorId]; !ok {
+				seenAuthor[authorId] = struct{}{}
+				authorIds = append(authorIds, authorId)
 			}
 		}
+		for _, s := range row.Book.Series {
+			if _, ok := seenSeries[s.Id]; !ok {
+				seenSeries[s.Id] = struct{}{}
+				seriesIds = append(seriesIds, s.Id)
+			}
+		}
+	}
+
+	as, err := ar.GetByIds(ctx, authorIds...)
+	if err != nil {
+		return booksPage{}, err
+	}
+
+	ss, err := sr.GetByIds(ctx, seriesIds...)
+	if err != nil {
+		return booksPage{}, err
+	}
+
+	if rows == nil {
+		rows = make([]books.BookInGroup, 0)
+	}
+
+	return booksPage{
+		Books:      rows,
+		Authors:    as,
+		Series:     ss,
+		NextCursor: next,
+	}, nil
+}
+
+// getGenreIds resolves genre titles in the key param, unknown titles are reported as invalid parameter
+func getGenreIds(ctx context.Context, key string, q url.Values, gr genres.Repository) ([]uint16, error) {
+	genres_ := getMulti(key, q)
+	if len(genres_) == 0 {
+		return nil, nil
+	}
+
+	gs, err := gr.GetIdByTitles(ctx, genres_...)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{}, len(gs))
+	genreIds := make([]uint16, 0, len(gs))
+	for title, genreId := range gs {
+		found[strings.ToLower(title)] = struct{}{}
+		genreIds = append(genreIds, genreId)
+	}
+
+	for _, title := range genres_ {
+		if _, ok := found[strings.ToLower(title)]; !ok {
+			return nil, response.NewInvalidParam(key, fmt.Sprintf("unknown genre %q", title))
+		}
+	}
+
+	return genreIds, nil
+}
+
+// getBooksFilter builds filter either from the structured query in q param, or from the separate params
+func getBooksFilter(ctx context.Context, q url.Values, gr genres.Repository, qr *queryResolver) (books.Filter, error) {
+	if query := strings.TrimSpace(q.Get("q")); query != "" {
+		return qr.filter(ctx, query)
+	}
+
+	f, err := getBookConditions(ctx, q, gr)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	if search := strings.TrimSpace(q.Get("search")); search != "" {
+		f.Titles = []string{search}
+	}
+
+	if seriesId := strings.TrimSpace(q.Get("series")); seriesId != "" {
+		f.SeriesIds = []string{seriesId}
 	}
 
-	return genreIds
+	return f, nil
+}
+
+// getBookConditions builds filter from params common to books, authors and series search
+func getBookConditions(ctx context.Context, q url.Values, gr genres.Repository) (books.Filter, error) {
+	genreIds, err := getGenreIds(ctx, "genre", q, gr)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	excludeGenreIds, err := getGenreIds(ctx, "exclude_genre", q, gr)
+	if err != nil {
+		return books.Filter{}, err
+	}
+
+	return books.Filter{
+		AuthorIds:       getMulti("author", q),
+		AllAuthors:      strings.ToLower(q.Get("author_match")) == "all",
+		GenreIds:        genreIds,
+		ExcludeGenreIds: excludeGenreIds,
+		Languages:       getMulti("language", q),
+		YearMin:         uint16(getIntOrDefault("year_min", q, 0)),
+		YearMax:         uint16(getIntOrDefault("year_max", q, 0)),
+		HasCover:        getBoolOrNil("has_cover", q),
+		HasSeries:       getBoolOrNil("has_series", q),
+	}, nil
+}
+
+// respondSearchError responds with 400 naming the param for errors caused by the request, with 500 otherwise
+func respondSearchError(w http.ResponseWriter, ctx context.Context, rr *response.Responder, err error) {
+	if qe := new(QueryError); errors.As(err, &qe) {
+		err = response.NewInvalidParam("q", err.Error())
+	} else if errors.Is(err, books.ErrInvalidCursor) {
+		err = response.NewInvalidParam("cursor", err.Error())
+	}
+
+	rr.RespondAndLogError(w, ctx, err)
+}
+
+func getPage(q url.Values, defaultLimit, maxLimit int) books.Page {
+	return books.Page{
+		Limit:  getLimit("limit", q, defaultLimit, maxLimit),
+		Offset: getIntOrDefault("offset", q, 0),
+		Cursor: strings.TrimSpace(q.Get("cursor")),
+	}
+}
+
+func getGroupings(q url.Values) []books.GroupingType {
+	var groupings []books.GroupingType
+	for _, t := range getMulti("group", q) {
+		groupings = append(groupings, books.GroupingType(t))
+	}
+
+	return groupings
+}
+
+// fallbackMaxLimit is the maximum of the limits in openapi.yaml, used when max limit is not configured
+const fallbackMaxLimit = 100
+
+// getLimit clamps the limit param to [1, maxLimit]. Zero limit would mean no limit at all for the repositories
+func getLimit(key string, q url.Values, default_, maxLimit int) int {
+	if maxLimit <= 0 {
+		maxLimit = fallbackMaxLimit
+	}
+
+	return min(max(getIntOrDefault(key, q, default_), 1), maxLimit)
 }
 
 func getIntOrDefault(key string, q url.Values, default_ int) int {
@@ -187,6 +458,31 @@ func getIntOrDefault(key string, q url.Values, default_ int) int {
 	return default_
 }
 
+func getBoolOrNil(key string, q url.Values) *bool {
+	if bs := q.Get(key); bs != "" {
+		b, err := strconv.ParseBool(bs)
+		if err == nil {
+			return &b
+		}
+	}
+
+	return nil
+}
+
+// getFacetTypes returns the requested facets, all of them by default
+func getFacetTypes(q url.Values) []books.FacetType {
+	var facetTypes []books.FacetType
+	for _, t := range getMulti("facet", q) {
+		facetTypes = append(facetTypes, books.FacetType(t))
+	}
+
+	if len(facetTypes) == 0 {
+		return []books.FacetType{books.FacetGenre, books.FacetLanguage, books.FacetDecade, books.FacetFormat}
+	}
+
+	return facetTypes
+}
+
 func getMulti(key string, q url.Values) []string {
 	raw, ok := q[key]
 	if !ok {
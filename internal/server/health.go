@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"books/internal/response"
+)
+
+// ReadinessCheck fails while the server can not handle requests, like without database
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Health mounts /healthz, telling that the process is alive, and /readyz, running the checks in order
+func Health(r chi.Router, rr *response.Responder, checks ...ReadinessCheck) {
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		rr.SendJson(w, r, map[string]string{"status": "ok"})
+	})
+
+	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range checks {
+			if err := c.Check(r.Context()); err != nil {
+				e := response.UpstreamUnavailable(fmt.Errorf("%s: %w", c.Name, err))
+				e.Detail = c.Name + " is not ready"
+				rr.RespondAndLogError(w, r.Context(), e)
+				return
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		rr.SendJson(w, r, map[string]string{"status": "ok"})
+	})
+}
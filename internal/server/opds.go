@@ -0,0 +1,521 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"books/internal/response"
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/genres"
+	"books/internal/storage/series"
+	"books/internal/types"
+)
+
+// OPDS 1.2 catalog, see https://specs.opds.io/opds-1.2
+const (
+	opdsRoot = "/opds"
+	// Feed entries per page
+	opdsPageSize = 50
+	// Authors drill-down lists authors once the prefix narrows them down to this many
+	opdsAuthorsPerPrefix = 100
+
+	opdsTypeNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsTypeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsTypeOpenSearch  = "application/opensearchdescription+xml"
+	opdsTypeFeed        = "application/atom+xml; charset=utf-8"
+
+	opdsRelImage       = "http://opds-spec.org/image"
+	opdsRelThumbnail   = "http://opds-spec.org/image/thumbnail"
+	opdsRelAcquisition = "http://opds-spec.org/acquisition/open-access"
+	opdsRelNew         = "http://opds-spec.org/sort/new"
+
+	opdsIdPrefix = "tag:opds:"
+)
+
+type opdsFeed struct {
+	XMLName         xml.Name `xml:"feed"`
+	Xmlns           string   `xml:"xmlns,attr"`
+	XmlnsDc         string   `xml:"xmlns:dc,attr"`
+	XmlnsOpenSearch string   `xml:"xmlns:opensearch,attr"`
+	XmlnsThr        string   `xml:"xmlns:thr,attr"`
+
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated time.Time   `xml:"updated"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	// Number of items behind the navigation link
+	Count int `xml:"thr:count,attr,omitempty"`
+}
+
+type opdsAuthor struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type opdsCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type opdsContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type opdsEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    time.Time      `xml:"updated"`
+	Authors    []opdsAuthor   `xml:"author"`
+	Categories []opdsCategory `xml:"category"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Content    *opdsContent   `xml:"content"`
+	Links      []opdsLink     `xml:"link"`
+}
+
+type opdsOpenSearch struct {
+	XMLName        xml.Name `xml:"OpenSearchDescription"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	ShortName      string   `xml:"ShortName"`
+	Description    string   `xml:"Description"`
+	InputEncoding  string   `xml:"InputEncoding"`
+	OutputEncoding string   `xml:"OutputEncoding"`
+	Url            struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+// newOpdsFeed dates the feed by the last update of its content, so that the same content is sent
+// with the same ETag
+func newOpdsFeed(r *http.Request, id, title, kind string, updated time.Time) *opdsFeed {
+	return &opdsFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDc:         "http://purl.org/dc/terms/",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		XmlnsThr:        "http://purl.org/syndication/thread/1.0",
+		Id:              opdsIdPrefix + id,
+		Title:           title,
+		Updated:         updated.UTC().Truncate(time.Second),
+		Links: []opdsLink{
+			{Rel: "self", Href: r.URL.String(), Type: kind},
+			{Rel: "start", Href: opdsRoot, Type: opdsTypeNavigation},
+			{Rel: "search", Href: opdsRoot + "/opensearch.xml", Type: opdsTypeOpenSearch},
+		},
+	}
+}
+
+// newOpdsNavigation makes navigation feed, dated by the last update of the books
+func newOpdsNavigation(r *http.Request, br books.Repository, id, title string) (*opdsFeed, error) {
+	updated, err := br.LastUpdated(r.Context(), books.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return newOpdsFeed(r, id, title, opdsTypeNavigation, updated), nil
+}
+
+// addNext links the next page of the feed, replacing the query param key with val
+func (f *opdsFeed) addNext(r *http.Request, key, val string) {
+	u := *r.URL
+	q := u.Query()
+	q.Set(key, val)
+	u.RawQuery = q.Encode()
+
+	f.Links = append(f.Links, opdsLink{Rel: "next", Href: u.String(), Type: f.Links[0].Type})
+}
+
+func (f *opdsFeed) addNavigation(id, title, href, kind string, count int) {
+	f.Entries = append(f.Entries, opdsEntry{
+		Id:      opdsIdPrefix + id,
+		Title:   title,
+		Updated: f.Updated,
+		Links:   []opdsLink{{Rel: "subsection", Href: href, Type: kind, Count: count}},
+	})
+}
+
+// MountOPDS serves the catalog as OPDS 1.2 feeds for e-book readers
+func MountOPDS(r chi.Router, ar authors.Repository, br books.Repository, gr genres.Repository, sr series.Repository,
+	rr *response.Responder) {
+
+	qr := &queryResolver{ar: ar, gr: gr, sr: sr}
+
+	r.Route(opdsRoot, func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			f, err := newOpdsNavigation(r, br, "root", "Books")
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			f.addNavigation("new", "New arrivals", opdsRoot+"/new", opdsTypeAcquisition, 0)
+			f.addNavigation("authors", "Authors", opdsRoot+"/authors", opdsTypeNavigation, 0)
+			f.addNavigation("series", "Series", opdsRoot+"/series", opdsTypeNavigation, 0)
+			f.addNavigation("genres", "Genres", opdsRoot+"/genres", opdsTypeNavigation, 0)
+			f.Entries[0].Links[0].Rel = opdsRelNew
+
+			rr.SendXml(w, r, opdsTypeFeed, f)
+		})
+
+		r.Get("/opensearch.xml", func(w http.ResponseWriter, r *http.Request) {
+			d := opdsOpenSearch{
+				Xmlns:     "http://a9.com/-/spec/opensearch/1.1/",
+				ShortName: "Books",
+				Description: "Search books by title. Supports query syntax, like " +
+					`author:"Name" genre:Title series:Title lang:en year:1960..1970 -word`,
+				InputEncoding:  "UTF-8",
+				OutputEncoding: "UTF-8",
+			}
+			d.Url.Type = opdsTypeAcquisition
+			d.Url.Template = opdsRoot + "/search?q={searchTerms}"
+
+			rr.SendXml(w, r, "application/opensearchdescription+xml; charset=utf-8", d)
+		})
+
+		r.Get("/search", func(w http.ResponseWriter, r *http.Request) {
+			query := strings.TrimSpace(r.URL.Query().Get("q"))
+			if query == "" {
+				rr.RespondAndLogError(w, r.Context(), response.NewInvalidParam("q", "search terms are required"))
+				return
+			}
+
+			filter, err := qr.filter(r.Context(), query)
+			if err != nil {
+				respondSearchError(w, r.Context(), rr, err)
+				return
+			}
+
+			sendOpdsBooks(w, r, "search:"+query, "Search: "+query, filter, books.SortRelevance, ar, br, sr, rr)
+		})
+
+		r.Get("/new", func(w http.ResponseWriter, r *http.Request) {
+			sendOpdsBooks(w, r, "new", "New arrivals", books.Filter{}, books.SortAddedAtDesc, ar, br, sr, rr)
+		})
+
+		r.Get("/authors", func(w http.ResponseWriter, r *http.Request) {
+			opdsAuthors(w, r, ar, br, rr)
+		})
+
+		r.Get("/authors/{id}", func(w http.ResponseWriter, r *http.Request) {
+			author, err := ar.GetById(r.Context(), getId(r))
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if author == nil {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("author not found"))
+				return
+			}
+
+			sendOpdsBooks(w, r, author.Id, author.Name, books.Filter{AuthorIds: []string{author.Id}}, books.SortTitle,
+				ar, br, sr, rr)
+		})
+
+		r.Get("/series", func(w http.ResponseWriter, r *http.Request) {
+			offset := max(getIntOrDefault("offset", r.URL.Query(), 0), 0)
+
+			ss, err := sr.Search(r.Context(), "", books.Filter{}, opdsPageSize+1, offset)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			f, err := newOpdsNavigation(r, br, "series", "Series")
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if len(ss) > opdsPageSize {
+				ss = ss[:opdsPageSize]
+				f.addNext(r, "offset", strconv.Itoa(offset+opdsPageSize))
+			}
+
+			for _, s := range ss {
+				f.addNavigation(s.Id, s.Title, opdsRoot+"/series/"+url.PathEscape(s.Id), opdsTypeAcquisition, 0)
+			}
+
+			rr.SendXml(w, r, opdsTypeFeed, f)
+		})
+
+		r.Get("/series/{id}", func(w http.ResponseWriter, r *http.Request) {
+			s, err := sr.GetById(r.Context(), getId(r))
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if s == nil {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("series not found"))
+				return
+			}
+
+			sendOpdsBooks(w, r, s.Id, s.Title, books.Filter{SeriesIds: []string{s.Id}}, books.SortSeriesOrder,
+				ar, br, sr, rr)
+		})
+
+		r.Get("/genres", func(w http.ResponseWriter, r *http.Request) {
+			titles, err := gr.GetAll(r.Context())
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			ids, err := gr.GetIdByTitles(r.Context(), titles...)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			f, err := newOpdsNavigation(r, br, "genres", "Genres")
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			for _, title := range titles {
+				if id, ok := ids[title]; ok {
+					idStr := strconv.Itoa(int(id))
+					f.addNavigation("genre:"+idStr, title, opdsRoot+"/genres/"+idStr, opdsTypeAcquisition, 0)
+				}
+			}
+
+			rr.SendXml(w, r, opdsTypeFeed, f)
+		})
+
+		r.Get("/genres/{id}", func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 16)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("genre not found"))
+				return
+			}
+
+			title, err := gr.GetById(r.Context(), uint16(id))
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if title == "" {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("genre not found"))
+				return
+			}
+
+			sendOpdsBooks(w, r, "genre:"+strconv.Itoa(int(id)), title, books.Filter{GenreIds: []uint16{uint16(id)}},
+				books.SortAddedAtDesc, ar, br, sr, rr)
+		})
+	})
+}
+
+// opdsAuthors drills down authors by the first letters of their names, until there are few enough to list them
+func opdsAuthors(w http.ResponseWriter, r *http.Request, ar authors.Repository, br books.Repository,
+	rr *response.Responder) {
+
+	q := r.URL.Query()
+	prefix := strings.ToUpper(q.Get("prefix"))
+	offset := max(getIntOrDefault("offset", q, 0), 0)
+
+	title := "Authors"
+	if prefix != "" {
+		title += ": " + prefix + "…"
+	}
+	f, err := newOpdsNavigation(r, br, "authors:"+prefix, title)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	prefixes, as, more, err := authorsDrillDown(r.Context(), ar, prefix, offset, opdsPageSize)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	for _, p := range prefixes {
+		f.addNavigation("authors:"+p.Prefix, p.Prefix+"…", opdsRoot+"/authors?prefix="+url.QueryEscape(p.Prefix),
+			opdsTypeNavigation, p.Count)
+	}
+
+	for _, a := range as {
+		f.addNavigation(a.Id, a.Name, opdsRoot+"/authors/"+url.PathEscape(a.Id), opdsTypeAcquisition, 0)
+	}
+
+	if more {
+		f.addNext(r, "offset", strconv.Itoa(offset+opdsPageSize))
+	}
+
+	rr.SendXml(w, r, opdsTypeFeed, f)
+}
+
+// authorsDrillDown splits authors with names starting with the prefix by the next letter, or, once there
+// are few enough of them, returns the page of the authors instead
+func authorsDrillDown(ctx context.Context, ar authors.Repository, prefix string,
+	offset, pageSize int) (prefixes []authors.PrefixCount, as []*types.Author, more bool, err error) {
+
+	prefixes, err = ar.NamePrefixes(ctx, prefix, utf8.RuneCountInString(prefix)+1)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	total := 0
+	// Names equal to the prefix can not be narrowed down by the longer one
+	narrower := false
+	for _, p := range prefixes {
+		total += p.Count
+		if p.Prefix != prefix {
+			narrower = true
+		}
+	}
+
+	if prefix == "" || (total > opdsAuthorsPerPrefix && narrower) {
+		return prefixes, nil, false, nil
+	}
+
+	as, err = ar.ByNamePrefix(ctx, prefix, pageSize+1, offset)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if len(as) > pageSize {
+		return nil, as[:pageSize], true, nil
+	}
+
+	return nil, as, false, nil
+}
+
+// sendOpdsBooks sends acquisition feed with the page of books, paginated by cursor.
+// The feed is dated by the last update of the books matching the filter
+func sendOpdsBooks(w http.ResponseWriter, r *http.Request, id, title string, filter books.Filter, sort books.SortType,
+	ar authors.Repository, br books.Repository, sr series.Repository, rr *response.Responder) {
+
+	page := books.Page{Limit: opdsPageSize, Cursor: strings.TrimSpace(r.URL.Query().Get("cursor"))}
+
+	rows, next, err := br.Search(r.Context(), filter, sort, page)
+	if err != nil {
+		respondSearchError(w, r.Context(), rr, err)
+		return
+	}
+
+	res, err := withRelated(r.Context(), rows, next, ar, sr)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	updated, err := br.LastUpdated(r.Context(), filter)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	f := newOpdsFeed(r, id, title, opdsTypeAcquisition, updated)
+	if next != "" {
+		f.addNext(r, "cursor", next)
+	}
+
+	for _, row := range res.Books {
+		f.Entries = append(f.Entries, opdsBookEntry(row.Book, res.Authors, res.Series))
+	}
+
+	rr.SendXml(w, r, opdsTypeFeed, f)
+}
+
+func opdsBookEntry(book *types.Book, as map[string]*types.Author, ss map[string]*types.Series) opdsEntry {
+
+	e := opdsEntry{
+		Id:       book.Id,
+		Title:    book.Title,
+		Updated:  book.UpdatedAt.UTC().Truncate(time.Second),
+		Language: book.Language,
+	}
+
+	if book.Year != 0 {
+		e.Issued = strconv.Itoa(int(book.Year))
+	}
+
+	if book.About != "" {
+		e.Content = &opdsContent{Type: "html", Text: book.About}
+	}
+
+	for _, authorId := range book.Authors {
+		if a, ok := as[authorId]; ok {
+			href := opdsRoot + "/authors/" + url.PathEscape(a.Id)
+			e.Authors = append(e.Authors, opdsAuthor{Name: a.Name, Uri: href})
+			e.Links = append(e.Links, opdsLink{
+				Rel:   "related",
+				Href:  href,
+				Type:  opdsTypeAcquisition,
+				Title: "All books of " + a.Name,
+			})
+		}
+	}
+
+	for _, s := range book.Series {
+		if ser, ok := ss[s.Id]; ok {
+			e.Links = append(e.Links, opdsLink{
+				Rel:   "related",
+				Href:  opdsRoot + "/series/" + url.PathEscape(ser.Id),
+				Type:  opdsTypeAcquisition,
+				Title: "Series " + ser.Title,
+			})
+		}
+	}
+
+	for _, genre := range book.Genres {
+		e.Categories = append(e.Categories, opdsCategory{Term: genre, Label: genre})
+	}
+
+	if book.Cover != "" {
+		e.Links = append(e.Links,
+			opdsLink{Rel: opdsRelImage, Href: book.Cover, Type: imageType(book.Cover)},
+			opdsLink{Rel: opdsRelThumbnail, Href: book.Cover, Type: imageType(book.Cover)},
+		)
+	}
+
+	for _, file := range book.Files {
+		typ := file.Type
+		if typ == "" {
+			typ = "application/octet-stream"
+		}
+
+		e.Links = append(e.Links, opdsLink{Rel: opdsRelAcquisition, Href: file.Url, Type: typ, Title: file.Format})
+	}
+
+	return e
+}
+
+// imageType guesses the image type by extension of the link
+func imageType(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	switch ext := strings.ToLower(u.Path[strings.LastIndexByte(u.Path, '.')+1:]); ext {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "png", "gif", "webp":
+		return "image/" + ext
+	}
+
+	return ""
+}
@@ -0,0 +1,382 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/opds-community/libopds2-go/opds2"
+
+	"books/internal/response"
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/genres"
+	"books/internal/storage/series"
+	"books/internal/types"
+)
+
+// OPDS 2.0 catalog, see https://drafts.opds.io/opds-2.0
+const (
+	opds2Root = "/opds2"
+	// Publications per page
+	opds2PageSize = 50
+	// Most popular genres shown as facets
+	opds2GenreFacets = 30
+
+	opds2Type         = "application/opds+json"
+	opds2TypeResponse = "application/opds+json; charset=utf-8"
+)
+
+func newOpds2Feed(r *http.Request, title string) *opds2.Feed {
+	f := opds2.New(title)
+	f.AddLink(r.URL.String(), "self", opds2Type, false)
+	f.AddLink(opds2Root, "start", opds2Type, false)
+	f.AddLink(opds2Root+"/search{?query}", "search", opds2Type, true)
+
+	return &f
+}
+
+// MountOPDS2 serves the catalog as OPDS 2.0 feeds for e-book readers
+func MountOPDS2(r chi.Router, ar authors.Repository, br books.Repository, gr genres.Repository, sr series.Repository,
+	rr *response.Responder) {
+
+	qr := &queryResolver{ar: ar, gr: gr, sr: sr}
+
+	r.Route(opds2Root, func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			f := newOpds2Feed(r, "Books")
+
+			f.AddNavigation("New arrivals", opds2Root+"/new", "http://opds-spec.org/sort/new", opds2Type)
+			f.AddNavigation("Authors", opds2Root+"/authors", "subsection", opds2Type)
+			f.AddNavigation("Series", opds2Root+"/series", "subsection", opds2Type)
+			f.AddNavigation("Genres", opds2Root+"/genres", "subsection", opds2Type)
+
+			rr.SendJsonAs(w, r, opds2TypeResponse, f)
+		})
+
+		r.Get("/search", func(w http.ResponseWriter, r *http.Request) {
+			query := strings.TrimSpace(r.URL.Query().Get("query"))
+			if query == "" {
+				rr.RespondAndLogError(w, r.Context(), response.NewInvalidParam("query", "search terms are required"))
+				return
+			}
+
+			filter, err := qr.filter(r.Context(), query)
+			if err != nil {
+				respondSearchError(w, r.Context(), rr, err)
+				return
+			}
+
+			f := newOpds2Feed(r, "Search: "+query)
+			sendOpds2Books(w, r, f, filter, books.SortRelevance, ar, br, gr, sr, rr)
+		})
+
+		r.Get("/new", func(w http.ResponseWriter, r *http.Request) {
+			f := newOpds2Feed(r, "New arrivals")
+			sendOpds2Books(w, r, f, books.Filter{}, books.SortAddedAtDesc, ar, br, gr, sr, rr)
+		})
+
+		r.Get("/authors", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			prefix := strings.ToUpper(q.Get("prefix"))
+			offset := max(getIntOrDefault("offset", q, 0), 0)
+
+			prefixes, as, more, err := authorsDrillDown(r.Context(), ar, prefix, offset, opds2PageSize)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			title := "Authors"
+			if prefix != "" {
+				title += ": " + prefix + "…"
+			}
+			f := newOpds2Feed(r, title)
+
+			for _, p := range prefixes {
+				f.AddNavigation(p.Prefix+"…", opds2Root+"/authors?prefix="+url.QueryEscape(p.Prefix),
+					"subsection", opds2Type)
+				f.Navigation[len(f.Navigation)-1].Properties = &opds2.Properties{NumberOfItems: p.Count}
+			}
+
+			for _, a := range as {
+				f.AddNavigation(a.Name, opds2Root+"/authors/"+url.PathEscape(a.Id), "subsection", opds2Type)
+			}
+
+			if more {
+				f.AddLink(withParam(r, "offset", strconv.Itoa(offset+opds2PageSize)), "next", opds2Type, false)
+			}
+
+			rr.SendJsonAs(w, r, opds2TypeResponse, f)
+		})
+
+		r.Get("/authors/{id}", func(w http.ResponseWriter, r *http.Request) {
+			author, err := ar.GetById(r.Context(), getId(r))
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if author == nil {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("author not found"))
+				return
+			}
+
+			f := newOpds2Feed(r, author.Name)
+			sendOpds2Books(w, r, f, books.Filter{AuthorIds: []string{author.Id}}, books.SortTitle, ar, br, gr, sr, rr)
+		})
+
+		r.Get("/series", func(w http.ResponseWriter, r *http.Request) {
+			offset := max(getIntOrDefault("offset", r.URL.Query(), 0), 0)
+
+			ss, err := sr.Search(r.Context(), "", books.Filter{}, opds2PageSize+1, offset)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			f := newOpds2Feed(r, "Series")
+			if len(ss) > opds2PageSize {
+				ss = ss[:opds2PageSize]
+				f.AddLink(withParam(r, "offset", strconv.Itoa(offset+opds2PageSize)), "next", opds2Type, false)
+			}
+
+			for _, s := range ss {
+				f.AddNavigation(s.Title, opds2Root+"/series/"+url.PathEscape(s.Id), "subsection", opds2Type)
+			}
+
+			rr.SendJsonAs(w, r, opds2TypeResponse, f)
+		})
+
+		r.Get("/series/{id}", func(w http.ResponseWriter, r *http.Request) {
+			s, err := sr.GetById(r.Context(), getId(r))
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if s == nil {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("series not found"))
+				return
+			}
+
+			f := newOpds2Feed(r, s.Title)
+			sendOpds2Books(w, r, f, books.Filter{SeriesIds: []string{s.Id}}, books.SortSeriesOrder, ar, br, gr, sr, rr)
+		})
+
+		r.Get("/genres", func(w http.ResponseWriter, r *http.Request) {
+			titles, err := gr.GetAll(r.Context())
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			ids, err := gr.GetIdByTitles(r.Context(), titles...)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			f := newOpds2Feed(r, "Genres")
+			for _, title := range titles {
+				if id, ok := ids[title]; ok {
+					f.AddNavigation(title, opds2Root+"/genres/"+strconv.Itoa(int(id)), "subsection", opds2Type)
+				}
+			}
+
+			rr.SendJsonAs(w, r, opds2TypeResponse, f)
+		})
+
+		r.Get("/genres/{id}", func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 16)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("genre not found"))
+				return
+			}
+
+			title, err := gr.GetById(r.Context(), uint16(id))
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			if title == "" {
+				rr.RespondAndLogError(w, r.Context(), response.NotFound("genre not found"))
+				return
+			}
+
+			f := newOpds2Feed(r, title)
+			sendOpds2Books(w, r, f, books.Filter{GenreIds: []uint16{uint16(id)}}, books.SortAddedAtDesc,
+				ar, br, gr, sr, rr)
+		})
+	})
+}
+
+// sendOpds2Books fills publications feed with the page of books. The filter is narrowed down by the language
+// and genre params, which are offered as facets. Pages are numbered, so that readers can jump to any of them
+func sendOpds2Books(w http.ResponseWriter, r *http.Request, f *opds2.Feed, filter books.Filter, sort books.SortType,
+	ar authors.Repository, br books.Repository, gr genres.Repository, sr series.Repository, rr *response.Responder) {
+
+	q := r.URL.Query()
+
+	facets, err := br.Facets(r.Context(), filter, books.FacetLanguage, books.FacetGenre)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	addOpds2Facets(r, f, "Language", "language", facets[books.FacetLanguage], len(facets[books.FacetLanguage]))
+	addOpds2Facets(r, f, "Genre", "genre", facets[books.FacetGenre], opds2GenreFacets)
+
+	filter.Languages = append(filter.Languages, getMulti("language", q)...)
+	genreIds, err := getGenreIds(r.Context(), "genre", q, gr)
+	if err != nil {
+		respondSearchError(w, r.Context(), rr, err)
+		return
+	}
+	filter.GenreIds = append(filter.GenreIds, genreIds...)
+
+	pageNum := max(getIntOrDefault("page", q, 1), 1)
+	page := books.Page{Limit: opds2PageSize, Offset: (pageNum - 1) * opds2PageSize}
+
+	rows, _, err := br.Search(r.Context(), filter, sort, page)
+	if err != nil {
+		respondSearchError(w, r.Context(), rr, err)
+		return
+	}
+
+	total, exact, err := br.Count(r.Context(), filter, exactCountUpTo)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	res, err := withRelated(r.Context(), rows, "", ar, sr)
+	if err != nil {
+		rr.RespondAndLogError(w, r.Context(), err)
+		return
+	}
+
+	lastPage := max((total+opds2PageSize-1)/opds2PageSize, 1)
+
+	var next, prev, first, last string
+	if page.Offset+len(rows) < total {
+		next = withParam(r, "page", strconv.Itoa(pageNum+1))
+	}
+	if pageNum > 1 {
+		prev = withParam(r, "page", strconv.Itoa(pageNum-1))
+		first = withParam(r, "page", "1")
+	}
+	// Estimated count would lead nowhere
+	if exact && pageNum < lastPage {
+		last = withParam(r, "page", strconv.Itoa(lastPage))
+	}
+
+	f.AddPagination(total, opds2PageSize, pageNum, next, prev, first, last)
+
+	f.Publications = make([]opds2.Publication, 0, len(res.Books))
+	for _, row := range res.Books {
+		f.Publications = append(f.Publications, opds2Publication(row.Book, res.Authors, res.Series))
+	}
+
+	rr.SendJsonAs(w, r, opds2TypeResponse, f)
+}
+
+// addOpds2Facets links the feed narrowed down by each of the values of param, the selected ones link back
+func addOpds2Facets(r *http.Request, f *opds2.Feed, group, param string, vals []books.FacetValue, limit int) {
+	selected := make(map[string]struct{})
+	for _, val := range getMulti(param, r.URL.Query()) {
+		selected[strings.ToLower(val)] = struct{}{}
+	}
+
+	for ix, val := range vals {
+		_, isSelected := selected[strings.ToLower(val.Value)]
+		if ix >= limit && !isSelected {
+			continue
+		}
+
+		link := opds2.Link{
+			Href:       withParam(r, param, val.Value),
+			TypeLink:   opds2Type,
+			Title:      val.Value,
+			Properties: &opds2.Properties{NumberOfItems: val.Count},
+		}
+		if isSelected {
+			link.Rel = opds2.StringOrArray{"self"}
+		}
+
+		f.AddFacet(link, group)
+	}
+}
+
+func opds2Publication(book *types.Book, as map[string]*types.Author, ss map[string]*types.Series) opds2.Publication {
+	var p opds2.Publication
+
+	modified := book.UpdatedAt.UTC().Truncate(time.Second)
+
+	p.Metadata.RDFType = "http://schema.org/Book"
+	p.Metadata.Title.SingleString = book.Title
+	p.Metadata.Identifier = book.Id
+	p.Metadata.Description = book.About
+	p.Metadata.Modified = &modified
+
+	if book.Language != "" {
+		p.Metadata.Language = opds2.StringOrArray{book.Language}
+	}
+
+	if book.Year != 0 {
+		published := time.Date(int(book.Year), time.January, 1, 0, 0, 0, 0, time.UTC)
+		p.Metadata.PublicationDate = &published
+	}
+
+	for _, authorId := range book.Authors {
+		if a, ok := as[authorId]; ok {
+			p.AddAuthor(a.Name, a.Id, "", opds2Root+"/authors/"+url.PathEscape(a.Id), opds2Type)
+		}
+	}
+
+	for _, s := range book.Series {
+		if ser, ok := ss[s.Id]; ok {
+			p.AddSerie(ser.Title, float32(s.Order), opds2Root+"/series/"+url.PathEscape(ser.Id), opds2Type)
+		}
+	}
+
+	for _, genre := range book.Genres {
+		p.Metadata.Subject = append(p.Metadata.Subject, opds2.Subject{Name: genre})
+	}
+
+	p.AddLink("/api/books/"+url.PathEscape(book.Id), "application/json", "alternate", "")
+
+	for _, file := range book.Files {
+		typ := file.Type
+		if typ == "" {
+			typ = "application/octet-stream"
+		}
+
+		p.AddLink(file.Url, typ, opdsRelAcquisition, file.Format)
+	}
+
+	p.Images = make([]opds2.Link, 0, 1)
+	if book.Cover != "" {
+		p.AddImage(book.Cover, imageType(book.Cover), 0, 0)
+	}
+
+	return p
+}
+
+// withParam returns URL of the request with the query param replaced and the page reset,
+// unless it is the page which is replaced
+func withParam(r *http.Request, key, val string) string {
+	u := *r.URL
+	q := u.Query()
+	if key != "page" {
+		q.Del("page")
+	}
+	q.Set(key, val)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
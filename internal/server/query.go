@@ -0,0 +1,491 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/storage/genres"
+	"books/internal/storage/series"
+)
+
+// Query syntax, terms are separated by whitespace and ALL of them must match:
+//
+//	word "quoted phrase"    title contains the word or the phrase
+//	field:value             book matches the field, value may be quoted
+//	field:a|b|"c d"         book matches ANY of the values
+//	-word -field:value      negation of the term
+//	year:1960..1970         range, either bound may be omitted, or single year
+//
+// Fields are author (name or id), genre (exact title), series (title or id), lang and year.
+// Unknown fields are treated as plain words, so titles containing colons can still be found
+const (
+	fieldAuthor = "author"
+	fieldGenre  = "genre"
+	fieldSeries = "series"
+	fieldLang   = "lang"
+	fieldYear   = "year"
+
+	// How many authors or series may match the single name in the query, more of them is an error
+	queryResolveLimit = 100
+)
+
+var queryFields = map[string]struct{}{
+	fieldAuthor: {},
+	fieldGenre:  {},
+	fieldSeries: {},
+	fieldLang:   {},
+	fieldYear:   {},
+}
+
+// QueryError is reported for malformed query or for values which could not be resolved.
+// Pos is 1-based number of the character in the query
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query error at position %d: %s", e.Pos, e.Msg)
+}
+
+type queryValue struct {
+	pos  int
+	text string
+}
+
+type queryTerm struct {
+	pos     int
+	negated bool
+	// Empty for plain words and phrases
+	field  string
+	values []queryValue
+}
+
+type queryParser struct {
+	rs  []rune
+	pos int
+}
+
+func parseQuery(query string) ([]queryTerm, error) {
+	p := queryParser{rs: []rune(query)}
+
+	var terms []queryTerm
+
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return terms, nil
+		}
+
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, term)
+	}
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.rs)
+}
+
+func (p *queryParser) atBoundary() bool {
+	return p.eof() || unicode.IsSpace(p.rs[p.pos])
+}
+
+func (p *queryParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.rs[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...any) error {
+	return &QueryError{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) term() (queryTerm, error) {
+	term := queryTerm{pos: p.pos}
+
+	if p.rs[p.pos] == '-' {
+		p.pos++
+		if p.atBoundary() {
+			return term, p.errorf(term.pos, "nothing to negate")
+		}
+		term.negated = true
+	}
+
+	if p.rs[p.pos] == '"' {
+		val, err := p.quoted()
+		if err != nil {
+			return term, err
+		}
+		if !p.atBoundary() {
+			return term, p.errorf(p.pos, "expected space after closing quote")
+		}
+
+		term.values = []queryValue{val}
+		return term, nil
+	}
+
+	start := p.pos
+	for !p.eof() && unicode.IsLetter(p.rs[p.pos]) {
+		p.pos++
+	}
+
+	field := strings.ToLower(string(p.rs[start:p.pos]))
+	if _, ok := queryFields[field]; ok && !p.eof() && p.rs[p.pos] == ':' {
+		p.pos++
+		term.field = field
+
+		for {
+			if p.atBoundary() || p.rs[p.pos] == '|' {
+				return term, p.errorf(p.pos, "missing value for field %s", field)
+			}
+
+			val, err := p.value()
+			if err != nil {
+				return term, err
+			}
+			term.values = append(term.values, val)
+
+			if p.atBoundary() {
+				return term, nil
+			}
+
+			if p.rs[p.pos] != '|' {
+				return term, p.errorf(p.pos, "unexpected character %q", p.rs[p.pos])
+			}
+			p.pos++
+		}
+	}
+
+	// Not a field, just a word
+	p.pos = start
+	for !p.atBoundary() {
+		p.pos++
+	}
+
+	term.values = []queryValue{{pos: start, text: string(p.rs[start:p.pos])}}
+	return term, nil
+}
+
+func (p *queryParser) value() (queryValue, error) {
+	if p.rs[p.pos] == '"' {
+		return p.quoted()
+	}
+
+	start := p.pos
+	for !p.atBoundary() && p.rs[p.pos] != '|' {
+		if p.rs[p.pos] == '"' {
+			return queryValue{}, p.errorf(p.pos, "unexpected quote inside value")
+		}
+		p.pos++
+	}
+
+	return queryValue{pos: start, text: string(p.rs[start:p.pos])}, nil
+}
+
+// quoted reads phrase in double quotes, backslash escapes the next character
+func (p *queryParser) quoted() (queryValue, error) {
+	start := p.pos
+	p.pos++
+
+	sb := strings.Builder{}
+	for {
+		if p.eof() {
+			return queryValue{}, p.errorf(start, "unterminated quote")
+		}
+
+		r := p.rs[p.pos]
+		p.pos++
+
+		if r == '"' {
+			break
+		}
+
+		if r == '\\' {
+			if p.eof() {
+				return queryValue{}, p.errorf(p.pos-1, "nothing to escape")
+			}
+			r = p.rs[p.pos]
+			p.pos++
+		}
+
+		sb.WriteRune(r)
+	}
+
+	text := strings.TrimSpace(sb.String())
+	if text == "" {
+		return queryValue{}, p.errorf(start, "empty phrase")
+	}
+
+	return queryValue{pos: start, text: text}, nil
+}
+
+// parseYearRange parses single year or range with optional bounds, like 1960..1970, 1960.. or ..1970
+func parseYearRange(val queryValue) (yearMin, yearMax uint16, err error) {
+	bounds := strings.SplitN(val.text, "..", 2)
+
+	parse := func(s string, offset int) (uint16, error) {
+		if s == "" {
+			return 0, nil
+		}
+
+		y, err := strconv.ParseUint(s, 10, 16)
+		if err != nil || y == 0 {
+			return 0, &QueryError{Pos: val.pos + offset + 1, Msg: "invalid year " + strconv.Quote(s)}
+		}
+
+		return uint16(y), nil
+	}
+
+	yearMin, err = parse(bounds[0], 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(bounds) == 1 {
+		if yearMin == 0 {
+			return 0, 0, &QueryError{Pos: val.pos + 1, Msg: "missing year"}
+		}
+
+		return yearMin, yearMin, nil
+	}
+
+	yearMax, err = parse(bounds[1], len([]rune(bounds[0]))+2)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if yearMin == 0 && yearMax == 0 {
+		return 0, 0, &QueryError{Pos: val.pos + 1, Msg: "range without bounds"}
+	}
+
+	if yearMax != 0 && yearMin > yearMax {
+		return 0, 0, &QueryError{Pos: val.pos + 1, Msg: "lower year bound is greater than upper"}
+	}
+
+	return yearMin, yearMax, nil
+}
+
+// queryResolver turns parsed query into the books filter, looking up entities by their names
+type queryResolver struct {
+	ar authors.Repository
+	gr genres.Repository
+	sr series.Repository
+}
+
+func (qr *queryResolver) filter(ctx context.Context, query string) (books.Filter, error) {
+	var f books.Filter
+
+	terms, err := parseQuery(query)
+	if err != nil {
+		return f, err
+	}
+
+	// Positive terms of the same field would need AND between ANY-of lists which filter can not express
+	seenFields := make(map[string]int)
+
+	for _, term := range terms {
+		if term.field != "" && term.field != fieldYear && !term.negated {
+			if pos, ok := seenFields[term.field]; ok {
+				return f, &QueryError{
+					Pos: term.pos + 1,
+					Msg: fmt.Sprintf("field %s is already used at position %d, combine values with |", term.field, pos+1),
+				}
+			}
+			seenFields[term.field] = term.pos
+		}
+
+		switch term.field {
+		case "":
+			if term.negated {
+				f.ExcludeTitles = append(f.ExcludeTitles, term.values[0].text)
+			} else {
+				f.Titles = append(f.Titles, term.values[0].text)
+			}
+
+		case fieldYear:
+			if term.negated {
+				return f, &QueryError{Pos: term.pos + 1, Msg: "year can not be negated"}
+			}
+
+			if len(term.values) > 1 {
+				return f, &QueryError{Pos: term.values[1].pos + 1, Msg: "year does not support alternatives"}
+			}
+
+			yearMin, yearMax, err := parseYearRange(term.values[0])
+			if err != nil {
+				return f, err
+			}
+
+			// Repeated year terms narrow the range down
+			if yearMin > f.YearMin {
+				f.YearMin = yearMin
+			}
+			if yearMax != 0 && (f.YearMax == 0 || yearMax < f.YearMax) {
+				f.YearMax = yearMax
+			}
+
+		case fieldLang:
+			for _, val := range term.values {
+				if term.negated {
+					f.ExcludeLanguages = append(f.ExcludeLanguages, val.text)
+				} else {
+					f.Languages = append(f.Languages, val.text)
+				}
+			}
+
+		case fieldGenre:
+			ids, err := qr.genres(ctx, term.values)
+			if err != nil {
+				return f, err
+			}
+
+			if term.negated {
+				f.ExcludeGenreIds = append(f.ExcludeGenreIds, ids...)
+			} else {
+				f.GenreIds = append(f.GenreIds, ids...)
+			}
+
+		case fieldAuthor:
+			ids, err := qr.authors(ctx, term.values)
+			if err != nil {
+				return f, err
+			}
+
+			if term.negated {
+				f.ExcludeAuthorIds = append(f.ExcludeAuthorIds, ids...)
+			} else {
+				f.AuthorIds = append(f.AuthorIds, ids...)
+			}
+
+		case fieldSeries:
+			ids, err := qr.series(ctx, term.values)
+			if err != nil {
+				return f, err
+			}
+
+			if term.negated {
+				f.ExcludeSeriesIds = append(f.ExcludeSeriesIds, ids...)
+			} else {
+				f.SeriesIds = append(f.SeriesIds, ids...)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func (qr *queryResolver) genres(ctx context.Context, vals []queryValue) ([]uint16, error) {
+	titles := make([]string, 0, len(vals))
+	for _, val := range vals {
+		titles = append(titles, val.text)
+	}
+
+	gs, err := qr.gr.GetIdByTitles(ctx, titles...)
+	if err != nil {
+		return nil, err
+	}
+
+	lowerIds := make(map[string]uint16, len(gs))
+	for title, id := range gs {
+		lowerIds[strings.ToLower(title)] = id
+	}
+
+	ids := make([]uint16, 0, len(vals))
+	for _, val := range vals {
+		id, ok := lowerIds[strings.ToLower(val.text)]
+		if !ok {
+			return nil, &QueryError{Pos: val.pos + 1, Msg: "unknown genre " + strconv.Quote(val.text)}
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (qr *queryResolver) authors(ctx context.Context, vals []queryValue) ([]string, error) {
+	var ids []string
+
+	for _, val := range vals {
+		a, err := qr.ar.GetById(ctx, val.text)
+		if err != nil {
+			return nil, err
+		}
+
+		if a != nil {
+			ids = append(ids, a.Id)
+			continue
+		}
+
+		// One more to tell whether there are too many of them
+		as, err := qr.ar.Search(ctx, val.text, books.Filter{}, queryResolveLimit+1, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(as) > queryResolveLimit {
+			return nil, &QueryError{
+				Pos: val.pos + 1,
+				Msg: "too many authors match " + strconv.Quote(val.text) + ", narrow it down",
+			}
+		}
+
+		if len(as) == 0 {
+			return nil, &QueryError{Pos: val.pos + 1, Msg: "no author matches " + strconv.Quote(val.text)}
+		}
+
+		for _, a := range as {
+			ids = append(ids, a.Id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (qr *queryResolver) series(ctx context.Context, vals []queryValue) ([]string, error) {
+	var ids []string
+
+	for _, val := range vals {
+		s, err := qr.sr.GetById(ctx, val.text)
+		if err != nil {
+			return nil, err
+		}
+
+		if s != nil {
+			ids = append(ids, s.Id)
+			continue
+		}
+
+		// One more to tell whether there are too many of them
+		ss, err := qr.sr.Search(ctx, val.text, books.Filter{}, queryResolveLimit+1, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ss) > queryResolveLimit {
+			return nil, &QueryError{
+				Pos: val.pos + 1,
+				Msg: "too many series match " + strconv.Quote(val.text) + ", narrow it down",
+			}
+		}
+
+		if len(ss) == 0 {
+			return nil, &QueryError{Pos: val.pos + 1, Msg: "no series matches " + strconv.Quote(val.text)}
+		}
+
+		for _, s := range ss {
+			ids = append(ids, s.Id)
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"books/internal/storage/authors"
+	"books/internal/storage/books"
+	"books/internal/types"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []queryTerm
+	}{
+		{
+			name:  "empty",
+			query: "  ",
+			want:  nil,
+		},
+		{
+			name:  "words",
+			query: "war  peace",
+			want: []queryTerm{
+				{pos: 0, values: []queryValue{{pos: 0, text: "war"}}},
+				{pos: 5, values: []queryValue{{pos: 5, text: "peace"}}},
+			},
+		},
+		{
+			name:  "phrase with escapes",
+			query: `"the \"old\" man" sea`,
+			want: []queryTerm{
+				{pos: 0, values: []queryValue{{pos: 0, text: `the "old" man`}}},
+				{pos: 18, values: []queryValue{{pos: 18, text: "sea"}}},
+			},
+		},
+		{
+			name:  "negated word and phrase",
+			query: `-war -"and peace"`,
+			want: []queryTerm{
+				{pos: 0, negated: true, values: []queryValue{{pos: 1, text: "war"}}},
+				{pos: 5, negated: true, values: []queryValue{{pos: 6, text: "and peace"}}},
+			},
+		},
+		{
+			name:  "field with alternatives",
+			query: `Author:tolstoy|"anton chekhov"|gogol`,
+			want: []queryTerm{
+				{pos: 0, field: fieldAuthor, values: []queryValue{
+					{pos: 7, text: "tolstoy"},
+					{pos: 15, text: "anton chekhov"},
+					{pos: 31, text: "gogol"},
+				}},
+			},
+		},
+		{
+			name:  "negated field",
+			query: "-lang:en",
+			want: []queryTerm{
+				{pos: 0, negated: true, field: fieldLang, values: []queryValue{{pos: 6, text: "en"}}},
+			},
+		},
+		{
+			name:  "unknown field is a word",
+			query: "re:zero",
+			want: []queryTerm{
+				{pos: 0, values: []queryValue{{pos: 0, text: "re:zero"}}},
+			},
+		},
+		{
+			name:  "positions count characters, not bytes",
+			query: "мир year:1869",
+			want: []queryTerm{
+				{pos: 0, values: []queryValue{{pos: 0, text: "мир"}}},
+				{pos: 4, field: fieldYear, values: []queryValue{{pos: 9, text: "1869"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseQuery(%q) error = %v", tt.query, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{query: "war -", pos: 5},
+		{query: `"unterminated`, pos: 1},
+		{query: `war "  "`, pos: 5},
+		{query: `"phrase"word`, pos: 9},
+		{query: `"escape at the end\`, pos: 19},
+		{query: "author:", pos: 8},
+		{query: "author:a|", pos: 10},
+		{query: "author:|a", pos: 8},
+		{query: `genre:a"b`, pos: 8},
+		{query: `series:"a"b`, pos: 11},
+		{query: "мир lang:", pos: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parseQuery(tt.query)
+
+			var qe *QueryError
+			if !errors.As(err, &qe) {
+				t.Fatalf("parseQuery(%q) error = %v, want QueryError", tt.query, err)
+			}
+
+			if qe.Pos != tt.pos {
+				t.Errorf("parseQuery(%q) error at %d (%s), want at %d", tt.query, qe.Pos, qe.Msg, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParseYearRange(t *testing.T) {
+	tests := []struct {
+		text    string
+		min     uint16
+		max     uint16
+		wantErr int
+	}{
+		{text: "1869", min: 1869, max: 1869},
+		{text: "1960..1970", min: 1960, max: 1970},
+		{text: "1960..", min: 1960},
+		{text: "..1970", max: 1970},
+		{text: "..", wantErr: 11},
+		{text: "0", wantErr: 11},
+		{text: "x..1970", wantErr: 11},
+		{text: "1960..x", wantErr: 17},
+		{text: "1970..1960", wantErr: 11},
+		{text: "70000", wantErr: 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			// As if the value follows "year:" at the start of the query
+			yearMin, yearMax, err := parseYearRange(queryValue{pos: 10, text: tt.text})
+
+			if tt.wantErr != 0 {
+				var qe *QueryError
+				if !errors.As(err, &qe) {
+					t.Fatalf("parseYearRange(%q) error = %v, want QueryError", tt.text, err)
+				}
+
+				if qe.Pos != tt.wantErr {
+					t.Errorf("parseYearRange(%q) error at %d, want at %d", tt.text, qe.Pos, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseYearRange(%q) error = %v", tt.text, err)
+			}
+
+			if yearMin != tt.min || yearMax != tt.max {
+				t.Errorf("parseYearRange(%q) = %d, %d, want %d, %d", tt.text, yearMin, yearMax, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// Only the fields which do not look entities up are resolved, so the repositories are not needed
+func TestQueryResolverFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    books.Filter
+		wantErr int
+	}{
+		{
+			query: `war -peace "new world"`,
+			want:  books.Filter{Titles: []string{"war", "new world"}, ExcludeTitles: []string{"peace"}},
+		},
+		{
+			query: "lang:en|ru -lang:de",
+			want:  books.Filter{Languages: []string{"en", "ru"}, ExcludeLanguages: []string{"de"}},
+		},
+		{
+			query: "year:1900.. year:..1950 year:1920..1960",
+			want:  books.Filter{YearMin: 1920, YearMax: 1950},
+		},
+		{query: "lang:en lang:ru", wantErr: 9},
+		{query: "war -year:1900", wantErr: 5},
+		{query: "year:1900|1901", wantErr: 11},
+		{query: "year:1901..1900", wantErr: 6},
+	}
+
+	qr := &queryResolver{}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := qr.filter(context.Background(), tt.query)
+
+			if tt.wantErr != 0 {
+				var qe *QueryError
+				if !errors.As(err, &qe) {
+					t.Fatalf("filter(%q) error = %v, want QueryError", tt.query, err)
+				}
+
+				if qe.Pos != tt.wantErr {
+					t.Errorf("filter(%q) error at %d (%s), want at %d", tt.query, qe.Pos, qe.Msg, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("filter(%q) error = %v", tt.query, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// stubAuthors finds count authors by any name, other methods are not implemented
+type stubAuthors struct {
+	authors.Repository
+	count int
+}
+
+func (s stubAuthors) GetById(context.Context, string) (*types.Author, error) {
+	return nil, nil
+}
+
+func (s stubAuthors) Search(_ context.Context, _ string, _ books.Filter, limit, _ int) ([]*types.Author, error) {
+	as := make([]*types.Author, min(s.count, limit))
+	for ix := range as {
+		as[ix] = &types.Author{Id: strconv.Itoa(ix)}
+	}
+
+	return as, nil
+}
+
+func TestQueryResolverAuthorMatches(t *testing.T) {
+	tests := []struct {
+		count   int
+		want    int
+		wantErr int
+	}{
+		{count: 0, wantErr: 8},
+		{count: 1, want: 1},
+		{count: queryResolveLimit, want: queryResolveLimit},
+		{count: queryResolveLimit + 1, wantErr: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.count), func(t *testing.T) {
+			qr := &queryResolver{ar: stubAuthors{count: tt.count}}
+
+			got, err := qr.filter(context.Background(), "author:name")
+
+			if tt.wantErr != 0 {
+				var qe *QueryError
+				if !errors.As(err, &qe) {
+					t.Fatalf("filter() error = %v, want QueryError", err)
+				}
+
+				if qe.Pos != tt.wantErr {
+					t.Errorf("filter() error at %d (%s), want at %d", qe.Pos, qe.Msg, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("filter() error = %v", err)
+			}
+
+			if len(got.AuthorIds) != tt.want {
+				t.Errorf("filter() matched %d authors, want %d", len(got.AuthorIds), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"books/internal/ratelimit"
+	"books/internal/response"
+)
+
+// RateLimit limits requests per client IP, with separate budgets for the expensive requests and the rest.
+// Responses have RateLimit-* headers of the budget used
+type RateLimit struct {
+	rr        *response.Responder
+	cheap     ratelimit.Limit
+	expensive ratelimit.Limit
+	buckets   *ratelimit.Buckets
+}
+
+// NewRateLimit allows the requests per minute, zero disables the limit
+func NewRateLimit(rr *response.Responder, cheap, expensive int) *RateLimit {
+	return &RateLimit{
+		rr:        rr,
+		cheap:     ratelimit.PerMinute(cheap),
+		expensive: ratelimit.PerMinute(expensive),
+		buckets:   ratelimit.New(),
+	}
+}
+
+func (l *RateLimit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Path relative to the mount point of the router
+		path := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+			path = rctx.RoutePath
+		}
+
+		budget, limit := "cheap:", l.cheap
+		if isExpensive(path, r.URL.Query()) {
+			budget, limit = "expensive:", l.expensive
+		}
+
+		if limit.Burst <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res := l.buckets.Take(budget+clientIP(r), limit)
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=60", limit.Burst))
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+
+		if !res.Allowed {
+			l.rr.RespondAndLogError(w, r.Context(), response.RateLimited(res.RetryAfter))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isExpensive tells whether the request runs several queries or groups the books
+func isExpensive(path string, q url.Values) bool {
+	switch path {
+	case "/search", "/graphql":
+		return true
+	case "/books":
+		return len(getGroupings(q)) > 0
+	}
+
+	return false
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+
+	"books/internal/cache"
+	"books/internal/response"
+	"books/web"
+)
+
+var docPages = []string{"rapidoc.html", "redocly.html", "swagger-ui.html", "scalar.html"}
+
+// The spec is rendered for each base URL the server is reached by, there are few of them normally
+const (
+	specCacheSize = 100
+	specCacheTTL  = time.Hour
+)
+
+// Assets are the built in docs pages and openapi.yaml, the files present in dir take precedence if it is set
+func Assets(dir string) fs.FS {
+	if dir == "" {
+		return web.Assets
+	}
+
+	return overlayFS{os.DirFS(dir), web.Assets}
+}
+
+// ReadSpec reads openApiYaml file if set, or openapi.yaml of the assets
+func ReadSpec(assets fs.FS, openApiYaml string) ([]byte, error) {
+	if openApiYaml != "" {
+		return os.ReadFile(openApiYaml)
+	}
+
+	return fs.ReadFile(assets, "openapi.yaml")
+}
+
+// Static serves the docs pages and the spec, having relative servers resolved against the URL of this server.
+// X-Forwarded-* headers are only taken into account from the trusted proxies
+func Static(r chi.Router, rr *response.Responder, assets fs.FS, spec []byte, trustedProxies []netip.Prefix) {
+	rendered := cache.New[string, []byte](specCacheSize, specCacheTTL)
+
+	r.Get("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		base := baseURL(r, trustedProxies)
+
+		bs, ok := rendered.Get(base.String())
+		if !ok {
+			var err error
+			bs, err = withServers(spec, base)
+			if err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			rendered.Set(base.String(), bs)
+		}
+
+		w.Header().Set("Vary", "Host, X-Forwarded-Host, X-Forwarded-Proto")
+		rr.Send(w, r, "application/yaml", bs)
+	})
+
+	for _, filename := range docPages {
+		r.Get("/"+filename, func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFileFS(w, r, assets, filename)
+		})
+	}
+}
+
+// baseURL is the URL the client reached this server by, trusted proxies are expected to set X-Forwarded-* headers
+func baseURL(r *http.Request, trustedProxies []netip.Prefix) *url.URL {
+	u := &url.URL{Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	if !isTrusted(remoteAddr(r), trustedProxies) {
+		return u
+	}
+
+	if proto := firstForwarded(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		u.Scheme = proto
+	}
+	if host := firstForwarded(r.Header.Get("X-Forwarded-Host")); host != "" {
+		u.Host = host
+	}
+
+	return u
+}
+
+// firstForwarded is the value set by the proxy closest to the client
+func firstForwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
+
+// withServers resolves relative URLs in servers of the spec against base, the spec is left unchanged
+func withServers(spec []byte, base *url.URL) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("OpenAPI spec is not a mapping")
+	}
+
+	root := doc.Content[0]
+	var servers *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "servers" {
+			servers = root.Content[i+1]
+		}
+	}
+
+	if servers == nil || servers.Kind != yaml.SequenceNode || len(servers.Content) == 0 {
+		servers = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{{
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "url"},
+				{Kind: yaml.ScalarNode, Value: "/"},
+			},
+		}}}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "servers"}, servers)
+	}
+
+	for _, server := range servers.Content {
+		for i := 0; i+1 < len(server.Content); i += 2 {
+			if server.Content[i].Value != "url" {
+				continue
+			}
+
+			u, err := url.Parse(server.Content[i+1].Value)
+			if err != nil || u.IsAbs() {
+				continue
+			}
+			server.Content[i+1].Value = base.ResolveReference(u).String()
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// overlayFS opens the file from the first of the filesystems having it
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	var err error
+	for _, fsys := range o {
+		var f fs.File
+		if f, err = fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		headers    map[string]string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.1:1234", want: "http://books.test"},
+		{name: "direct tls", remoteAddr: "203.0.113.1:1234", tls: true, want: "https://books.test"},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-Host": "example.com, proxy.local", "X-Forwarded-Proto": "https"},
+			want:       "https://example.com",
+		},
+		{
+			name:       "untrusted client",
+			remoteAddr: "203.0.113.1:1234",
+			headers:    map[string]string{"X-Forwarded-Host": "evil.example", "X-Forwarded-Proto": "https"},
+			want:       "http://books.test",
+		},
+		{
+			name:       "unknown proto",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-Proto": "ftp"},
+			want:       "http://books.test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://books.test/openapi.yaml", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := baseURL(r, trusted).String(); got != tt.want {
+				t.Errorf("baseURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+
+	"books/internal/response"
+)
+
+// Subset of OpenAPI 3 needed to validate path and query parameters
+type specSchema struct {
+	Ref     string      `yaml:"$ref"`
+	Type    string      `yaml:"type"`
+	Enum    []string    `yaml:"enum"`
+	Minimum *float64    `yaml:"minimum"`
+	Maximum *float64    `yaml:"maximum"`
+	Items   *specSchema `yaml:"items"`
+}
+
+type specParam struct {
+	Ref      string      `yaml:"$ref"`
+	Name     string      `yaml:"name"`
+	In       string      `yaml:"in"`
+	Required bool        `yaml:"required"`
+	Schema   *specSchema `yaml:"schema"`
+}
+
+type specOperation struct {
+	Parameters []specParam `yaml:"parameters"`
+}
+
+type spec struct {
+	Paths      map[string]map[string]specOperation `yaml:"paths"`
+	Components struct {
+		Parameters map[string]specParam   `yaml:"parameters"`
+		Schemas    map[string]*specSchema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+// Refs deeper than that are considered circular
+const maxRefDepth = 10
+
+type validatedRoute struct {
+	method string
+	// Path split by slashes, params are left as {name}
+	segments []string
+	params   []specParam
+}
+
+// Validator checks query and path parameters of the requests against their schemas in openapi.yaml
+type Validator struct {
+	routes []validatedRoute
+	// Handlers clamp the limits to it as well, in case the spec allows more
+	maxLimit int
+}
+
+// NewValidator parses the spec. When maxLimit is positive, it replaces maximum of all the limit
+// params (limit, authors_limit, ...) in it
+func NewValidator(specYaml []byte, maxLimit int) (*Validator, error) {
+	var s spec
+	if err := yaml.Unmarshal(specYaml, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+
+	v := &Validator{maxLimit: maxLimit}
+
+	for path, ops := range s.Paths {
+		for method, op := range ops {
+			route := validatedRoute{
+				method:   strings.ToUpper(method),
+				segments: strings.Split(strings.Trim(path, "/"), "/"),
+			}
+
+			for _, p := range op.Parameters {
+				p, err := s.resolveParam(p)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", route.method, path, err)
+				}
+
+				if maxLimit > 0 && p.In == "query" && (p.Name == "limit" || strings.HasSuffix(p.Name, "_limit")) &&
+					p.Schema != nil {
+
+					schema := *p.Schema
+					maximum := float64(maxLimit)
+					schema.Maximum = &maximum
+					p.Schema = &schema
+				}
+
+				route.params = append(route.params, p)
+			}
+
+			v.routes = append(v.routes, route)
+		}
+	}
+
+	return v, nil
+}
+
+func (s *spec) resolveParam(p specParam) (specParam, error) {
+	for depth := 0; p.Ref != ""; depth++ {
+		name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+		if !ok || depth == maxRefDepth {
+			return p, errors.New("unsupported parameter ref " + p.Ref)
+		}
+
+		p, ok = s.Components.Parameters[name]
+		if !ok {
+			return p, errors.New("unknown parameter ref " + name)
+		}
+	}
+
+	schema, err := s.resolveSchema(p.Schema, 0)
+	if err != nil {
+		return p, fmt.Errorf("parameter %s: %w", p.Name, err)
+	}
+	p.Schema = schema
+
+	return p, nil
+}
+
+func (s *spec) resolveSchema(schema *specSchema, depth int) (*specSchema, error) {
+	if schema == nil {
+		return nil, nil
+	}
+
+	if depth == maxRefDepth {
+		return nil, errors.New("too deep schema refs")
+	}
+
+	if schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok {
+			return nil, errors.New("unsupported schema ref " + schema.Ref)
+		}
+
+		ref, ok := s.Components.Schemas[name]
+		if !ok {
+			return nil, errors.New("unknown schema ref " + name)
+		}
+
+		return s.resolveSchema(ref, depth+1)
+	}
+
+	items, err := s.resolveSchema(schema.Items, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := *schema
+	ret.Items = items
+
+	return &ret, nil
+}
+
+// Middleware responds with 400 listing all the invalid params. Requests to paths missing in the spec
+// are passed as is
+func (v *Validator) Middleware(rr *response.Responder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Path relative to the mount point of the router
+			path := r.URL.EscapedPath()
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+				path = rctx.RoutePath
+			}
+
+			method := r.Method
+			if method == http.MethodHead {
+				method = http.MethodGet
+			}
+
+			if err := v.Validate(method, path, r.URL.Query()); err != nil {
+				rr.RespondAndLogError(w, r.Context(), err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Validate returns *response.Error with CodeInvalidParameter if any of the params does not match the spec
+func (v *Validator) Validate(method, path string, q url.Values) error {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, route := range v.routes {
+		pathParams, ok := route.match(method, segments)
+		if !ok {
+			continue
+		}
+
+		var invalid []response.InvalidParam
+
+		for _, p := range route.params {
+			var vals []string
+			switch p.In {
+			case "query":
+				vals = q[p.Name]
+			case "path":
+				vals = []string{pathParams[p.Name]}
+			default:
+				continue
+			}
+
+			if reason := validateParam(p, vals); reason != "" {
+				invalid = append(invalid, response.InvalidParam{Name: p.Name, Reason: reason})
+			}
+		}
+
+		if len(invalid) > 0 {
+			return response.InvalidParams(invalid...)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+func (route *validatedRoute) match(method string, segments []string) (map[string]string, bool) {
+	if route.method != method || len(route.segments) != len(segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+
+	for i, segment := range route.segments {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			val, err := url.PathUnescape(segments[i])
+			if err != nil || val == "" {
+				return nil, false
+			}
+
+			params[strings.TrimSuffix(name, "}")] = val
+			continue
+		}
+
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// validateParam returns the reason why the values are invalid, empty values are treated as missing
+func validateParam(p specParam, vals []string) string {
+	vals = slices.DeleteFunc(slices.Clone(vals), func(val string) bool {
+		return strings.TrimSpace(val) == ""
+	})
+
+	if len(vals) == 0 {
+		if p.Required {
+			return "is required"
+		}
+
+		return ""
+	}
+
+	if p.Schema == nil {
+		return ""
+	}
+
+	if p.Schema.Type == "array" {
+		if p.Schema.Items == nil {
+			return ""
+		}
+
+		for _, val := range vals {
+			if reason := validateValue(p.Schema.Items, strings.TrimSpace(val)); reason != "" {
+				return fmt.Sprintf("%q %s", val, reason)
+			}
+		}
+
+		return ""
+	}
+
+	if len(vals) > 1 {
+		return "must be given once"
+	}
+
+	return validateValue(p.Schema, strings.TrimSpace(vals[0]))
+}
+
+func validateValue(schema *specSchema, val string) string {
+	switch schema.Type {
+	case "integer", "number":
+		var n float64
+		if schema.Type == "integer" {
+			i, err := strconv.Atoi(val)
+			if err != nil {
+				return "must be an integer"
+			}
+			n = float64(i)
+		} else {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return "must be a number"
+			}
+			n = f
+		}
+
+		if schema.Minimum != nil && n < *schema.Minimum {
+			return "must be at least " + strconv.FormatFloat(*schema.Minimum, 'f', -1, 64)
+		}
+
+		if schema.Maximum != nil && n > *schema.Maximum {
+			return "must be at most " + strconv.FormatFloat(*schema.Maximum, 'f', -1, 64)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(val); err != nil {
+			return "must be true or false"
+		}
+	}
+
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, val) {
+		return "must be one of " + strings.Join(schema.Enum, ", ")
+	}
+
+	return ""
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"books/internal/response"
+)
+
+const testSpec = `
+paths:
+  /books:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/Limit'
+        - name: authors_limit
+          in: query
+          schema:
+            type: integer
+            minimum: 0
+            maximum: 100
+        - name: sort
+          in: query
+          schema:
+            $ref: '#/components/schemas/Sort'
+        - name: genres
+          in: query
+          schema:
+            type: array
+            items:
+              type: integer
+              minimum: 1
+        - name: debug
+          in: query
+          schema:
+            type: boolean
+        - name: ratio
+          in: query
+          schema:
+            type: number
+            maximum: 1
+  /books/{id}/similar:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+            minimum: 1
+        - name: q
+          in: query
+          required: true
+          schema:
+            type: string
+components:
+  parameters:
+    Limit:
+      name: limit
+      in: query
+      schema:
+        type: integer
+        minimum: 1
+        maximum: 100
+  schemas:
+    Sort:
+      type: string
+      enum: [title, year]
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLimit int
+		method   string
+		path     string
+		query    string
+		want     []response.InvalidParam
+	}{
+		{name: "valid", path: "/books", query: "limit=10&sort=year&genres=1&genres=2&debug=true&ratio=0.5"},
+		{name: "empty values are missing", path: "/books", query: "limit=&sort=%20"},
+		{name: "unknown path", path: "/authors", query: "limit=x"},
+		{name: "other method", method: http.MethodPost, path: "/books", query: "limit=x"},
+		{
+			name:  "enum",
+			path:  "/books",
+			query: "sort=author",
+			want:  []response.InvalidParam{{Name: "sort", Reason: "must be one of title, year"}},
+		},
+		{
+			name:  "minimum",
+			path:  "/books",
+			query: "limit=0",
+			want:  []response.InvalidParam{{Name: "limit", Reason: "must be at least 1"}},
+		},
+		{
+			name:  "maximum",
+			path:  "/books",
+			query: "limit=101",
+			want:  []response.InvalidParam{{Name: "limit", Reason: "must be at most 100"}},
+		},
+		{
+			name:  "not an integer",
+			path:  "/books",
+			query: "limit=1.5",
+			want:  []response.InvalidParam{{Name: "limit", Reason: "must be an integer"}},
+		},
+		{
+			name:  "number maximum",
+			path:  "/books",
+			query: "ratio=1.5",
+			want:  []response.InvalidParam{{Name: "ratio", Reason: "must be at most 1"}},
+		},
+		{
+			name:  "boolean",
+			path:  "/books",
+			query: "debug=yes",
+			want:  []response.InvalidParam{{Name: "debug", Reason: "must be true or false"}},
+		},
+		{
+			name:  "given twice",
+			path:  "/books",
+			query: "limit=1&limit=2",
+			want:  []response.InvalidParam{{Name: "limit", Reason: "must be given once"}},
+		},
+		{
+			name:  "array item",
+			path:  "/books",
+			query: "genres=1&genres=0",
+			want:  []response.InvalidParam{{Name: "genres", Reason: `"0" must be at least 1`}},
+		},
+		{
+			name:     "max limit overrides limit params",
+			maxLimit: 1000,
+			path:     "/books",
+			query:    "limit=500&authors_limit=1000",
+		},
+		{
+			name:     "max limit is the maximum",
+			maxLimit: 1000,
+			path:     "/books",
+			query:    "limit=1001&authors_limit=1001",
+			want: []response.InvalidParam{
+				{Name: "limit", Reason: "must be at most 1000"},
+				{Name: "authors_limit", Reason: "must be at most 1000"},
+			},
+		},
+		{
+			name:     "max limit keeps minimum",
+			maxLimit: 1000,
+			path:     "/books",
+			query:    "limit=0",
+			want:     []response.InvalidParam{{Name: "limit", Reason: "must be at least 1"}},
+		},
+		{name: "path param", path: "/books/1/similar", query: "q=war"},
+		{
+			name:  "invalid path param",
+			path:  "/books/0/similar",
+			query: "q=war",
+			want:  []response.InvalidParam{{Name: "id", Reason: "must be at least 1"}},
+		},
+		{
+			name: "all invalid params are listed",
+			path: "/books/x/similar",
+			want: []response.InvalidParam{
+				{Name: "id", Reason: "must be an integer"},
+				{Name: "q", Reason: "is required"},
+			},
+		},
+		{
+			name:  "all invalid query params are listed",
+			path:  "/books",
+			query: "limit=0&authors_limit=-1&sort=x&debug=1x",
+			want: []response.InvalidParam{
+				{Name: "limit", Reason: "must be at least 1"},
+				{Name: "authors_limit", Reason: "must be at least 0"},
+				{Name: "sort", Reason: "must be one of title, year"},
+				{Name: "debug", Reason: "must be true or false"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator([]byte(testSpec), tt.maxLimit)
+			if err != nil {
+				t.Fatalf("NewValidator() error = %v", err)
+			}
+
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			err = v.Validate(method, tt.path, q)
+
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var re *response.Error
+			if !errors.As(err, &re) {
+				t.Fatalf("Validate() error = %v, want *response.Error", err)
+			}
+
+			if re.Code != response.CodeInvalidParameter {
+				t.Errorf("Validate() error code = %v, want %v", re.Code, response.CodeInvalidParameter)
+			}
+
+			if !reflect.DeepEqual(re.Params, tt.want) {
+				t.Errorf("Validate() params = %+v, want %+v", re.Params, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewValidatorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{name: "not yaml", spec: "paths: ["},
+		{
+			name: "unknown parameter ref",
+			spec: `
+paths:
+  /books:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/Missing'
+`,
+		},
+		{
+			name: "circular schema ref",
+			spec: `
+paths:
+  /books:
+    get:
+      parameters:
+        - name: sort
+          in: query
+          schema:
+            $ref: '#/components/schemas/A'
+components:
+  schemas:
+    A:
+      $ref: '#/components/schemas/B'
+    B:
+      $ref: '#/components/schemas/A'
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewValidator([]byte(tt.spec), 0); err == nil {
+				t.Error("NewValidator() error = nil")
+			}
+		})
+	}
+}
+
+// The built in spec must stay within the supported subset
+func TestValidatorBuiltInSpec(t *testing.T) {
+	spec, err := ReadSpec(Assets(""), "")
+	if err != nil {
+		t.Fatalf("ReadSpec() error = %v", err)
+	}
+
+	if _, err := NewValidator(spec, 0); err != nil {
+		t.Errorf("NewValidator() error = %v", err)
+	}
+}
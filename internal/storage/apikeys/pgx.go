@@ -0,0 +1,193 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func NewPGXRepository(pg *pgxpool.Pool, l *slog.Logger) Repository {
+	return &pgxRepo{pg: pg, g: goqu.Dialect("postgres"), l: l}
+}
+
+type pgxRepo struct {
+	pg *pgxpool.Pool
+	g  goqu.DialectWrapper
+	l  *slog.Logger
+}
+
+type pgxKey struct {
+	Id            uint32     `db:"id"`
+	Name          string     `db:"name"`
+	Prefix        string     `db:"prefix"`
+	RatePerMinute int        `db:"rate_per_minute"`
+	DailyQuota    int        `db:"daily_quota"`
+	CreatedAt     time.Time  `db:"created_at"`
+	RevokedAt     *time.Time `db:"revoked_at"`
+	LastUsedAt    *time.Time `db:"last_used_at"`
+}
+
+var keyColumns = []any{"id", "name", "prefix", "rate_per_minute", "daily_quota", "created_at", "revoked_at",
+	"last_used_at"}
+
+func (p pgxKey) toKey() *Key {
+	k := Key(p)
+	return &k
+}
+
+func (p *pgxRepo) Create(ctx context.Context, name string, ratePerMinute, dailyQuota int) (string, *Key, error) {
+	key, err := generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	sql, params, err := p.g.Insert("api_key").
+		Rows(goqu.Record{
+			"name":            name,
+			"hash":            hash(key),
+			"prefix":          key[:len(keyPrefix)+6],
+			"rate_per_minute": ratePerMinute,
+			"daily_quota":     dailyQuota,
+		}).
+		Returning(keyColumns...).
+		ToSQL()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var row pgxKey
+
+	err = pgxscan.Get(ctx, p.pg, &row, sql, params...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, row.toKey(), nil
+}
+
+func (p *pgxRepo) GetByKey(ctx context.Context, key string) (*Key, error) {
+	sql, params, err := p.g.From("api_key").
+		Select(keyColumns...).
+		Where(goqu.C("hash").Eq(hash(key)), goqu.C("revoked_at").IsNull()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var row pgxKey
+
+	err = pgxscan.Get(ctx, p.pg, &row, sql, params...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	return row.toKey(), nil
+}
+
+func (p *pgxRepo) List(ctx context.Context) ([]*Key, error) {
+	sql, params, err := p.g.From("api_key").
+		Select(keyColumns...).
+		Order(goqu.C("id").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []pgxKey
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*Key, 0, len(rows))
+	for _, row := range rows {
+		ret = append(ret, row.toKey())
+	}
+
+	return ret, nil
+}
+
+func (p *pgxRepo) Revoke(ctx context.Context, id uint32) (bool, error) {
+	sql, params, err := p.g.Update("api_key").
+		Set(goqu.Record{"revoked_at": goqu.L("now()")}).
+		Where(goqu.C("id").Eq(id), goqu.C("revoked_at").IsNull()).
+		ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := p.pg.Exec(ctx, sql, params...)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (p *pgxRepo) AddUsage(ctx context.Context, day time.Time, requests map[uint32]int) (map[uint32]int, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	rows := make([]any, 0, len(requests))
+	ids := make([]uint32, 0, len(requests))
+	for id, n := range requests {
+		rows = append(rows, goqu.Record{"key_id": id, "day": day.Format(time.DateOnly), "requests": n})
+		ids = append(ids, id)
+	}
+
+	usageSql, usageParams, err := p.g.Insert("api_key_usage").
+		Rows(rows...).
+		OnConflict(goqu.DoUpdate("key_id, day", goqu.Record{
+			"requests": goqu.L("api_key_usage.requests + excluded.requests"),
+		})).
+		Returning("key_id", "requests").
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	usedSql, usedParams, err := p.g.Update("api_key").
+		Set(goqu.Record{"last_used_at": goqu.L("now()")}).
+		Where(goqu.C("id").In(ids)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var totals map[uint32]int
+
+	err = pgx.BeginFunc(ctx, p.pg, func(tx pgx.Tx) error {
+		var usage []struct {
+			KeyId    uint32 `db:"key_id"`
+			Requests int    `db:"requests"`
+		}
+
+		if err := pgxscan.Select(ctx, tx, &usage, usageSql, usageParams...); err != nil {
+			return err
+		}
+
+		totals = make(map[uint32]int, len(usage))
+		for _, u := range usage {
+			totals[u.KeyId] = u.Requests
+		}
+
+		_, err := tx.Exec(ctx, usedSql, usedParams...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return totals, nil
+}
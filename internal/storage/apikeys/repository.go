@@ -0,0 +1,52 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// Keys look like bk_ followed by 32 random base64url characters
+const keyPrefix = "bk_"
+
+type Key struct {
+	Id   uint32
+	Name string
+	// Start of the key, to tell which one it is
+	Prefix        string
+	RatePerMinute int
+	DailyQuota    int
+	CreatedAt     time.Time
+	RevokedAt     *time.Time
+	LastUsedAt    *time.Time
+}
+
+type Repository interface {
+	// Create stores the new key and returns it, only its hash is kept
+	Create(ctx context.Context, name string, ratePerMinute, dailyQuota int) (string, *Key, error)
+	// GetByKey returns nil for unknown and revoked keys
+	GetByKey(ctx context.Context, key string) (*Key, error)
+	List(ctx context.Context) ([]*Key, error)
+	// Revoke returns false if there is no such key
+	Revoke(ctx context.Context, id uint32) (bool, error)
+
+	// AddUsage adds the requests made with the keys on the day, and returns the totals of the day
+	AddUsage(ctx context.Context, day time.Time, requests map[uint32]int) (map[uint32]int, error)
+}
+
+func generate() (string, error) {
+	bs := make([]byte, 24)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
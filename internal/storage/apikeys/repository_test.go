@@ -0,0 +1,47 @@
+package apikeys
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	seen := make(map[string]struct{})
+
+	for range 100 {
+		key, err := generate()
+		if err != nil {
+			t.Fatalf("generate() error = %v", err)
+		}
+
+		random, ok := strings.CutPrefix(key, keyPrefix)
+		if !ok {
+			t.Fatalf("generate() = %q, want %s prefix", key, keyPrefix)
+		}
+
+		if len(random) != 32 {
+			t.Errorf("generate() = %q, want 32 characters after the prefix", key)
+		}
+
+		if _, err := base64.RawURLEncoding.DecodeString(random); err != nil {
+			t.Errorf("generate() = %q, not base64url: %v", key, err)
+		}
+
+		if _, ok := seen[key]; ok {
+			t.Fatalf("generate() repeated %q", key)
+		}
+		seen[key] = struct{}{}
+	}
+}
+
+func TestHash(t *testing.T) {
+	// sha256 of the key, hex encoded, as stored in api_key.hash
+	if got, want := hash("bk_test"), "b9ea9a069e1c3d119069883debdf80af44b84dda0c2311afc2728aea4a9a3a88"; got != want {
+		t.Errorf("hash() = %q, want %q", got, want)
+	}
+
+	if hash("bk_test") == hash("bk_tesT") {
+		t.Error("hash() of different keys is the same")
+	}
+}
@@ -0,0 +1,132 @@
+package authors
+
+import (
+	"context"
+	"time"
+
+	"books/internal/cache"
+	"books/internal/storage"
+	"books/internal/storage/books"
+	"books/internal/types"
+)
+
+// NewCachedRepository caches up to size authors and as many query results, each for ttl.
+// Invalidate it with changes of the authors and books
+func NewCachedRepository(r Repository, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		r:       r,
+		byId:    cache.New[string, *types.Author](size, ttl),
+		queries: cache.New[string, any](size, ttl),
+	}
+}
+
+type CachedRepository struct {
+	r       Repository
+	byId    *cache.Cache[string, *types.Author]
+	queries *cache.Cache[string, any]
+}
+
+type counted struct {
+	count int
+	exact bool
+}
+
+func (c *CachedRepository) GetById(ctx context.Context, id string) (*types.Author, error) {
+	as, err := c.GetByIds(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return as[id], nil
+}
+
+func (c *CachedRepository) GetByIds(ctx context.Context, ids ...string) (map[string]*types.Author, error) {
+	return cache.LoadMany(c.byId, ids, func(ids ...string) (map[string]*types.Author, error) {
+		return c.r.GetByIds(ctx, ids...)
+	})
+}
+
+func (c *CachedRepository) Save(ctx context.Context, authors ...*types.Author) error {
+	err := c.r.Save(ctx, authors...)
+
+	ids := make([]string, 0, len(authors))
+	for _, a := range authors {
+		ids = append(ids, a.Id)
+	}
+	c.Invalidate(storage.Change{Entity: storage.EntityAuthor, Ids: ids})
+
+	return err
+}
+
+func (c *CachedRepository) Search(ctx context.Context, query string, bookFilter books.Filter,
+	limit, offset int) ([]*types.Author, error) {
+
+	return cache.Load(c.queries, cache.Key("Search", query, bookFilter, limit, offset),
+		func() ([]*types.Author, error) {
+			return c.r.Search(ctx, query, bookFilter, limit, offset)
+		})
+}
+
+// SearchAfter is not cached, as it walks through all the authors once
+func (c *CachedRepository) SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+	limit int) ([]*types.Author, error) {
+
+	return c.r.SearchAfter(ctx, query, bookFilter, afterId, limit)
+}
+
+func (c *CachedRepository) Count(ctx context.Context, query string, bookFilter books.Filter,
+	exactUpTo int) (int, bool, error) {
+
+	ret, err := cache.Load(c.queries, cache.Key("Count", query, bookFilter, exactUpTo),
+		func() (counted, error) {
+			count, exact, err := c.r.Count(ctx, query, bookFilter, exactUpTo)
+			return counted{count, exact}, err
+		})
+
+	return ret.count, ret.exact, err
+}
+
+func (c *CachedRepository) NamePrefixes(ctx context.Context, prefix string, length int) ([]PrefixCount, error) {
+	return cache.Load(c.queries, cache.Key("NamePrefixes", prefix, length),
+		func() ([]PrefixCount, error) {
+			return c.r.NamePrefixes(ctx, prefix, length)
+		})
+}
+
+func (c *CachedRepository) ByNamePrefix(ctx context.Context, prefix string, limit, offset int) ([]*types.Author, error) {
+	return cache.Load(c.queries, cache.Key("ByNamePrefix", prefix, limit, offset),
+		func() ([]*types.Author, error) {
+			return c.r.ByNamePrefix(ctx, prefix, limit, offset)
+		})
+}
+
+func (c *CachedRepository) BySeries(ctx context.Context, seriesIds []string,
+	limit, offset int) (map[string][]*types.Author, error) {
+
+	return cache.Load(c.queries, cache.Key("BySeries", seriesIds, limit, offset),
+		func() (map[string][]*types.Author, error) {
+			return c.r.BySeries(ctx, seriesIds, limit, offset)
+		})
+}
+
+// Invalidate drops the changed authors. Any change of authors or books drops the query results
+func (c *CachedRepository) Invalidate(change storage.Change) {
+	switch change.Entity {
+	case storage.EntityAuthor:
+		if len(change.Ids) == 0 {
+			c.byId.Purge()
+		} else {
+			c.byId.Delete(change.Ids...)
+		}
+	case storage.EntityBook:
+	default:
+		return
+	}
+
+	c.queries.Purge()
+}
+
+func (c *CachedRepository) Purge() {
+	c.byId.Purge()
+	c.queries.Purge()
+}
@@ -6,12 +6,15 @@ import (
 	"log/slog"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"books/internal/storage"
+	"books/internal/storage/books"
 	"books/internal/types"
 )
 
@@ -30,6 +33,8 @@ type pgxAuthor struct {
 	Name      string `db:"name"`
 	Bio       string `db:"bio"`
 	AvatarUrl string `db:"avatar_url"`
+	// Set by the database
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert,skipupdate"`
 }
 
 func (a *pgxAuthor) intoCommon(l *slog.Logger, ctx context.Context) *types.Author {
@@ -49,10 +54,11 @@ func (a *pgxAuthor) intoCommon(l *slog.Logger, ctx context.Context) *types.Autho
 	}
 
 	return &types.Author{
-		Id:     a.Id,
-		Name:   a.Name,
-		Bio:    a.Bio,
-		Avatar: us,
+		Id:        a.Id,
+		Name:      a.Name,
+		Bio:       a.Bio,
+		Avatar:    us,
+		UpdatedAt: a.UpdatedAt,
 	}
 }
 
@@ -125,7 +131,8 @@ func (p *pgxRepo) Save(ctx context.Context, authors ...*types.Author) error {
 			"name":       goqu.L("excluded.name"),
 			"bio":        goqu.L("excluded.bio"),
 			"avatar_url": goqu.L("excluded.avatar_url"),
-		})).
+		}).Where(goqu.L("(author.name, author.bio, author.avatar_url)" +
+			" is distinct from (excluded.name, excluded.bio, excluded.avatar_url)"))).
 		ToSQL()
 	if err != nil {
 		return err
@@ -135,31 +142,103 @@ func (p *pgxRepo) Save(ctx context.Context, authors ...*types.Author) error {
 	return err
 }
 
-func (p *pgxRepo) Search(ctx context.Context, query string, genreIds []uint16, limit int) ([]*types.Author, error) {
-	qb := p.g.From("author").
-		Order(goqu.C("name").Asc()). // todo sort by relevance? (aka number of books of matching genre, perhaps)
+func (p *pgxRepo) Search(ctx context.Context, query string, bookFilter books.Filter,
+	limit, offset int) ([]*types.Author, error) {
+
+	qb := p.searchQuery(query, bookFilter).
+		Order(goqu.C("name").Asc(), goqu.C("id").Asc()). // todo sort by relevance? (aka number of books of matching genre, perhaps)
 		Limit(uint(limit))
 
-	for _, word := range strings.Split(query, " ") {
-		word = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(word),
-			"\\", "\\\\"),
-			"_", "\\_"),
-			"%", "\\%")
-		if word != "" {
-			qb = qb.Where(goqu.C("name").ILike("%" + word + "%"))
-		}
+	if offset != 0 {
+		qb = qb.Offset(uint(offset))
 	}
 
-	if len(genreIds) > 0 {
-		qb = qb.Where(goqu.C("id").In(
-			goqu.Select("author_id").
-				From("book_author").
-				Where(goqu.C("book_id").In(
-					goqu.Select("book_id").
-						From("book_genre").
-						Where(goqu.C("genre_id").In(genreIds)),
-				)),
-		))
+	sql, params, err := qb.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []pgxAuthor
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*types.Author, 0, len(rows))
+	for _, row := range rows {
+		ret = append(ret, row.intoCommon(p.l, ctx))
+	}
+
+	return ret, nil
+}
+
+func (p *pgxRepo) SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+	limit int) ([]*types.Author, error) {
+
+	qb := p.searchQuery(query, bookFilter).
+		Order(goqu.C("id").Asc()).
+		Limit(uint(limit))
+
+	if afterId != "" {
+		qb = qb.Where(goqu.C("id").Gt(afterId))
+	}
+
+	sql, params, err := qb.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []pgxAuthor
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*types.Author, 0, len(rows))
+	for _, row := range rows {
+		ret = append(ret, row.intoCommon(p.l, ctx))
+	}
+
+	return ret, nil
+}
+
+func (p *pgxRepo) Count(ctx context.Context, query string, bookFilter books.Filter, exactUpTo int) (int, bool, error) {
+	return storage.Count(ctx, p.pg, p.searchQuery(query, bookFilter).Select("id"), exactUpTo)
+}
+
+func (p *pgxRepo) NamePrefixes(ctx context.Context, prefix string, length int) ([]PrefixCount, error) {
+	prefixExpr := goqu.L("upper(left(name, ?))", length)
+
+	sql, params, err := p.g.From("author").
+		Select(prefixExpr.As("prefix"), goqu.COUNT("*").As("count")).
+		Where(goqu.L("upper(name)").Like(escapeLike(strings.ToUpper(prefix)) + "%")).
+		GroupBy(prefixExpr).
+		Order(prefixExpr.Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []PrefixCount
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (p *pgxRepo) ByNamePrefix(ctx context.Context, prefix string, limit, offset int) ([]*types.Author, error) {
+	qb := p.g.From("author").
+		Where(goqu.L("upper(name)").Like(escapeLike(strings.ToUpper(prefix))+"%")).
+		Order(goqu.C("name").Asc(), goqu.C("id").Asc()).
+		Limit(uint(limit))
+
+	if offset != 0 {
+		qb = qb.Offset(uint(offset))
 	}
 
 	sql, params, err := qb.ToSQL()
@@ -181,3 +260,92 @@ func (p *pgxRepo) Search(ctx context.Context, query string, genreIds []uint16, l
 
 	return ret, nil
 }
+
+// pgxAuthorEach is the row of BySeries, rn is the position among the authors of the series
+type pgxAuthorEach struct {
+	Author pgxAuthor `db:""` // follow
+	Parent string    `db:"parent"`
+	Rn     int       `db:"rn"`
+}
+
+func (p *pgxRepo) BySeries(ctx context.Context, seriesIds []string,
+	limit, offset int) (map[string][]*types.Author, error) {
+
+	ret := make(map[string][]*types.Author, len(seriesIds))
+	if len(seriesIds) == 0 {
+		return ret, nil
+	}
+
+	links := goqu.From("book_author").
+		Select(goqu.C("author_id").Table("book_author"), goqu.C("series_id").Table("book_series")).
+		Distinct().
+		Join(goqu.T("book_series"), goqu.On(
+			goqu.C("book_id").Table("book_series").Eq(goqu.C("book_id").Table("book_author")),
+		)).
+		Where(goqu.C("series_id").Table("book_series").In(seriesIds))
+
+	parent := goqu.C("series_id").Table("link")
+
+	inner := p.g.From("author").
+		Select("author.*",
+			parent.As("parent"),
+			goqu.ROW_NUMBER().Over(goqu.W().
+				PartitionBy(parent).
+				OrderBy(goqu.C("name").Table("author").Asc(), goqu.C("id").Table("author").Asc()),
+			).As("rn")).
+		Join(links.As("link"), goqu.On(
+			goqu.C("id").Table("author").Eq(goqu.C("author_id").Table("link")),
+		))
+
+	sql, params, err := p.g.From(inner.As("each")).
+		Where(
+			goqu.C("rn").Gt(offset),
+			goqu.C("rn").Lte(offset+limit),
+		).
+		Order(goqu.C("parent").Asc(), goqu.C("rn").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []pgxAuthorEach
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		ret[row.Parent] = append(ret[row.Parent], row.Author.intoCommon(p.l, ctx))
+	}
+
+	return ret, nil
+}
+
+func (p *pgxRepo) searchQuery(query string, bookFilter books.Filter) *goqu.SelectDataset {
+	qb := p.g.From("author")
+
+	for _, word := range strings.Split(query, " ") {
+		word = escapeLike(strings.TrimSpace(word))
+		if word != "" {
+			qb = qb.Where(goqu.C("name").ILike("%" + word + "%"))
+		}
+	}
+
+	if bookIds := bookFilter.BookIds(); bookIds != nil {
+		qb = qb.Where(goqu.C("id").In(
+			goqu.Select("author_id").
+				From("book_author").
+				Where(goqu.C("book_id").In(bookIds)),
+		))
+	}
+
+	return qb
+}
+
+func escapeLike(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(s,
+		"\\", "\\\\"),
+		"_", "\\_"),
+		"%", "\\%")
+}
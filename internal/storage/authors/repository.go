@@ -3,9 +3,16 @@ package authors
 import (
 	"context"
 
+	"books/internal/storage/books"
 	"books/internal/types"
 )
 
+// PrefixCount is number of authors with names starting with the prefix
+type PrefixCount struct {
+	Prefix string `db:"prefix"`
+	Count  int    `db:"count"`
+}
+
 type Repository interface {
 	GetById(ctx context.Context, id string) (*types.Author, error)
 	// GetByIds shall return map with NON-NULLS!
@@ -13,5 +20,21 @@ type Repository interface {
 
 	Save(ctx context.Context, authors ...*types.Author) error
 
-	Search(ctx context.Context, query string, genreIds []uint16, limit int) ([]*types.Author, error)
+	// Search finds authors by name, having at least one book matching the filter
+	Search(ctx context.Context, query string, bookFilter books.Filter, limit, offset int) ([]*types.Author, error)
+	// SearchAfter finds the same authors as Search, but ordered by id and starting after afterId (if not empty),
+	// so that all of them can be walked through with consistent pages
+	SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+		limit int) ([]*types.Author, error)
+	// Count counts authors found by Search, see storage.Count for exactUpTo
+	Count(ctx context.Context, query string, bookFilter books.Filter, exactUpTo int) (count int, exact bool, err error)
+
+	// NamePrefixes groups authors with names starting with the prefix (case-insensitive)
+	// by the first length characters of their names, upper-cased and sorted
+	NamePrefixes(ctx context.Context, prefix string, length int) ([]PrefixCount, error)
+	// ByNamePrefix finds authors with names starting with the prefix (case-insensitive), sorted by name
+	ByNamePrefix(ctx context.Context, prefix string, limit, offset int) ([]*types.Author, error)
+	// BySeries finds authors of the books of each of the series with the single query, sorted by name.
+	// Limit and offset apply to each of them
+	BySeries(ctx context.Context, seriesIds []string, limit, offset int) (map[string][]*types.Author, error)
 }
@@ -0,0 +1,89 @@
+package authors
+
+import (
+	"context"
+
+	"books/internal/storage/books"
+	"books/internal/tracing"
+	"books/internal/types"
+)
+
+// NewTracedRepository starts span for each call
+func NewTracedRepository(r Repository) Repository {
+	return &tracedRepo{r: r}
+}
+
+type tracedRepo struct {
+	r Repository
+}
+
+func (t *tracedRepo) GetById(ctx context.Context, id string) (_ *types.Author, err error) {
+	ctx, span := tracing.Start(ctx, "authors.GetById")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetById(ctx, id)
+}
+
+func (t *tracedRepo) GetByIds(ctx context.Context, ids ...string) (_ map[string]*types.Author, err error) {
+	ctx, span := tracing.Start(ctx, "authors.GetByIds")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetByIds(ctx, ids...)
+}
+
+func (t *tracedRepo) Save(ctx context.Context, authors ...*types.Author) (err error) {
+	ctx, span := tracing.Start(ctx, "authors.Save")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Save(ctx, authors...)
+}
+
+func (t *tracedRepo) Search(ctx context.Context, query string, bookFilter books.Filter,
+	limit, offset int) (_ []*types.Author, err error) {
+
+	ctx, span := tracing.Start(ctx, "authors.Search")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Search(ctx, query, bookFilter, limit, offset)
+}
+
+func (t *tracedRepo) SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+	limit int) (_ []*types.Author, err error) {
+
+	ctx, span := tracing.Start(ctx, "authors.SearchAfter")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.SearchAfter(ctx, query, bookFilter, afterId, limit)
+}
+
+func (t *tracedRepo) Count(ctx context.Context, query string, bookFilter books.Filter,
+	exactUpTo int) (_ int, _ bool, err error) {
+
+	ctx, span := tracing.Start(ctx, "authors.Count")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Count(ctx, query, bookFilter, exactUpTo)
+}
+
+func (t *tracedRepo) NamePrefixes(ctx context.Context, prefix string, length int) (_ []PrefixCount, err error) {
+	ctx, span := tracing.Start(ctx, "authors.NamePrefixes")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.NamePrefixes(ctx, prefix, length)
+}
+
+func (t *tracedRepo) ByNamePrefix(ctx context.Context, prefix string, limit, offset int) (_ []*types.Author, err error) {
+	ctx, span := tracing.Start(ctx, "authors.ByNamePrefix")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.ByNamePrefix(ctx, prefix, limit, offset)
+}
+
+func (t *tracedRepo) BySeries(ctx context.Context, seriesIds []string,
+	limit, offset int) (_ map[string][]*types.Author, err error) {
+
+	ctx, span := tracing.Start(ctx, "authors.BySeries")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.BySeries(ctx, seriesIds, limit, offset)
+}
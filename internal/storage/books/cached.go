@@ -0,0 +1,156 @@
+package books
+
+import (
+	"context"
+	"time"
+
+	"books/internal/cache"
+	"books/internal/storage"
+	"books/internal/types"
+)
+
+// NewCachedRepository caches up to size books and as many query results, each for ttl.
+// Invalidate it with changes of the books, authors and series
+func NewCachedRepository(r Repository, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		r:       r,
+		byId:    cache.New[string, *types.Book](size, ttl),
+		queries: cache.New[string, any](size, ttl),
+	}
+}
+
+type CachedRepository struct {
+	r       Repository
+	byId    *cache.Cache[string, *types.Book]
+	queries *cache.Cache[string, any]
+}
+
+type searched struct {
+	rows []BookInGroup
+	next string
+}
+
+type counted struct {
+	count int
+	exact bool
+}
+
+func (c *CachedRepository) GetById(ctx context.Context, id string) (*types.Book, error) {
+	bs, err := c.GetByIds(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return bs[id], nil
+}
+
+func (c *CachedRepository) GetByIds(ctx context.Context, ids ...string) (map[string]*types.Book, error) {
+	return cache.LoadMany(c.byId, ids, func(ids ...string) (map[string]*types.Book, error) {
+		return c.r.GetByIds(ctx, ids...)
+	})
+}
+
+func (c *CachedRepository) Save(ctx context.Context, books ...*types.Book) error {
+	err := c.r.Save(ctx, books...)
+
+	ids := make([]string, 0, len(books))
+	for _, b := range books {
+		ids = append(ids, b.Id)
+	}
+	c.Invalidate(storage.Change{Entity: storage.EntityBook, Ids: ids})
+
+	return err
+}
+
+func (c *CachedRepository) LinkBookAndAuthors(ctx context.Context, bookId string, authorIds ...string) error {
+	defer c.Invalidate(storage.Change{Entity: storage.EntityBook, Ids: []string{bookId}})
+	return c.r.LinkBookAndAuthors(ctx, bookId, authorIds...)
+}
+
+func (c *CachedRepository) LinkBookAndGenres(ctx context.Context, bookId string, genreIds ...uint16) error {
+	defer c.Invalidate(storage.Change{Entity: storage.EntityBook, Ids: []string{bookId}})
+	return c.r.LinkBookAndGenres(ctx, bookId, genreIds...)
+}
+
+func (c *CachedRepository) LinkBookAndFiles(ctx context.Context, bookId string, files ...types.BookFile) error {
+	defer c.Invalidate(storage.Change{Entity: storage.EntityBook, Ids: []string{bookId}})
+	return c.r.LinkBookAndFiles(ctx, bookId, files...)
+}
+
+func (c *CachedRepository) LinkSeriesWithBooks(ctx context.Context, seriesId string, bookIds ...string) error {
+	// Books unlinked from the series are unknown here
+	defer c.Invalidate(storage.Change{Entity: storage.EntityBook})
+	return c.r.LinkSeriesWithBooks(ctx, seriesId, bookIds...)
+}
+
+func (c *CachedRepository) Search(ctx context.Context, filter Filter, sort SortType, page Page,
+	groupings ...GroupingType) ([]BookInGroup, string, error) {
+
+	ret, err := cache.Load(c.queries, cache.Key("Search", filter, sort, page, groupings),
+		func() (searched, error) {
+			rows, next, err := c.r.Search(ctx, filter, sort, page, groupings...)
+			return searched{rows, next}, err
+		})
+
+	return ret.rows, ret.next, err
+}
+
+func (c *CachedRepository) SearchEach(ctx context.Context, link Link, ids []string, sort SortType,
+	page Page) (map[string]Listed, error) {
+
+	return cache.Load(c.queries, cache.Key("SearchEach", link, ids, sort, page),
+		func() (map[string]Listed, error) {
+			return c.r.SearchEach(ctx, link, ids, sort, page)
+		})
+}
+
+func (c *CachedRepository) Count(ctx context.Context, filter Filter, exactUpTo int,
+	groupings ...GroupingType) (int, bool, error) {
+
+	ret, err := cache.Load(c.queries, cache.Key("Count", filter, exactUpTo, groupings),
+		func() (counted, error) {
+			count, exact, err := c.r.Count(ctx, filter, exactUpTo, groupings...)
+			return counted{count, exact}, err
+		})
+
+	return ret.count, ret.exact, err
+}
+
+func (c *CachedRepository) Facets(ctx context.Context, filter Filter,
+	facets ...FacetType) (map[FacetType][]FacetValue, error) {
+
+	return cache.Load(c.queries, cache.Key("Facets", filter, facets),
+		func() (map[FacetType][]FacetValue, error) {
+			return c.r.Facets(ctx, filter, facets...)
+		})
+}
+
+func (c *CachedRepository) LastUpdated(ctx context.Context, filter Filter) (time.Time, error) {
+	return cache.Load(c.queries, cache.Key("LastUpdated", filter),
+		func() (time.Time, error) {
+			return c.r.LastUpdated(ctx, filter)
+		})
+}
+
+// Invalidate drops the changed books. Books are searched and sorted by their authors and series,
+// so changes of them drop the query results too
+func (c *CachedRepository) Invalidate(change storage.Change) {
+	switch change.Entity {
+	case storage.EntityBook:
+		if len(change.Ids) == 0 {
+			c.byId.Purge()
+		} else {
+			c.byId.Delete(change.Ids...)
+		}
+	case storage.EntityAuthor, storage.EntitySeries:
+	default:
+		return
+	}
+
+	c.queries.Purge()
+}
+
+func (c *CachedRepository) Purge() {
+	c.byId.Purge()
+	c.queries.Purge()
+}
@@ -0,0 +1,176 @@
+package books
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// orderKey is a single expression in the ORDER BY of the search. Values of all the keys of the last row
+// of the page make the cursor, and the next page starts right after them
+type orderKey struct {
+	expr exp.Expression
+	// SQL type to cast values from cursor to
+	typ  string
+	desc bool
+	// Nulls are ordered last
+	nullable bool
+}
+
+func (k *orderKey) ordered() exp.OrderedExpression {
+	e := goqu.L("?", k.expr)
+
+	if k.desc {
+		return e.Desc()
+	}
+
+	if k.nullable {
+		return e.Asc().NullsLast()
+	}
+
+	return e.Asc()
+}
+
+// after builds condition on key being strictly after the value in the order
+func (k *orderKey) after(val any) exp.Expression {
+	if val == nil {
+		// Nulls are last, nothing is after them
+		return goqu.L("false")
+	}
+
+	op := ">"
+	if k.desc {
+		op = "<"
+	}
+
+	cond := goqu.L("? "+op+" ?::"+k.typ, k.expr, val)
+	if k.nullable {
+		return goqu.Or(cond, goqu.L("? is null", k.expr))
+	}
+
+	return cond
+}
+
+func (k *orderKey) equal(val any) exp.Expression {
+	if val == nil {
+		return goqu.L("? is null", k.expr)
+	}
+
+	return goqu.L("? = ?::"+k.typ, k.expr, val)
+}
+
+// selectKeys builds expression gathering values of the keys into the JSON array
+func selectKeys(keys []orderKey) exp.LiteralExpression {
+	args := make([]any, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key.expr)
+	}
+
+	return goqu.L("jsonb_build_array("+strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")+")", args...)
+}
+
+// afterKeys builds condition selecting rows ordered strictly after the given values:
+// (k1 after v1) or (k1 = v1 and k2 after v2) or ...
+func afterKeys(keys []orderKey, vals []any) exp.Expression {
+	ors := make([]exp.Expression, 0, len(keys))
+
+	for ix, key := range keys {
+		ands := make([]exp.Expression, 0, ix+1)
+		for j := 0; j < ix; j++ {
+			ands = append(ands, keys[j].equal(vals[j]))
+		}
+		ands = append(ands, key.after(vals[ix]))
+
+		ors = append(ors, goqu.And(ands...))
+	}
+
+	return goqu.Or(ors...)
+}
+
+type cursor struct {
+	// Describes the ordering so that cursor is not applied to the different one
+	Order string `json:"o"`
+	Keys  []any  `json:"k"`
+}
+
+func encodeCursor(order string, keys []any) (string, error) {
+	bs, err := json.Marshal(cursor{Order: order, Keys: keys})
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+func decodeCursor(s, order string, keys []orderKey) ([]any, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	var c cursor
+
+	// Keep numbers as is, so that they are cast by the database without loss of precision
+	d := json.NewDecoder(bytes.NewReader(bs))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	if c.Order != order {
+		return nil, fmt.Errorf("%w: it was issued for different sort or grouping", ErrInvalidCursor)
+	}
+
+	if len(c.Keys) != len(keys) {
+		return nil, fmt.Errorf("%w: unexpected number of keys", ErrInvalidCursor)
+	}
+
+	for ix, val := range c.Keys {
+		switch v := val.(type) {
+		case nil, string, json.Number:
+		case []any:
+			arr, err := textArray(v)
+			if err != nil {
+				return nil, err
+			}
+			c.Keys[ix] = arr
+		default:
+			return nil, fmt.Errorf("%w: unexpected key value %v", ErrInvalidCursor, val)
+		}
+	}
+
+	return c.Keys, nil
+}
+
+// textArray makes literal of postgres text array
+func textArray(vals []any) (string, error) {
+	sb := strings.Builder{}
+	sb.WriteString("{")
+
+	for ix, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			return "", fmt.Errorf("%w: unexpected array element %v", ErrInvalidCursor, val)
+		}
+
+		if ix != 0 {
+			sb.WriteString(",")
+		}
+
+		sb.WriteString(`"`)
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`))
+		sb.WriteString(`"`)
+	}
+
+	sb.WriteString("}")
+
+	return sb.String(), nil
+}
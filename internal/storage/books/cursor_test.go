@@ -0,0 +1,147 @@
+package books
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/doug-martin/goqu/v9"
+)
+
+var testKeys = []orderKey{
+	{expr: goqu.C("year").Table("book"), typ: "smallint", desc: true},
+	{expr: goqu.C("series").Table("book"), typ: "text", nullable: true},
+	{expr: goqu.C("genres").Table("book"), typ: "text[]", nullable: true},
+	{expr: goqu.C("id").Table("book"), typ: "text"},
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		// As scanned from the jsonb array of the keys
+		keys []any
+		want []any
+	}{
+		{
+			name: "all values",
+			keys: []any{float64(1960), "Series", []any{"Drama", "Prose"}, "id-1"},
+			want: []any{json.Number("1960"), "Series", `{"Drama","Prose"}`, "id-1"},
+		},
+		{
+			name: "nulls",
+			keys: []any{float64(0), nil, nil, "id-2"},
+			want: []any{json.Number("0"), nil, nil, "id-2"},
+		},
+		{
+			name: "escaped array elements",
+			keys: []any{float64(2000), "", []any{`Quote "q"`, `back\slash`, "a,b"}, "id-3"},
+			want: []any{json.Number("2000"), "", `{"Quote \"q\"","back\\slash","a,b"}`, "id-3"},
+		},
+		{
+			name: "empty array",
+			keys: []any{float64(1), "s", []any{}, "id-4"},
+			want: []any{json.Number("1"), "s", "{}", "id-4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := encodeCursor("-year,false", tt.keys)
+			if err != nil {
+				t.Fatalf("encodeCursor() error = %v", err)
+			}
+
+			got, err := decodeCursor(s, "-year,false", testKeys)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCursor() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	raw := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"o":"-year,false"}`))},
+		{name: "not json", cursor: raw("not json")},
+		{name: "different order", cursor: raw(`{"o":"title,false","k":[1,"s",null,"id"]}`)},
+		{name: "too few keys", cursor: raw(`{"o":"-year,false","k":[1,"s",null]}`)},
+		{name: "too many keys", cursor: raw(`{"o":"-year,false","k":[1,"s",null,"id","extra"]}`)},
+		{name: "boolean key", cursor: raw(`{"o":"-year,false","k":[true,"s",null,"id"]}`)},
+		{name: "object key", cursor: raw(`{"o":"-year,false","k":[{},"s",null,"id"]}`)},
+		{name: "number in array", cursor: raw(`{"o":"-year,false","k":[1,"s",[1],"id"]}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor, "-year,false", testKeys)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestAfterKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []orderKey
+		vals []any
+		want string
+	}{
+		{
+			name: "single ascending",
+			keys: testKeys[3:],
+			vals: []any{"id-1"},
+			want: `"book"."id" > 'id-1'::text`,
+		},
+		{
+			name: "descending then ascending",
+			keys: []orderKey{testKeys[0], testKeys[3]},
+			vals: []any{json.Number("1960"), "id-1"},
+			want: `("book"."year" < '1960'::smallint OR ` +
+				`("book"."year" = '1960'::smallint AND "book"."id" > 'id-1'::text))`,
+		},
+		{
+			name: "nullable is followed by nulls",
+			keys: testKeys[1:2],
+			vals: []any{"Series"},
+			want: `("book"."series" > 'Series'::text OR "book"."series" is null)`,
+		},
+		{
+			name: "nothing is after null",
+			keys: testKeys[1:],
+			vals: []any{nil, `{"Drama"}`, "id-1"},
+			want: `(false OR ` +
+				`("book"."series" is null AND ("book"."genres" > '{"Drama"}'::text[] OR "book"."genres" is null)) OR ` +
+				`("book"."series" is null AND "book"."genres" = '{"Drama"}'::text[] AND "book"."id" > 'id-1'::text))`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, _, err := goqu.Dialect("postgres").From("book").Where(afterKeys(tt.keys, tt.vals)).ToSQL()
+			if err != nil {
+				t.Fatalf("ToSQL() error = %v", err)
+			}
+
+			want := `SELECT * FROM "book" WHERE ` + tt.want
+			if sql != want {
+				t.Errorf("afterKeys() =\n%s\nwant\n%s", sql, want)
+			}
+		})
+	}
+}
@@ -3,15 +3,20 @@ package books
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"books/internal/storage"
 	"books/internal/types"
 )
 
@@ -29,6 +34,19 @@ var (
 	subSequences = goqu.Select(goqu.L("jsonb_object_agg(series_id, book_order)")).
 			From("book_series").
 			Where(goqu.C("book_id").Eq(goqu.C("id")))
+	// Sort keys of the book (referenced as book.id)
+	sortFirstAuthor = goqu.L("(select author.name from book_author" +
+		" join author on author.id = book_author.author_id" +
+		" where book_author.book_id = book.id order by book_author.author_order limit 1)")
+	sortFirstSeries = goqu.L("(select series.title from book_series" +
+		" join series on series.id = book_series.series_id" +
+		" where book_series.book_id = book.id order by series.title, book_series.book_order limit 1)")
+	sortFirstSeriesOrder = goqu.L("(select book_series.book_order from book_series" +
+		" join series on series.id = book_series.series_id" +
+		" where book_series.book_id = book.id order by series.title, book_series.book_order limit 1)")
+	subFiles = goqu.Select(goqu.L("jsonb_agg(jsonb_build_object('format', format, 'type', type, 'url', url) order by format)")).
+			From("book_file").
+			Where(goqu.C("book_id").Eq(goqu.C("id")))
 )
 
 func NewPGXRepository(pg *pgxpool.Pool, l *slog.Logger) Repository {
@@ -48,6 +66,9 @@ type pgxBook struct {
 	Year     uint16 `db:"year"`
 	About    string `db:"about"`
 	CoverUrl string `db:"cover_url"`
+	// Set by the database on insert
+	AddedAt   time.Time `db:"added_at" goqu:"skipinsert,skipupdate"`
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert,skipupdate"`
 }
 
 type pgxBookRealFull struct {
@@ -55,10 +76,19 @@ type pgxBookRealFull struct {
 	AuthorIds []string `db:"authors"`
 	Genres    []string `db:"genres"`
 	Sequences any      `db:"sequences"`
+	Files     any      `db:"files"`
 	Groupings any      `db:"groupings"`
+	Cursor    any      `db:"cursor"`
 }
 
-func (b *pgxBook) intoCommon(authors []string, genres []string, sequences map[string]any,
+func (b *pgxBookRealFull) intoCommon(l *slog.Logger, ctx context.Context) *types.Book {
+	seqs, _ := b.Sequences.(map[string]any)
+	files, _ := b.Files.([]any)
+
+	return b.Base.intoCommon(b.AuthorIds, b.Genres, seqs, files, l, ctx)
+}
+
+func (b *pgxBook) intoCommon(authors []string, genres []string, sequences map[string]any, files []any,
 	l *slog.Logger, ctx context.Context) *types.Book {
 
 	var u *url.URL
@@ -81,16 +111,28 @@ func (b *pgxBook) intoCommon(authors []string, genres []string, sequences map[st
 		series = append(series, types.InSeries{Id: id, Order: uint16(order.(float64))})
 	}
 
+	bookFiles := make([]types.BookFile, 0, len(files))
+	for _, file := range files {
+		f, _ := file.(map[string]any)
+		format, _ := f["format"].(string)
+		typ, _ := f["type"].(string)
+		u, _ := f["url"].(string)
+		bookFiles = append(bookFiles, types.BookFile{Format: format, Type: typ, Url: u})
+	}
+
 	return &types.Book{
-		Id:       b.Id,
-		Title:    b.Title,
-		Authors:  authors,
-		Series:   series,
-		Genres:   genres,
-		Language: b.Language,
-		Year:     b.Year,
-		About:    b.About,
-		Cover:    us,
+		Id:        b.Id,
+		Title:     b.Title,
+		Authors:   authors,
+		Series:    series,
+		Genres:    genres,
+		Language:  b.Language,
+		Year:      b.Year,
+		About:     b.About,
+		Cover:     us,
+		Files:     bookFiles,
+		AddedAt:   b.AddedAt,
+		UpdatedAt: b.UpdatedAt,
 	}
 }
 
@@ -99,7 +141,8 @@ func (p *pgxRepo) GetById(ctx context.Context, id string) (*types.Book, error) {
 		Select("*",
 			subAuthors.As("authors"),
 			subGenres.As("genres"),
-			subSequences.As("sequences")).
+			subSequences.As("sequences"),
+			subFiles.As("files")).
 		Where(goqu.C("id").Eq(id)).
 		ToSQL()
 	if err != nil {
@@ -116,9 +159,7 @@ func (p *pgxRepo) GetById(ctx context.Context, id string) (*types.Book, error) {
 		return nil, err
 	}
 
-	seqs, _ := row.Sequences.(map[string]any)
-
-	return row.Base.intoCommon(row.AuthorIds, row.Genres, seqs, p.l, ctx), nil
+	return row.intoCommon(p.l, ctx), nil
 }
 
 func (p *pgxRepo) GetByIds(ctx context.Context, ids ...string) (map[string]*types.Book, error) {
@@ -130,7 +171,8 @@ func (p *pgxRepo) GetByIds(ctx context.Context, ids ...string) (map[string]*type
 		Select("*",
 			subAuthors.As("authors"),
 			subGenres.As("genres"),
-			subSequences.As("sequences")).
+			subSequences.As("sequences"),
+			subFiles.As("files")).
 		Where(goqu.C("id").In(ids)).
 		ToSQL()
 	if err != nil {
@@ -146,8 +188,7 @@ func (p *pgxRepo) GetByIds(ctx context.Context, ids ...string) (map[string]*type
 
 	ret := make(map[string]*types.Book, len(rows))
 	for _, row := range rows {
-		seqs, _ := row.Sequences.(map[string]any)
-		ret[row.Base.Id] = row.Base.intoCommon(row.AuthorIds, row.Genres, seqs, p.l, ctx)
+		ret[row.Base.Id] = row.intoCommon(p.l, ctx)
 	}
 
 	return ret, nil
@@ -178,7 +219,8 @@ func (p *pgxRepo) Save(ctx context.Context, books ...*types.Book) error {
 			"year":      goqu.L("excluded.year"),
 			"about":     goqu.L("excluded.about"),
 			"cover_url": goqu.L("excluded.cover_url"),
-		})).
+		}).Where(goqu.L("(book.title, book.language, book.year, book.about, book.cover_url)" +
+			" is distinct from (excluded.title, excluded.language, excluded.year, excluded.about, excluded.cover_url)"))).
 		ToSQL()
 	if err != nil {
 		return err
@@ -189,9 +231,13 @@ func (p *pgxRepo) Save(ctx context.Context, books ...*types.Book) error {
 }
 
 func (p *pgxRepo) LinkBookAndAuthors(ctx context.Context, bookId string, authorIds ...string) error {
-	sql, params, err := p.g.Delete("book_author").
-		Where(goqu.C("book_id").Eq(bookId)).
-		ToSQL()
+	del := p.g.Delete("book_author").
+		Where(goqu.C("book_id").Eq(bookId))
+	if len(authorIds) > 0 {
+		del = del.Where(goqu.C("author_id").NotIn(authorIds))
+	}
+
+	sql, params, err := del.ToSQL()
 	if err != nil {
 		return err
 	}
@@ -223,6 +269,9 @@ func (p *pgxRepo) LinkBookAndAuthors(ctx context.Context, bookId string, authorI
 
 	sql, params, err = p.g.Insert("book_author").
 		Rows(rows...).
+		OnConflict(goqu.DoUpdate("author_id, book_id", map[string]any{
+			"author_order": goqu.L("excluded.author_order"),
+		}).Where(goqu.L("book_author.author_order <> excluded.author_order"))).
 		ToSQL()
 	if err != nil {
 		return err
@@ -233,9 +282,13 @@ func (p *pgxRepo) LinkBookAndAuthors(ctx context.Context, bookId string, authorI
 }
 
 func (p *pgxRepo) LinkBookAndGenres(ctx context.Context, bookId string, genreIds ...uint16) error {
-	sql, params, err := p.g.Delete("book_genre").
-		Where(goqu.C("book_id").Eq(bookId)).
-		ToSQL()
+	del := p.g.Delete("book_genre").
+		Where(goqu.C("book_id").Eq(bookId))
+	if len(genreIds) > 0 {
+		del = del.Where(goqu.C("genre_id").NotIn(genreIds))
+	}
+
+	sql, params, err := del.ToSQL()
 	if err != nil {
 		return err
 	}
@@ -265,6 +318,7 @@ func (p *pgxRepo) LinkBookAndGenres(ctx context.Context, bookId string, genreIds
 
 	sql, params, err = p.g.Insert("book_genre").
 		Rows(rows...).
+		OnConflict(goqu.DoNothing()).
 		ToSQL()
 	if err != nil {
 		return err
@@ -274,14 +328,77 @@ func (p *pgxRepo) LinkBookAndGenres(ctx context.Context, bookId string, genreIds
 	return err
 }
 
-func (p *pgxRepo) LinkSeriesWithBooks(ctx context.Context, seriesId string, bookIds ...string) error {
-	sql, params, err := p.g.Delete("book_series").
-		Where(goqu.C("series_id").Eq(seriesId)).
+func (p *pgxRepo) LinkBookAndFiles(ctx context.Context, bookId string, files ...types.BookFile) error {
+	formats := make([]string, 0, len(files))
+	for _, file := range files {
+		formats = append(formats, file.Format)
+	}
+
+	del := p.g.Delete("book_file").
+		Where(goqu.C("book_id").Eq(bookId))
+	if len(formats) > 0 {
+		del = del.Where(goqu.C("format").NotIn(formats))
+	}
+
+	sql, params, err := del.ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.pg.Exec(ctx, sql, params...)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	type row struct {
+		BookId string `db:"book_id"`
+		Format string `db:"format"`
+		Type   string `db:"type"`
+		Url    string `db:"url"`
+	}
+
+	rows := make([]any, 0, len(files))
+
+	for _, file := range files {
+		rows = append(rows, row{
+			BookId: bookId,
+			Format: file.Format,
+			Type:   file.Type,
+			Url:    file.Url,
+		})
+	}
+
+	sql, params, err = p.g.Insert("book_file").
+		Rows(rows...).
+		OnConflict(goqu.DoUpdate("book_id, format", map[string]any{
+			"type": goqu.L("excluded.type"),
+			"url":  goqu.L("excluded.url"),
+		}).Where(goqu.L("(book_file.type, book_file.url) is distinct from (excluded.type, excluded.url)"))).
 		ToSQL()
 	if err != nil {
 		return err
 	}
 
+	_, err = p.pg.Exec(ctx, sql, params...)
+	return err
+}
+
+func (p *pgxRepo) LinkSeriesWithBooks(ctx context.Context, seriesId string, bookIds ...string) error {
+	del := p.g.Delete("book_series").
+		Where(goqu.C("series_id").Eq(seriesId))
+	if len(bookIds) > 0 {
+		del = del.Where(goqu.C("book_id").NotIn(bookIds))
+	}
+
+	sql, params, err := del.ToSQL()
+	if err != nil {
+		return err
+	}
+
 	_, err = p.pg.Exec(ctx, sql, params...)
 	if err != nil {
 		return err
@@ -309,6 +426,9 @@ func (p *pgxRepo) LinkSeriesWithBooks(ctx context.Context, seriesId string, book
 
 	sql, params, err = p.g.Insert("book_series").
 		Rows(rows...).
+		OnConflict(goqu.DoUpdate("book_id, series_id", map[string]any{
+			"book_order": goqu.L("excluded.book_order"),
+		}).Where(goqu.L("book_series.book_order is distinct from excluded.book_order"))).
 		ToSQL()
 	if err != nil {
 		return err
@@ -318,23 +438,27 @@ func (p *pgxRepo) LinkSeriesWithBooks(ctx context.Context, seriesId string, book
 	return err
 }
 
-func (p *pgxRepo) Search(ctx context.Context, query string,
-	authorId string, genreIds []uint16, seriesId string,
-	yearMin, yearMax uint16,
-	limit, offset int,
-	groupings ...GroupingType) ([]BookInGroup, error) {
+func (p *pgxRepo) Search(ctx context.Context, filter Filter, sort SortType, page Page,
+	groupings ...GroupingType) ([]BookInGroup, string, error) {
 
 	qb := p.g.From("book").
 		Select("book.*",
 			subAuthors.As("authors"),
 			subGenres.As("genres"),
-			subSequences.As("sequences")).
-		Limit(uint(limit))
+			subSequences.As("sequences"),
+			subFiles.As("files")).
+		// One more row tells whether there is the next page
+		Limit(uint(page.Limit + 1))
 
-	if offset != 0 {
-		qb = qb.Offset(uint(offset))
+	if page.Offset != 0 {
+		qb = qb.Offset(uint(page.Offset))
 	}
 
+	seriesId := filter.singleSeries()
+
+	var keys []orderKey
+	var orderDesc []string
+
 	groupingExprs := make([]string, 0, len(groupings))
 	groupingPostProcess := make([]func(row *pgxBookRealFull) Grouping, 0, len(groupings))
 
@@ -356,8 +480,8 @@ func (p *pgxRepo) Search(ctx context.Context, query string,
 			qb = qb.
 				Join(goqu.T("book_author"), goqu.On(
 					goqu.C("id").Eq(goqu.C("book_id").Table("book_author")),
-				)).
-				OrderAppend(goqu.C("author_id").Asc())
+				))
+			keys = append(keys, orderKey{expr: goqu.C("author_id").Table("book_author"), typ: "text"})
 		case GroupBySeries:
 			groupIx := len(groupingExprs)
 			groupingPostProcess = append(groupingPostProcess, func(row *pgxBookRealFull) Grouping {
@@ -369,16 +493,20 @@ func (p *pgxRepo) Search(ctx context.Context, query string,
 				qb = qb.
 					Join(goqu.T("book_series"), goqu.On(
 						goqu.C("id").Eq(goqu.C("book_id").Table("book_series")),
-					)).
-					OrderAppend(goqu.C("series_id").Asc())
+					))
+				keys = append(keys, orderKey{expr: goqu.C("series_id").Table("book_series"), typ: "text"})
 			}
 		case GroupByGenres:
 			groupingPostProcess = append(groupingPostProcess, func(row *pgxBookRealFull) Grouping {
 				return Grouping{ByGenres: row.Genres}
 			})
 
-			qb = qb.OrderAppend(goqu.C("genres").Asc())
+			keys = append(keys, orderKey{expr: subGenres, typ: "text[]", nullable: true})
+		default:
+			continue
 		}
+
+		orderDesc = append(orderDesc, string(grouping))
 	}
 
 	if len(groupingExprs) != 0 {
@@ -388,62 +516,64 @@ func (p *pgxRepo) Search(ctx context.Context, query string,
 		)
 	}
 
-	query = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(query),
-		"\\", "\\\\"),
-		"_", "\\_"),
-		"%", "\\%")
-	if query != "" {
-		qb = qb.Where(goqu.C("title").ILike("%" + query + "%"))
-	}
-
-	authorId = strings.TrimSpace(authorId)
-	if authorId != "" {
-		qb = qb.Where(goqu.C("id").In(
-			goqu.Select("book_id").
-				From("book_author").
-				Where(goqu.C("author_id").Eq(authorId)),
-		))
-	}
-
-	if len(genreIds) > 0 {
-		qb = qb.Where(goqu.C("id").In(
-			goqu.Select("book_id").
-				From("book_genre").
-				Where(goqu.C("genre_id").In(genreIds)),
-		))
-	}
-
-	seriesId = strings.TrimSpace(seriesId)
+	// Series filter is applied by the join so that books can be ordered within the series
 	if seriesId != "" {
 		qb = qb.
 			Join(goqu.T("book_series"), goqu.On(
 				goqu.C("id").
 					Eq(goqu.C("book_id").Table("book_series")),
 			)).
-			Where(goqu.C("series_id").Eq(seriesId)).
-			OrderAppend(goqu.C("book_order").Asc())
+			Where(goqu.C("series_id").Eq(seriesId))
+	}
+
+	qb = qb.Where(filter.where(true)...)
+
+	if sort == "" && seriesId != "" {
+		sort = SortSeriesOrder
 	}
 
-	if yearMin > 0 {
-		qb = qb.Where(goqu.C("year").Gte(yearMin))
+	keys = append(keys, sortKeys(&filter, sort, seriesId != "")...)
+	orderDesc = append(orderDesc, string(sort), strconv.FormatBool(seriesId != ""))
+	order := strings.Join(orderDesc, ",")
+
+	if page.Cursor != "" {
+		vals, err := decodeCursor(page.Cursor, order, keys)
+		if err != nil {
+			return nil, "", err
+		}
+
+		qb = qb.Where(afterKeys(keys, vals))
 	}
 
-	if yearMax > 0 {
-		qb = qb.Where(goqu.C("year").Lte(yearMax))
+	for _, key := range keys {
+		qb = qb.OrderAppend(key.ordered())
 	}
 
 	sql, params, err := qb.
-		OrderAppend(goqu.C("title").Asc()).
+		SelectAppend(selectKeys(keys).As("cursor")).
 		ToSQL()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var rows []pgxBookRealFull
 
 	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	var next string
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+
+		if len(rows) > 0 {
+			last, _ := rows[len(rows)-1].Cursor.([]any)
+			next, err = encodeCursor(order, last)
+			if err != nil {
+				return nil, "", err
+			}
+		}
 	}
 
 	ret := make([]BookInGroup, 0, len(rows))
@@ -453,13 +583,437 @@ func (p *pgxRepo) Search(ctx context.Context, query string,
 			groupings = append(groupings, pp(&row))
 		}
 
-		seqs, _ := row.Sequences.(map[string]any)
-
 		ret = append(ret, BookInGroup{
 			Groups: groupings,
-			Book:   row.Base.intoCommon(row.AuthorIds, row.Genres, seqs, p.l, ctx),
+			Book:   row.intoCommon(p.l, ctx),
 		})
 	}
 
+	return ret, next, nil
+}
+
+// pgxBookEach is the row of SearchEach, rn is the position among the books of the parent
+type pgxBookEach struct {
+	Book   pgxBookRealFull `db:""` // follow
+	Parent string          `db:"parent"`
+	Rn     int             `db:"rn"`
+}
+
+func (p *pgxRepo) SearchEach(ctx context.Context, link Link, ids []string, sort SortType,
+	page Page) (map[string]Listed, error) {
+
+	ret := make(map[string]Listed, len(ids))
+	if len(ids) == 0 {
+		return ret, nil
+	}
+
+	var table, column string
+	switch link {
+	case LinkAuthor:
+		table, column = "book_author", "author_id"
+	case LinkGenre:
+		table, column = "book_genre", "genre_id"
+	case LinkSeries:
+		table, column = "book_series", "series_id"
+	default:
+		return nil, fmt.Errorf("unknown link %q", link)
+	}
+
+	// Keys and order are the same as of Search filtered by the single id, so are the cursors
+	seriesJoined := link == LinkSeries
+	if sort == "" && seriesJoined {
+		sort = SortSeriesOrder
+	}
+
+	keys := sortKeys(&Filter{}, sort, seriesJoined)
+	order := string(sort) + "," + strconv.FormatBool(seriesJoined)
+
+	ordered := make([]any, 0, len(keys))
+	for _, key := range keys {
+		ordered = append(ordered, key.ordered())
+	}
+
+	parent := goqu.C(column).Table(table)
+
+	inner := p.g.From("book").
+		Select("book.*",
+			subAuthors.As("authors"),
+			subGenres.As("genres"),
+			subSequences.As("sequences"),
+			subFiles.As("files"),
+			goqu.Cast(parent, "text").As("parent"),
+			selectKeys(keys).As("cursor"),
+			goqu.ROW_NUMBER().Over(goqu.W().PartitionBy(parent).OrderBy(ordered...)).As("rn")).
+		Join(goqu.T(table), goqu.On(
+			goqu.C("id").Eq(goqu.C("book_id").Table(table)),
+		)).
+		Where(parent.In(ids))
+
+	if page.Cursor != "" {
+		vals, err := decodeCursor(page.Cursor, order, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		inner = inner.Where(afterKeys(keys, vals))
+	}
+
+	// One more row of each parent tells whether there is the next page
+	sql, params, err := p.g.From(inner.As("each")).
+		Where(
+			goqu.C("rn").Gt(page.Offset),
+			goqu.C("rn").Lte(page.Offset+page.Limit+1),
+		).
+		Order(goqu.C("parent").Asc(), goqu.C("rn").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []pgxBookEach
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	for ix, row := range rows {
+		listed := ret[row.Parent]
+
+		if row.Rn <= page.Offset+page.Limit {
+			listed.Books = append(listed.Books, row.Book.intoCommon(p.l, ctx))
+		} else if len(listed.Books) > 0 {
+			last, _ := rows[ix-1].Book.Cursor.([]any)
+			listed.Next, err = encodeCursor(order, last)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret[row.Parent] = listed
+	}
+
 	return ret, nil
 }
+
+func (p *pgxRepo) Count(ctx context.Context, filter Filter, exactUpTo int,
+	groupings ...GroupingType) (int, bool, error) {
+
+	qb := p.g.From("book").
+		Select(goqu.C("id").Table("book"))
+
+	seriesId := filter.singleSeries()
+
+	// Same joins as in the Search, since groupings by author and series repeat the book
+	seenGrouping := make(map[GroupingType]struct{}, len(groupings))
+	for _, grouping := range groupings {
+		if _, ok := seenGrouping[grouping]; ok {
+			continue
+		}
+
+		seenGrouping[grouping] = struct{}{}
+
+		switch grouping {
+		case GroupByAuthor:
+			qb = qb.
+				Join(goqu.T("book_author"), goqu.On(
+					goqu.C("id").Eq(goqu.C("book_id").Table("book_author")),
+				))
+		case GroupBySeries:
+			if seriesId == "" {
+				qb = qb.
+					Join(goqu.T("book_series"), goqu.On(
+						goqu.C("id").Eq(goqu.C("book_id").Table("book_series")),
+					))
+			}
+		}
+	}
+
+	if seriesId != "" {
+		qb = qb.
+			Join(goqu.T("book_series"), goqu.On(
+				goqu.C("id").
+					Eq(goqu.C("book_id").Table("book_series")),
+			)).
+			Where(goqu.C("series_id").Eq(seriesId))
+	}
+
+	return storage.Count(ctx, p.pg, qb.Where(filter.where(true)...), exactUpTo)
+}
+
+func (p *pgxRepo) Facets(ctx context.Context, filter Filter, facets ...FacetType) (map[FacetType][]FacetValue, error) {
+	bookIds := filter.BookIds()
+
+	ret := make(map[FacetType][]FacetValue, len(facets))
+
+	for _, facet := range facets {
+		if _, ok := ret[facet]; ok {
+			continue
+		}
+
+		var qb *goqu.SelectDataset
+
+		switch facet {
+		case FacetGenre:
+			qb = p.g.From("book_genre").
+				Join(goqu.T("genre"), goqu.On(
+					goqu.C("id").Table("genre").
+						Eq(goqu.C("genre_id").Table("book_genre")),
+				)).
+				Select(goqu.C("title").Table("genre").As("value"), goqu.COUNT("*").As("count")).
+				GroupBy(goqu.C("title").Table("genre"))
+
+			if bookIds != nil {
+				qb = qb.Where(goqu.C("book_id").In(bookIds))
+			}
+		case FacetLanguage:
+			qb = p.g.From("book").
+				Select(goqu.C("language").As("value"), goqu.COUNT("*").As("count")).
+				Where(goqu.C("language").Neq("")).
+				GroupBy(goqu.C("language"))
+
+			if bookIds != nil {
+				qb = qb.Where(goqu.C("id").In(bookIds))
+			}
+		case FacetDecade:
+			qb = p.g.From("book").
+				Select(goqu.L("(year / 10 * 10)::text").As("value"), goqu.COUNT("*").As("count")).
+				Where(goqu.C("year").Gt(0)).
+				GroupBy(goqu.L("year / 10"))
+
+			if bookIds != nil {
+				qb = qb.Where(goqu.C("id").In(bookIds))
+			}
+		case FacetFormat:
+			qb = p.g.From("book_file").
+				Select(goqu.C("format").As("value"), goqu.COUNT("*").As("count")).
+				GroupBy(goqu.C("format"))
+
+			if bookIds != nil {
+				qb = qb.Where(goqu.C("book_id").In(bookIds))
+			}
+		default:
+			continue
+		}
+
+		sql, params, err := qb.
+			Order(goqu.I("count").Desc(), goqu.I("value").Asc()).
+			ToSQL()
+		if err != nil {
+			return nil, err
+		}
+
+		rows := make([]FacetValue, 0)
+
+		err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s facet: %w", facet, err)
+		}
+
+		ret[facet] = rows
+	}
+
+	return ret, nil
+}
+
+func (p *pgxRepo) LastUpdated(ctx context.Context, filter Filter) (time.Time, error) {
+	sql, params, err := p.g.From("book").
+		Select(goqu.MAX("updated_at")).
+		Where(filter.where(false)...).
+		ToSQL()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var last *time.Time
+
+	err = p.pg.QueryRow(ctx, sql, params...).Scan(&last)
+	if err != nil || last == nil {
+		return time.Time{}, err
+	}
+
+	return *last, nil
+}
+
+// sortKeys builds ordering, appended after the groupings. Ties are always broken by title and then by id
+func sortKeys(filter *Filter, sort SortType, seriesJoined bool) []orderKey {
+	var keys []orderKey
+
+	switch sort {
+	case SortYear:
+		keys = append(keys, orderKey{expr: goqu.C("year").Table("book"), typ: "smallint"})
+	case SortYearDesc:
+		keys = append(keys, orderKey{expr: goqu.C("year").Table("book"), typ: "smallint", desc: true})
+	case SortAuthor:
+		keys = append(keys, orderKey{expr: sortFirstAuthor, typ: "text", nullable: true})
+	case SortSeriesOrder:
+		if seriesJoined {
+			keys = append(keys, orderKey{expr: goqu.C("book_order").Table("book_series"), typ: "smallint", nullable: true})
+		} else {
+			keys = append(keys,
+				orderKey{expr: sortFirstSeries, typ: "text", nullable: true},
+				orderKey{expr: sortFirstSeriesOrder, typ: "smallint", nullable: true},
+			)
+		}
+	case SortAddedAt:
+		keys = append(keys, orderKey{expr: goqu.C("added_at").Table("book"), typ: "timestamp"})
+	case SortAddedAtDesc:
+		keys = append(keys, orderKey{expr: goqu.C("added_at").Table("book"), typ: "timestamp", desc: true})
+	case SortRelevance:
+		if query := strings.TrimSpace(strings.Join(filter.Titles, " ")); query != "" {
+			keys = append(keys, orderKey{expr: goqu.L("similarity(book.title, ?)", query), typ: "real", desc: true})
+		}
+	}
+
+	return append(keys,
+		orderKey{expr: goqu.C("title").Table("book"), typ: "text"},
+		orderKey{expr: goqu.C("id").Table("book"), typ: "text"},
+	)
+}
+
+// where builds conditions on the book table.
+// Single series condition may be skipped if the caller applies it by itself
+func (f *Filter) where(skipSingleSeries bool) []exp.Expression {
+	var conds []exp.Expression
+
+	for _, title := range f.Titles {
+		title = escapeLike(strings.TrimSpace(title))
+		if title != "" {
+			conds = append(conds, goqu.C("title").ILike("%"+title+"%"))
+		}
+	}
+
+	for _, title := range f.ExcludeTitles {
+		title = escapeLike(strings.TrimSpace(title))
+		if title != "" {
+			conds = append(conds, goqu.C("title").NotILike("%"+title+"%"))
+		}
+	}
+
+	if len(f.AuthorIds) > 0 && f.AllAuthors {
+		for _, authorId := range f.AuthorIds {
+			conds = append(conds, goqu.C("id").In(
+				goqu.Select("book_id").
+					From("book_author").
+					Where(goqu.C("author_id").Eq(authorId)),
+			))
+		}
+	} else if len(f.AuthorIds) > 0 {
+		conds = append(conds, goqu.C("id").In(
+			goqu.Select("book_id").
+				From("book_author").
+				Where(goqu.C("author_id").In(f.AuthorIds)),
+		))
+	}
+
+	if len(f.ExcludeAuthorIds) > 0 {
+		conds = append(conds, goqu.C("id").NotIn(
+			goqu.Select("book_id").
+				From("book_author").
+				Where(goqu.C("author_id").In(f.ExcludeAuthorIds)),
+		))
+	}
+
+	if len(f.GenreIds) > 0 {
+		conds = append(conds, goqu.C("id").In(
+			goqu.Select("book_id").
+				From("book_genre").
+				Where(goqu.C("genre_id").In(f.GenreIds)),
+		))
+	}
+
+	if len(f.ExcludeGenreIds) > 0 {
+		conds = append(conds, goqu.C("id").NotIn(
+			goqu.Select("book_id").
+				From("book_genre").
+				Where(goqu.C("genre_id").In(f.ExcludeGenreIds)),
+		))
+	}
+
+	if len(f.SeriesIds) > 0 && !(skipSingleSeries && len(f.SeriesIds) == 1) {
+		conds = append(conds, goqu.C("id").In(
+			goqu.Select("book_id").
+				From("book_series").
+				Where(goqu.C("series_id").In(f.SeriesIds)),
+		))
+	}
+
+	if len(f.ExcludeSeriesIds) > 0 {
+		conds = append(conds, goqu.C("id").NotIn(
+			goqu.Select("book_id").
+				From("book_series").
+				Where(goqu.C("series_id").In(f.ExcludeSeriesIds)),
+		))
+	}
+
+	if len(f.Languages) > 0 {
+		conds = append(conds, goqu.L("lower(language)").In(lowerAll(f.Languages)))
+	}
+
+	if len(f.ExcludeLanguages) > 0 {
+		conds = append(conds, goqu.L("lower(language)").NotIn(lowerAll(f.ExcludeLanguages)))
+	}
+
+	if f.YearMin > 0 {
+		conds = append(conds, goqu.C("year").Gte(f.YearMin))
+	}
+
+	if f.YearMax > 0 {
+		conds = append(conds, goqu.C("year").Lte(f.YearMax))
+	}
+
+	if f.HasCover != nil && *f.HasCover {
+		conds = append(conds, goqu.C("cover_url").Neq(""))
+	} else if f.HasCover != nil {
+		conds = append(conds, goqu.C("cover_url").Eq(""))
+	}
+
+	if f.HasSeries != nil {
+		inSeries := goqu.Select("book_id").From("book_series")
+		if *f.HasSeries {
+			conds = append(conds, goqu.C("id").In(inSeries))
+		} else {
+			conds = append(conds, goqu.C("id").NotIn(inSeries))
+		}
+	}
+
+	return conds
+}
+
+// BookIds builds query selecting ids of the books matching the filter, to be used as subquery.
+// Returns nil if filter matches every book
+func (f *Filter) BookIds() *goqu.SelectDataset {
+	conds := f.where(false)
+	if len(conds) == 0 {
+		return nil
+	}
+
+	return goqu.From("book").
+		Select("id").
+		Where(conds...)
+}
+
+// singleSeries returns series id if filter restricts books to exactly one series
+func (f *Filter) singleSeries() string {
+	if len(f.SeriesIds) != 1 {
+		return ""
+	}
+
+	return strings.TrimSpace(f.SeriesIds[0])
+}
+
+func lowerAll(vals []string) []string {
+	ret := make([]string, 0, len(vals))
+	for _, val := range vals {
+		ret = append(ret, strings.ToLower(strings.TrimSpace(val)))
+	}
+
+	return ret
+}
+
+func escapeLike(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(s,
+		"\\", "\\\\"),
+		"_", "\\_"),
+		"%", "\\%")
+}
@@ -2,6 +2,7 @@ package books
 
 import (
 	"context"
+	"time"
 
 	"books/internal/types"
 )
@@ -14,6 +15,90 @@ const (
 	GroupBySeries GroupingType = "series"
 )
 
+type SortType string
+
+const (
+	SortTitle    SortType = "title"
+	SortYear     SortType = "year"
+	SortYearDesc SortType = "-year"
+	// By name of the first author
+	SortAuthor SortType = "author"
+	// By position in the series when filtered by exactly one series, otherwise by title of the first series
+	SortSeriesOrder SortType = "series_order"
+	SortAddedAt     SortType = "added_at"
+	SortAddedAtDesc SortType = "-added_at"
+	// By similarity of the title to the searched titles
+	SortRelevance SortType = "relevance"
+)
+
+// Link is the relation of books listed by SearchEach
+type Link string
+
+const (
+	LinkAuthor Link = "author"
+	LinkGenre  Link = "genre"
+	LinkSeries Link = "series"
+)
+
+type FacetType string
+
+const (
+	FacetGenre    FacetType = "genre"
+	FacetLanguage FacetType = "language"
+	FacetDecade   FacetType = "decade"
+	FacetFormat   FacetType = "format"
+)
+
+// Filter narrows down the set of books. Zero value matches every book.
+// Inclusive lists match book having ANY of the values, exclusive lists drop books having ANY of the values
+type Filter struct {
+	// Title must contain each of them
+	Titles        []string
+	ExcludeTitles []string
+
+	AuthorIds []string
+	// Book must have ALL of AuthorIds instead of ANY
+	AllAuthors       bool
+	ExcludeAuthorIds []string
+
+	GenreIds        []uint16
+	ExcludeGenreIds []uint16
+
+	// If exactly one series is specified, books are ordered by their position in it
+	SeriesIds        []string
+	ExcludeSeriesIds []string
+
+	// Case-insensitive
+	Languages        []string
+	ExcludeLanguages []string
+
+	YearMin uint16
+	YearMax uint16
+
+	// Nil means any
+	HasCover  *bool
+	HasSeries *bool
+}
+
+type Page struct {
+	Limit  int
+	Offset int
+	// Opaque token returned with the previous page, offset is counted from it
+	Cursor string
+}
+
+// Listed is the page of books of one of the ids in SearchEach
+type Listed struct {
+	Books []*types.Book
+	// Cursor of the next page, empty if there are no more books
+	Next string
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
 type Repository interface {
 	GetById(ctx context.Context, id string) (*types.Book, error)
 	// GetByIds shall return map with NON-NULLS!
@@ -21,13 +106,32 @@ type Repository interface {
 
 	Save(ctx context.Context, books ...*types.Book) error
 
+	// Link* replace the links, only the changed ones are written so unchanged books keep their UpdatedAt
 	LinkBookAndAuthors(ctx context.Context, bookId string, authorIds ...string) error
 	LinkBookAndGenres(ctx context.Context, bookId string, genreIds ...uint16) error
+	LinkBookAndFiles(ctx context.Context, bookId string, files ...types.BookFile) error
 	LinkSeriesWithBooks(ctx context.Context, seriesId string, bookIds ...string) error
 
-	Search(ctx context.Context, query string,
-		authorId string, genreIds []uint16, seriesId string,
-		yearMin, yearMax uint16,
-		limit, offset int,
-		groupings ...GroupingType) ([]BookInGroup, error)
+	// Search orders books by groupings first and then by the sort. Empty sort means series order
+	// if filtered by exactly one series, or title otherwise.
+	// Returns cursor for the next page, empty if there are no more books.
+	// Cursor is only valid for the same sort and groupings, ErrInvalidCursor is returned otherwise
+	Search(ctx context.Context, filter Filter, sort SortType, page Page,
+		groupings ...GroupingType) ([]BookInGroup, string, error)
+	// SearchEach does Search filtered by each of the authors, genres (decimal ids) or series separately
+	// with the single query. The page applies to each of them, and the cursors are interchangeable
+	// with the ones of Search filtered by that id with the same sort
+	SearchEach(ctx context.Context, link Link, ids []string, sort SortType, page Page) (map[string]Listed, error)
+
+	// Count counts rows returned by Search (books are repeated by groupings by author and series),
+	// see storage.Count for exactUpTo
+	Count(ctx context.Context, filter Filter, exactUpTo int,
+		groupings ...GroupingType) (count int, exact bool, err error)
+
+	// Facets counts books matching the filter by each value of requested facets.
+	// Values are ordered by count descending
+	Facets(ctx context.Context, filter Filter, facets ...FacetType) (map[FacetType][]FacetValue, error)
+
+	// LastUpdated returns the latest UpdatedAt of the books matching the filter, zero time if there are none
+	LastUpdated(ctx context.Context, filter Filter) (time.Time, error)
 }
@@ -0,0 +1,110 @@
+package books
+
+import (
+	"context"
+	"time"
+
+	"books/internal/tracing"
+	"books/internal/types"
+)
+
+// NewTracedRepository starts span for each call
+func NewTracedRepository(r Repository) Repository {
+	return &tracedRepo{r: r}
+}
+
+type tracedRepo struct {
+	r Repository
+}
+
+func (t *tracedRepo) GetById(ctx context.Context, id string) (_ *types.Book, err error) {
+	ctx, span := tracing.Start(ctx, "books.GetById")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetById(ctx, id)
+}
+
+func (t *tracedRepo) GetByIds(ctx context.Context, ids ...string) (_ map[string]*types.Book, err error) {
+	ctx, span := tracing.Start(ctx, "books.GetByIds")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetByIds(ctx, ids...)
+}
+
+func (t *tracedRepo) Save(ctx context.Context, books ...*types.Book) (err error) {
+	ctx, span := tracing.Start(ctx, "books.Save")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Save(ctx, books...)
+}
+
+func (t *tracedRepo) LinkBookAndAuthors(ctx context.Context, bookId string, authorIds ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "books.LinkBookAndAuthors")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.LinkBookAndAuthors(ctx, bookId, authorIds...)
+}
+
+func (t *tracedRepo) LinkBookAndGenres(ctx context.Context, bookId string, genreIds ...uint16) (err error) {
+	ctx, span := tracing.Start(ctx, "books.LinkBookAndGenres")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.LinkBookAndGenres(ctx, bookId, genreIds...)
+}
+
+func (t *tracedRepo) LinkBookAndFiles(ctx context.Context, bookId string, files ...types.BookFile) (err error) {
+	ctx, span := tracing.Start(ctx, "books.LinkBookAndFiles")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.LinkBookAndFiles(ctx, bookId, files...)
+}
+
+func (t *tracedRepo) LinkSeriesWithBooks(ctx context.Context, seriesId string, bookIds ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "books.LinkSeriesWithBooks")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.LinkSeriesWithBooks(ctx, seriesId, bookIds...)
+}
+
+func (t *tracedRepo) Search(ctx context.Context, filter Filter, sort SortType, page Page,
+	groupings ...GroupingType) (_ []BookInGroup, _ string, err error) {
+
+	ctx, span := tracing.Start(ctx, "books.Search")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Search(ctx, filter, sort, page, groupings...)
+}
+
+func (t *tracedRepo) SearchEach(ctx context.Context, link Link, ids []string, sort SortType,
+	page Page) (_ map[string]Listed, err error) {
+
+	ctx, span := tracing.Start(ctx, "books.SearchEach")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.SearchEach(ctx, link, ids, sort, page)
+}
+
+func (t *tracedRepo) Count(ctx context.Context, filter Filter, exactUpTo int,
+	groupings ...GroupingType) (_ int, _ bool, err error) {
+
+	ctx, span := tracing.Start(ctx, "books.Count")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Count(ctx, filter, exactUpTo, groupings...)
+}
+
+func (t *tracedRepo) Facets(ctx context.Context, filter Filter,
+	facets ...FacetType) (_ map[FacetType][]FacetValue, err error) {
+
+	ctx, span := tracing.Start(ctx, "books.Facets")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Facets(ctx, filter, facets...)
+}
+
+func (t *tracedRepo) LastUpdated(ctx context.Context, filter Filter) (_ time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "books.LastUpdated")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.LastUpdated(ctx, filter)
+}
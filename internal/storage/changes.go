@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ChangesChannel is the Postgres NOTIFY channel announcing changed entities
+const ChangesChannel = "books_changes"
+
+type Entity string
+
+const (
+	EntityBook   Entity = "book"
+	EntityAuthor Entity = "author"
+	EntitySeries Entity = "series"
+	EntityGenre  Entity = "genre"
+)
+
+// Change tells which entities were saved. Empty Ids means all entities of the kind
+type Change struct {
+	Entity Entity   `json:"entity"`
+	Ids    []string `json:"ids,omitempty"`
+}
+
+// Payload of NOTIFY is limited by 8000 bytes, leave some margin
+const maxPayload = 7500
+
+type Notifier interface {
+	Notify(ctx context.Context, changes ...Change) error
+}
+
+func NewPGXNotifier(pg *pgxpool.Pool) Notifier {
+	return &pgxNotifier{pg: pg}
+}
+
+type pgxNotifier struct {
+	pg *pgxpool.Pool
+}
+
+func (p *pgxNotifier) Notify(ctx context.Context, changes ...Change) error {
+	for _, change := range changes {
+		payloads, err := splitChange(change)
+		if err != nil {
+			return err
+		}
+
+		for _, payload := range payloads {
+			_, err = p.pg.Exec(ctx, "select pg_notify($1, $2)", ChangesChannel, payload)
+			if err != nil {
+				return fmt.Errorf("notifying %s changes: %w", change.Entity, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitChange encodes the change into payloads of at most maxPayload bytes each
+func splitChange(change Change) ([]string, error) {
+	var payloads []string
+
+	flush := func(ids []string) error {
+		bs, err := json.Marshal(Change{Entity: change.Entity, Ids: ids})
+		if err != nil {
+			return err
+		}
+
+		payloads = append(payloads, string(bs))
+		return nil
+	}
+
+	// Size of the payload without the ids
+	empty := len(`{"entity":"","ids":[]}`) + len(change.Entity)
+	size := empty
+	from := 0
+	for ix, id := range change.Ids {
+		bs, err := json.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if ix > from && size+1+len(bs) > maxPayload {
+			if err := flush(change.Ids[from:ix]); err != nil {
+				return nil, err
+			}
+
+			size = empty
+			from = ix
+		}
+
+		if ix > from {
+			// Comma
+			size++
+		}
+		size += len(bs)
+	}
+
+	if err := flush(change.Ids[from:]); err != nil {
+		return nil, err
+	}
+
+	return payloads, nil
+}
+
+type Invalidator interface {
+	Invalidate(change Change)
+	// Purge drops everything, changes might have been missed
+	Purge()
+}
+
+// Listen passes changes notified on ChangesChannel to the invalidators until ctx is done.
+// On connection loss it reconnects, purging the invalidators as notifications might have been missed meanwhile
+func Listen(ctx context.Context, pg *pgxpool.Pool, l *slog.Logger, invalidators ...Invalidator) {
+	for ctx.Err() == nil {
+		err := listen(ctx, pg, l, invalidators)
+		if ctx.Err() != nil {
+			return
+		}
+
+		l.Error("listening to " + ChangesChannel + ": " + err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func listen(ctx context.Context, pg *pgxpool.Pool, l *slog.Logger, invalidators []Invalidator) error {
+	pooled, err := pg.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN is bound to the connection, so do not return it into the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "listen "+ChangesChannel)
+	if err != nil {
+		return err
+	}
+
+	for _, inv := range invalidators {
+		inv.Purge()
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var change Change
+		if err := json.Unmarshal([]byte(n.Payload), &change); err != nil {
+			l.Warn("invalid " + ChangesChannel + " payload: " + err.Error())
+			continue
+		}
+
+		for _, inv := range invalidators {
+			inv.Invalidate(change)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitChange(t *testing.T) {
+	longIds := make([]string, 1000)
+	for ix := range longIds {
+		// Ids are up to 255 characters, escaping makes them even longer
+		longIds[ix] = fmt.Sprintf("%s%05d", strings.Repeat("<", 250), ix)
+	}
+
+	tests := []struct {
+		name   string
+		change Change
+		want   int
+	}{
+		{name: "all", change: Change{Entity: EntityGenre}, want: 1},
+		{name: "few ids", change: Change{Entity: EntityBook, Ids: []string{"a", "b"}}, want: 1},
+		{name: "long ids", change: Change{Entity: EntityAuthor, Ids: longIds}, want: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads, err := splitChange(tt.change)
+			if err != nil {
+				t.Fatalf("splitChange() error = %v", err)
+			}
+
+			if len(payloads) != tt.want {
+				t.Errorf("splitChange() = %d payloads, want %d", len(payloads), tt.want)
+			}
+
+			var ids []string
+			for _, payload := range payloads {
+				if len(payload) > maxPayload {
+					t.Errorf("payload of %d bytes exceeds %d", len(payload), maxPayload)
+				}
+
+				var change Change
+				if err := json.Unmarshal([]byte(payload), &change); err != nil {
+					t.Fatalf("unmarshaling payload: %v", err)
+				}
+
+				if change.Entity != tt.change.Entity {
+					t.Errorf("payload entity = %s, want %s", change.Entity, tt.change.Entity)
+				}
+				ids = append(ids, change.Ids...)
+			}
+
+			if !reflect.DeepEqual(ids, tt.change.Ids) {
+				t.Errorf("splitChange() ids = %v, want %v", ids, tt.change.Ids)
+			}
+		})
+	}
+}
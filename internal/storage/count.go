@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Count counts rows returned by the query. If the planner expects more than exactUpTo rows,
+// its estimate is returned instead (with exact set to false), because exact count would scan all of them
+func Count(ctx context.Context, pg *pgxpool.Pool, qb *goqu.SelectDataset, exactUpTo int) (count int, exact bool, err error) {
+	sql, params, err := qb.ToSQL()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+
+	var bs []byte
+	err = pg.QueryRow(ctx, "explain (format json) "+sql, params...).Scan(&bs)
+	if err != nil {
+		return 0, false, fmt.Errorf("estimating count: %w", err)
+	}
+
+	err = json.Unmarshal(bs, &plan)
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing query plan: %w", err)
+	}
+
+	if len(plan) == 0 {
+		return 0, false, errors.New("parsing query plan: empty plan")
+	}
+
+	if estimate := int(plan[0].Plan.Rows); estimate > exactUpTo {
+		return estimate, false, nil
+	}
+
+	sql, params, err = goqu.Dialect("postgres").
+		From(qb.As("t")).
+		Select(goqu.COUNT("*")).
+		ToSQL()
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = pg.QueryRow(ctx, sql, params...).Scan(&count)
+	if err != nil {
+		return 0, false, fmt.Errorf("counting: %w", err)
+	}
+
+	return count, true, nil
+}
@@ -0,0 +1,68 @@
+package genres
+
+import (
+	"context"
+	"time"
+
+	"books/internal/cache"
+	"books/internal/storage"
+)
+
+// NewCachedRepository caches up to size query results, each for ttl. Invalidate it with changes of the genres
+func NewCachedRepository(r Repository, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		r:       r,
+		queries: cache.New[string, any](size, ttl),
+	}
+}
+
+type CachedRepository struct {
+	r       Repository
+	queries *cache.Cache[string, any]
+}
+
+func (c *CachedRepository) GetById(ctx context.Context, id uint16) (string, error) {
+	return cache.Load(c.queries, cache.Key("GetById", id), func() (string, error) {
+		return c.r.GetById(ctx, id)
+	})
+}
+
+func (c *CachedRepository) GetByIds(ctx context.Context, ids ...uint16) (map[uint16]string, error) {
+	return cache.Load(c.queries, cache.Key("GetByIds", ids), func() (map[uint16]string, error) {
+		return c.r.GetByIds(ctx, ids...)
+	})
+}
+
+func (c *CachedRepository) GetIdByTitle(ctx context.Context, title string) (uint16, error) {
+	return cache.Load(c.queries, cache.Key("GetIdByTitle", title), func() (uint16, error) {
+		return c.r.GetIdByTitle(ctx, title)
+	})
+}
+
+func (c *CachedRepository) GetIdByTitles(ctx context.Context, titles ...string) (map[string]uint16, error) {
+	return cache.Load(c.queries, cache.Key("GetIdByTitles", titles), func() (map[string]uint16, error) {
+		return c.r.GetIdByTitles(ctx, titles...)
+	})
+}
+
+func (c *CachedRepository) Insert(ctx context.Context, titles ...string) (map[string]uint16, error) {
+	defer c.Purge()
+	return c.r.Insert(ctx, titles...)
+}
+
+func (c *CachedRepository) GetAll(ctx context.Context) ([]string, error) {
+	return cache.Load(c.queries, cache.Key("GetAll"), func() ([]string, error) {
+		return c.r.GetAll(ctx)
+	})
+}
+
+// Invalidate drops everything on any change of the genres, there are few of them
+func (c *CachedRepository) Invalidate(change storage.Change) {
+	if change.Entity == storage.EntityGenre {
+		c.queries.Purge()
+	}
+}
+
+func (c *CachedRepository) Purge() {
+	c.queries.Purge()
+}
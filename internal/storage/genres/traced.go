@@ -0,0 +1,58 @@
+package genres
+
+import (
+	"context"
+
+	"books/internal/tracing"
+)
+
+// NewTracedRepository starts span for each call
+func NewTracedRepository(r Repository) Repository {
+	return &tracedRepo{r: r}
+}
+
+type tracedRepo struct {
+	r Repository
+}
+
+func (t *tracedRepo) GetById(ctx context.Context, id uint16) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "genres.GetById")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetById(ctx, id)
+}
+
+func (t *tracedRepo) GetByIds(ctx context.Context, ids ...uint16) (_ map[uint16]string, err error) {
+	ctx, span := tracing.Start(ctx, "genres.GetByIds")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetByIds(ctx, ids...)
+}
+
+func (t *tracedRepo) GetIdByTitle(ctx context.Context, title string) (_ uint16, err error) {
+	ctx, span := tracing.Start(ctx, "genres.GetIdByTitle")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetIdByTitle(ctx, title)
+}
+
+func (t *tracedRepo) GetIdByTitles(ctx context.Context, titles ...string) (_ map[string]uint16, err error) {
+	ctx, span := tracing.Start(ctx, "genres.GetIdByTitles")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetIdByTitles(ctx, titles...)
+}
+
+func (t *tracedRepo) Insert(ctx context.Context, titles ...string) (_ map[string]uint16, err error) {
+	ctx, span := tracing.Start(ctx, "genres.Insert")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Insert(ctx, titles...)
+}
+
+func (t *tracedRepo) GetAll(ctx context.Context) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "genres.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetAll(ctx)
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+
+	"books/db"
+)
+
+// Goose migrations are named like 20240615131810_init.sql
+var migrationName = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+
+// MigrationsFS returns the migrations in dir, or the embedded ones if dir is empty
+func MigrationsFS(dir string) fs.FS {
+	if dir == "" {
+		return db.Migrations
+	}
+
+	return os.DirFS(dir)
+}
+
+// PendingMigrations lists versions of the migrations not applied by goose yet, sorted.
+// Unlike goose it neither takes the lock nor creates the version table, so it is fine for probes
+func PendingMigrations(ctx context.Context, pg *pgxpool.Pool, migrations fs.FS) ([]int64, error) {
+	entries, err := fs.ReadDir(migrations, ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	var versions []int64
+	for _, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration %s: %w", entry.Name(), err)
+		}
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+
+	var exists bool
+	if err := pg.QueryRow(ctx, `select to_regclass('goose_db_version') is not null`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("checking applied migrations: %w", err)
+	}
+	if !exists {
+		return versions, nil
+	}
+
+	// Latest record of the version tells whether it is applied
+	rows, err := pg.Query(ctx, `select version_id from (
+		select distinct on (version_id) version_id, is_applied from goose_db_version order by version_id, id desc
+	) v where is_applied`)
+	if err != nil {
+		return nil, fmt.Errorf("checking applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]struct{})
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("checking applied migrations: %w", err)
+		}
+		applied[version] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("checking applied migrations: %w", err)
+	}
+
+	var pending []int64
+	for _, version := range versions {
+		if _, ok := applied[version]; !ok {
+			pending = append(pending, version)
+		}
+	}
+
+	return pending, nil
+}
+
+// CheckSchema fails if some of the migrations are not applied, the code would not work with such schema
+func CheckSchema(ctx context.Context, pg *pgxpool.Pool, migrations fs.FS) error {
+	pending, err := PendingMigrations(ctx, pg, migrations)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind, %d migrations are pending starting with %d, apply them with migrate up",
+			len(pending), pending[0])
+	}
+
+	return nil
+}
+
+// Migrate runs goose command up, down (the last migration) or status, writing the results to w.
+// Concurrent runs, like several instances migrating on start, wait for each other
+func Migrate(ctx context.Context, pg *pgxpool.Pool, migrations fs.FS, command string, w io.Writer) error {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return err
+	}
+
+	// Closing it does not close the pool
+	p, err := goose.NewProvider(goose.DialectPostgres, stdlib.OpenDBFromPool(pg), migrations,
+		goose.WithSessionLocker(locker))
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	defer p.Close()
+
+	switch command {
+	case "up":
+		results, err := p.Up(ctx)
+		var partial *goose.PartialError
+		if errors.As(err, &partial) {
+			results = partial.Applied
+		}
+		for _, r := range results {
+			fmt.Fprintln(w, r)
+		}
+		if partial != nil {
+			return fmt.Errorf("applying %s: %w", path.Base(partial.Failed.Source.Path), partial.Err)
+		}
+		if err != nil {
+			return fmt.Errorf("applying migrations: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(w, "No pending migrations")
+		}
+	case "down":
+		r, err := p.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Fprintln(w, "No applied migrations")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("rolling back: %w", err)
+		}
+		fmt.Fprintln(w, r)
+	case "status":
+		statuses, err := p.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("checking migrations: %w", err)
+		}
+		for _, s := range statuses {
+			appliedAt := "-"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%-8s %-19s %s\n", s.State, appliedAt, path.Base(s.Source.Path))
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+
+	return nil
+}
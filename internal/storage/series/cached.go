@@ -0,0 +1,118 @@
+package series
+
+import (
+	"context"
+	"time"
+
+	"books/internal/cache"
+	"books/internal/storage"
+	"books/internal/storage/books"
+	"books/internal/types"
+)
+
+// NewCachedRepository caches up to size series and as many query results, each for ttl.
+// Invalidate it with changes of the series and books
+func NewCachedRepository(r Repository, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		r:       r,
+		byId:    cache.New[string, *types.Series](size, ttl),
+		queries: cache.New[string, any](size, ttl),
+	}
+}
+
+type CachedRepository struct {
+	r       Repository
+	byId    *cache.Cache[string, *types.Series]
+	queries *cache.Cache[string, any]
+}
+
+type counted struct {
+	count int
+	exact bool
+}
+
+func (c *CachedRepository) GetById(ctx context.Context, id string) (*types.Series, error) {
+	ss, err := c.GetByIds(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss[id], nil
+}
+
+func (c *CachedRepository) GetByIds(ctx context.Context, ids ...string) (map[string]*types.Series, error) {
+	return cache.LoadMany(c.byId, ids, func(ids ...string) (map[string]*types.Series, error) {
+		return c.r.GetByIds(ctx, ids...)
+	})
+}
+
+func (c *CachedRepository) Save(ctx context.Context, sequences ...*types.Series) error {
+	err := c.r.Save(ctx, sequences...)
+
+	ids := make([]string, 0, len(sequences))
+	for _, s := range sequences {
+		ids = append(ids, s.Id)
+	}
+	c.Invalidate(storage.Change{Entity: storage.EntitySeries, Ids: ids})
+
+	return err
+}
+
+func (c *CachedRepository) Search(ctx context.Context, query string, bookFilter books.Filter,
+	limit, offset int) ([]*types.Series, error) {
+
+	return cache.Load(c.queries, cache.Key("Search", query, bookFilter, limit, offset),
+		func() ([]*types.Series, error) {
+			return c.r.Search(ctx, query, bookFilter, limit, offset)
+		})
+}
+
+// SearchAfter is not cached, as it walks through all the series once
+func (c *CachedRepository) SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+	limit int) ([]*types.Series, error) {
+
+	return c.r.SearchAfter(ctx, query, bookFilter, afterId, limit)
+}
+
+func (c *CachedRepository) Count(ctx context.Context, query string, bookFilter books.Filter,
+	exactUpTo int) (int, bool, error) {
+
+	ret, err := cache.Load(c.queries, cache.Key("Count", query, bookFilter, exactUpTo),
+		func() (counted, error) {
+			count, exact, err := c.r.Count(ctx, query, bookFilter, exactUpTo)
+			return counted{count, exact}, err
+		})
+
+	return ret.count, ret.exact, err
+}
+
+func (c *CachedRepository) ByAuthors(ctx context.Context, authorIds []string,
+	limit, offset int) (map[string][]*types.Series, error) {
+
+	return cache.Load(c.queries, cache.Key("ByAuthors", authorIds, limit, offset),
+		func() (map[string][]*types.Series, error) {
+			return c.r.ByAuthors(ctx, authorIds, limit, offset)
+		})
+}
+
+// Invalidate drops the changed series. Any change of series or books drops the query results
+func (c *CachedRepository) Invalidate(change storage.Change) {
+	switch change.Entity {
+	case storage.EntitySeries:
+		if len(change.Ids) == 0 {
+			c.byId.Purge()
+		} else {
+			c.byId.Delete(change.Ids...)
+		}
+	case storage.EntityBook:
+	default:
+		return
+	}
+
+	c.queries.Purge()
+}
+
+func (c *CachedRepository) Purge() {
+	c.byId.Purge()
+	c.queries.Purge()
+}
@@ -5,12 +5,15 @@ import (
 	"errors"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"books/internal/storage"
+	"books/internal/storage/books"
 	"books/internal/types"
 )
 
@@ -27,6 +30,16 @@ type pgxRepo struct {
 type pgxSeries struct {
 	Id    string `db:"id"`
 	Title string `db:"title"`
+	// Set by the database
+	UpdatedAt time.Time `db:"updated_at" goqu:"skipinsert,skipupdate"`
+}
+
+func (s *pgxSeries) intoCommon() *types.Series {
+	return &types.Series{
+		Id:        s.Id,
+		Title:     s.Title,
+		UpdatedAt: s.UpdatedAt,
+	}
 }
 
 func (p *pgxRepo) GetById(ctx context.Context, id string) (*types.Series, error) {
@@ -47,10 +60,7 @@ func (p *pgxRepo) GetById(ctx context.Context, id string) (*types.Series, error)
 		return nil, err
 	}
 
-	return &types.Series{
-		Id:    row.Id,
-		Title: row.Title,
-	}, nil
+	return row.intoCommon(), nil
 }
 
 func (p *pgxRepo) GetByIds(ctx context.Context, ids ...string) (map[string]*types.Series, error) {
@@ -74,10 +84,7 @@ func (p *pgxRepo) GetByIds(ctx context.Context, ids ...string) (map[string]*type
 
 	ret := make(map[string]*types.Series, len(rows))
 	for _, row := range rows {
-		ret[row.Id] = &types.Series{
-			Id:    row.Id,
-			Title: row.Title,
-		}
+		ret[row.Id] = row.intoCommon()
 	}
 
 	return ret, nil
@@ -100,7 +107,7 @@ func (p *pgxRepo) Save(ctx context.Context, sequences ...*types.Series) error {
 		Rows(rows...).
 		OnConflict(goqu.DoUpdate("id", map[string]any{
 			"title": goqu.L("excluded.title"),
-		})).
+		}).Where(goqu.L("series.title is distinct from excluded.title"))).
 		ToSQL()
 	if err != nil {
 		return err
@@ -111,43 +118,46 @@ func (p *pgxRepo) Save(ctx context.Context, sequences ...*types.Series) error {
 }
 
 func (p *pgxRepo) Search(ctx context.Context, query string,
-	authorId string, genreIds []uint16,
-	limit int) ([]*types.Series, error) {
+	bookFilter books.Filter,
+	limit, offset int) ([]*types.Series, error) {
 
-	qb := p.g.From("series").
-		Order(goqu.C("title").Asc()).
+	qb := p.searchQuery(query, bookFilter).
+		Order(goqu.C("title").Asc(), goqu.C("id").Asc()).
 		Limit(uint(limit))
 
-	query = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(query),
-		"\\", "\\\\"),
-		"_", "\\_"),
-		"%", "\\%")
-	if query != "" {
-		qb = qb.Where(goqu.C("title").ILike("%" + query + "%"))
+	if offset != 0 {
+		qb = qb.Offset(uint(offset))
 	}
 
-	authorId = strings.ToLower(authorId)
-	if authorId != "" || len(genreIds) > 0 {
-		sub := goqu.Select("series_id").
-			From("book_series")
+	sql, params, err := qb.ToSQL()
+	if err != nil {
+		return nil, err
+	}
 
-		if authorId != "" {
-			sub = sub.Where(goqu.C("book_id").In(
-				goqu.Select("book_id").
-					From("book_author").
-					Where(goqu.C("author_id").Eq(authorId)),
-			))
-		}
+	var rows []pgxSeries
 
-		if len(genreIds) > 0 {
-			sub = sub.Where(goqu.C("book_id").In(
-				goqu.Select("book_id").
-					From("book_genre").
-					Where(goqu.C("genre_id").In(genreIds)),
-			))
-		}
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*types.Series, 0, len(rows))
+	for _, row := range rows {
+		ret = append(ret, row.intoCommon())
+	}
 
-		qb = qb.Where(goqu.C("id").In(sub))
+	return ret, nil
+}
+
+func (p *pgxRepo) SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+	limit int) ([]*types.Series, error) {
+
+	qb := p.searchQuery(query, bookFilter).
+		Order(goqu.C("id").Asc()).
+		Limit(uint(limit))
+
+	if afterId != "" {
+		qb = qb.Where(goqu.C("id").Gt(afterId))
 	}
 
 	sql, params, err := qb.ToSQL()
@@ -164,8 +174,95 @@ func (p *pgxRepo) Search(ctx context.Context, query string,
 
 	ret := make([]*types.Series, 0, len(rows))
 	for _, row := range rows {
-		ret = append(ret, &types.Series{Id: row.Id, Title: row.Title})
+		ret = append(ret, row.intoCommon())
+	}
+
+	return ret, nil
+}
+
+func (p *pgxRepo) Count(ctx context.Context, query string, bookFilter books.Filter, exactUpTo int) (int, bool, error) {
+	return storage.Count(ctx, p.pg, p.searchQuery(query, bookFilter).Select("id"), exactUpTo)
+}
+
+// pgxSeriesEach is the row of ByAuthors, rn is the position among the series of the author
+type pgxSeriesEach struct {
+	Series pgxSeries `db:""` // follow
+	Parent string    `db:"parent"`
+	Rn     int       `db:"rn"`
+}
+
+func (p *pgxRepo) ByAuthors(ctx context.Context, authorIds []string,
+	limit, offset int) (map[string][]*types.Series, error) {
+
+	ret := make(map[string][]*types.Series, len(authorIds))
+	if len(authorIds) == 0 {
+		return ret, nil
+	}
+
+	links := goqu.From("book_series").
+		Select(goqu.C("series_id").Table("book_series"), goqu.C("author_id").Table("book_author")).
+		Distinct().
+		Join(goqu.T("book_author"), goqu.On(
+			goqu.C("book_id").Table("book_author").Eq(goqu.C("book_id").Table("book_series")),
+		)).
+		Where(goqu.C("author_id").Table("book_author").In(authorIds))
+
+	parent := goqu.C("author_id").Table("link")
+
+	inner := p.g.From("series").
+		Select("series.*",
+			parent.As("parent"),
+			goqu.ROW_NUMBER().Over(goqu.W().
+				PartitionBy(parent).
+				OrderBy(goqu.C("title").Table("series").Asc(), goqu.C("id").Table("series").Asc()),
+			).As("rn")).
+		Join(links.As("link"), goqu.On(
+			goqu.C("id").Table("series").Eq(goqu.C("series_id").Table("link")),
+		))
+
+	sql, params, err := p.g.From(inner.As("each")).
+		Where(
+			goqu.C("rn").Gt(offset),
+			goqu.C("rn").Lte(offset+limit),
+		).
+		Order(goqu.C("parent").Asc(), goqu.C("rn").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []pgxSeriesEach
+
+	err = pgxscan.Select(ctx, p.pg, &rows, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		ret[row.Parent] = append(ret[row.Parent], row.Series.intoCommon())
 	}
 
 	return ret, nil
 }
+
+func (p *pgxRepo) searchQuery(query string, bookFilter books.Filter) *goqu.SelectDataset {
+	qb := p.g.From("series")
+
+	query = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(query),
+		"\\", "\\\\"),
+		"_", "\\_"),
+		"%", "\\%")
+	if query != "" {
+		qb = qb.Where(goqu.C("title").ILike("%" + query + "%"))
+	}
+
+	if bookIds := bookFilter.BookIds(); bookIds != nil {
+		qb = qb.Where(goqu.C("id").In(
+			goqu.Select("series_id").
+				From("book_series").
+				Where(goqu.C("book_id").In(bookIds)),
+		))
+	}
+
+	return qb
+}
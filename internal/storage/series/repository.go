@@ -3,6 +3,7 @@ package series
 import (
 	"context"
 
+	"books/internal/storage/books"
 	"books/internal/types"
 )
 
@@ -13,5 +14,15 @@ type Repository interface {
 
 	Save(ctx context.Context, sequences ...*types.Series) error
 
-	Search(ctx context.Context, query string, authorId string, genreIds []uint16, limit int) ([]*types.Series, error)
+	// Search finds series by title, having at least one book matching the filter
+	Search(ctx context.Context, query string, bookFilter books.Filter, limit, offset int) ([]*types.Series, error)
+	// SearchAfter finds the same series as Search, but ordered by id and starting after afterId (if not empty),
+	// so that all of them can be walked through with consistent pages
+	SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+		limit int) ([]*types.Series, error)
+	// Count counts series found by Search, see storage.Count for exactUpTo
+	Count(ctx context.Context, query string, bookFilter books.Filter, exactUpTo int) (count int, exact bool, err error)
+	// ByAuthors finds series of the books of each of the authors with the single query, sorted by title.
+	// Limit and offset apply to each of them
+	ByAuthors(ctx context.Context, authorIds []string, limit, offset int) (map[string][]*types.Series, error)
 }
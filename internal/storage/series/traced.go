@@ -0,0 +1,75 @@
+package series
+
+import (
+	"context"
+
+	"books/internal/storage/books"
+	"books/internal/tracing"
+	"books/internal/types"
+)
+
+// NewTracedRepository starts span for each call
+func NewTracedRepository(r Repository) Repository {
+	return &tracedRepo{r: r}
+}
+
+type tracedRepo struct {
+	r Repository
+}
+
+func (t *tracedRepo) GetById(ctx context.Context, id string) (_ *types.Series, err error) {
+	ctx, span := tracing.Start(ctx, "series.GetById")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetById(ctx, id)
+}
+
+func (t *tracedRepo) GetByIds(ctx context.Context, ids ...string) (_ map[string]*types.Series, err error) {
+	ctx, span := tracing.Start(ctx, "series.GetByIds")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.GetByIds(ctx, ids...)
+}
+
+func (t *tracedRepo) Save(ctx context.Context, sequences ...*types.Series) (err error) {
+	ctx, span := tracing.Start(ctx, "series.Save")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Save(ctx, sequences...)
+}
+
+func (t *tracedRepo) Search(ctx context.Context, query string, bookFilter books.Filter,
+	limit, offset int) (_ []*types.Series, err error) {
+
+	ctx, span := tracing.Start(ctx, "series.Search")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Search(ctx, query, bookFilter, limit, offset)
+}
+
+func (t *tracedRepo) SearchAfter(ctx context.Context, query string, bookFilter books.Filter, afterId string,
+	limit int) (_ []*types.Series, err error) {
+
+	ctx, span := tracing.Start(ctx, "series.SearchAfter")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.SearchAfter(ctx, query, bookFilter, afterId, limit)
+}
+
+func (t *tracedRepo) Count(ctx context.Context, query string, bookFilter books.Filter,
+	exactUpTo int) (_ int, _ bool, err error) {
+
+	ctx, span := tracing.Start(ctx, "series.Count")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.Count(ctx, query, bookFilter, exactUpTo)
+}
+
+func (t *tracedRepo) ByAuthors(ctx context.Context, authorIds []string,
+	limit, offset int) (_ map[string][]*types.Series, err error) {
+
+	ctx, span := tracing.Start(ctx, "series.ByAuthors")
+	defer func() { tracing.End(span, err) }()
+
+	return t.r.ByAuthors(ctx, authorIds, limit, offset)
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer handling all the pgx events, like the logging one
+type fullTracer interface {
+	pgx.QueryTracer
+	pgx.BatchTracer
+	pgx.CopyFromTracer
+	pgx.ConnectTracer
+	pgx.PrepareTracer
+}
+
+// NewPGXTracer starts span for each query and batch, passing all the events to the logging tracer too
+func NewPGXTracer(next fullTracer) pgx.QueryTracer {
+	return &pgxTracer{next: next}
+}
+
+type pgxTracer struct {
+	next fullTracer
+}
+
+func (t *pgxTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracer.Start(ctx, "query", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBQueryText(data.SQL)))
+
+	return t.next.TraceQueryStart(ctx, conn, data)
+}
+
+func (t *pgxTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.next.TraceQueryEnd(ctx, conn, data)
+	End(trace.SpanFromContext(ctx), data.Err)
+}
+
+func (t *pgxTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	ctx, _ = tracer.Start(ctx, "batch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL))
+
+	return t.next.TraceBatchStart(ctx, conn, data)
+}
+
+func (t *pgxTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	t.next.TraceBatchQuery(ctx, conn, data)
+	trace.SpanFromContext(ctx).AddEvent(data.SQL)
+}
+
+func (t *pgxTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.next.TraceBatchEnd(ctx, conn, data)
+	End(trace.SpanFromContext(ctx), data.Err)
+}
+
+func (t *pgxTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.next.TraceCopyFromStart(ctx, conn, data)
+}
+
+func (t *pgxTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.next.TraceCopyFromEnd(ctx, conn, data)
+}
+
+func (t *pgxTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	return t.next.TraceConnectStart(ctx, data)
+}
+
+func (t *pgxTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	t.next.TraceConnectEnd(ctx, data)
+}
+
+func (t *pgxTracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	return t.next.TracePrepareStart(ctx, conn, data)
+}
+
+func (t *pgxTracer) TracePrepareEnd(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareEndData) {
+	t.next.TracePrepareEnd(ctx, conn, data)
+}
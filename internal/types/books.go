@@ -1,15 +1,21 @@
 package types
 
+import "time"
+
 type Author struct {
 	Id     string `json:"id"`
 	Name   string `json:"name"`
 	Bio    string `json:"bio,omitempty"`
 	Avatar string `json:"avatar_url,omitempty"`
+	// Filled by storage, ignored on save
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Series struct {
 	Id    string `json:"id"`
 	Title string `json:"title"`
+	// Filled by storage, ignored on save
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type InSeries struct {
@@ -17,6 +23,13 @@ type InSeries struct {
 	Order uint16 `json:"order"`
 }
 
+type BookFile struct {
+	// Short name of the format, like fb2 or epub
+	Format string `json:"format"`
+	Type   string `json:"type,omitempty"`
+	Url    string `json:"url"`
+}
+
 type Book struct {
 	Id    string `json:"id"`
 	Title string `json:"title"`
@@ -29,4 +42,10 @@ type Book struct {
 	Year     uint16   `json:"year"`
 	About    string   `json:"about,omitempty"`
 	Cover    string   `json:"cover_url,omitempty"`
+	// Must be unique by format and sorted by format
+	Files []BookFile `json:"files"`
+	// Filled by storage, ignored on save
+	AddedAt time.Time `json:"added_at"`
+	// Changes with any of the fields above. Filled by storage, ignored on save
+	UpdatedAt time.Time `json:"updated_at"`
 }
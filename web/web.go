@@ -0,0 +1,7 @@
+// Package web holds the API documentation pages and openapi.yaml, embedded into the server
+package web
+
+import "embed"
+
+//go:embed *.html openapi.yaml
+var Assets embed.FS